@@ -0,0 +1,173 @@
+// Copyright © 2019 Marcus Mengs
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mame82/munifying/unifying"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// firmwareAnalysis holds everything known about a firmware file
+type firmwareAnalysis struct {
+	File          string   `json:"file"`
+	Target        string   `json:"target"`
+	Family        string   `json:"family,omitempty"`
+	Version       string   `json:"version"`
+	BuildDate     string   `json:"build_date,omitempty"`
+	Bootloader    bool     `json:"bootloader"`
+	BootloaderVID uint16   `json:"bootloader_vid,omitempty"`
+	BootloaderPID uint16   `json:"bootloader_pid,omitempty"`
+	Image         string   `json:"image"`
+	MemoryMap     []string `json:"memory_map,omitempty"`
+	Vectors       []string `json:"vectors,omitempty"`
+	CRC           uint16   `json:"crc"`
+	CRCValid      bool     `json:"crc_valid"`
+	CRCComputed   uint16   `json:"crc_computed"`
+	CRCRange      string   `json:"crc_range"`
+	EndMarker     string   `json:"end_marker,omitempty"`
+	Signature     bool     `json:"signature"`
+}
+
+func (a firmwareAnalysis) String() (res string) {
+	res += fmt.Sprintf("Target:      %s\n", a.Target)
+	if a.Family != "" {
+		res += fmt.Sprintf("Family:      %s\n", a.Family)
+	}
+	res += fmt.Sprintf("Version:     %s\n", a.Version)
+	if a.BuildDate != "" {
+		res += fmt.Sprintf("Build date:  %s\n", a.BuildDate)
+	}
+	if a.Bootloader {
+		res += fmt.Sprintf("Bootloader:  present (VID %#04x PID %#04x)\n", a.BootloaderVID, a.BootloaderPID)
+	} else {
+		res += fmt.Sprintln("Bootloader:  none")
+	}
+	res += fmt.Sprintf("Image:       %s\n", a.Image)
+	crcState := "valid"
+	if !a.CRCValid {
+		crcState = "INVALID"
+	}
+	res += fmt.Sprintf("CRC:         %#04x (%s)\n", a.CRC, crcState)
+	if !a.CRCValid {
+		res += fmt.Sprintf("CRC debug:   computed %#04x over %s\n", a.CRCComputed, a.CRCRange)
+	}
+	if a.EndMarker != "" {
+		res += fmt.Sprintf("End marker:  %s\n", a.EndMarker)
+	}
+	if a.Signature {
+		res += fmt.Sprintln("Signature:   present (not verified)")
+	} else {
+		res += fmt.Sprintln("Signature:   none")
+	}
+	if len(a.MemoryMap) > 0 {
+		res += fmt.Sprintln("\nMemory map:")
+		for _, r := range a.MemoryMap {
+			res += fmt.Sprintf("\t%s\n", r)
+		}
+	}
+	if len(a.Vectors) > 0 {
+		res += fmt.Sprintln("\nVectors:")
+		for _, v := range a.Vectors {
+			res += fmt.Sprintf("\t%s\n", v)
+		}
+	}
+	return
+}
+
+// AnalyzeFirmwareFile parses the given firmware file (Intel hex for .hex/.shex, raw blob otherwise) and prints all
+// information which could be extracted from it. Unlike VerifyFirmwareFile, an invalid CRC is reported instead of
+// failing the analysis.
+func AnalyzeFirmwareFile(path string) (err error) {
+	var fw *unifying.Firmware
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hex", ".shex":
+		fw, err = unifying.ParseFirmwareHexWithOptions(path, unifying.HexParseOptions{SkipCRC: true})
+	default:
+		var blob []byte
+		if blob, err = ioutil.ReadFile(path); err == nil {
+			fw, err = unifying.ParseFirmwareBinWithOptions(blob, unifying.BinParseOptions{SkipCRC: true})
+		}
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("can't parse '%s': %v", path, err))
+	}
+
+	res := firmwareAnalysis{
+		File:       path,
+		Target:     fw.TargetType.String(),
+		Version:    "unknown",
+		Bootloader: fw.HasBL,
+		Image:      fmt.Sprintf("%#04x-%#04x (%#04x bytes)", fw.StartOffset, fw.LastOffset, fw.Size),
+		CRC:        fw.CRC,
+		CRCValid:   fw.CRCValid,
+		Signature:  fw.HasSignature,
+	}
+	_, crcComputed, crcStart, crcEnd := fw.CRCDebug()
+	res.CRCComputed = crcComputed
+	res.CRCRange = fmt.Sprintf("%#04x-%#04x", crcStart, crcEnd)
+	if fw.HasBL {
+		res.BootloaderVID, res.BootloaderPID = uint16(fw.BootloaderVID), uint16(fw.BootloaderPID)
+	}
+	if family, errF := fw.Family(); errF == nil {
+		res.Family = family.String()
+	}
+	if bi, errBI := fw.BuildInfo(); errBI == nil && bi.HasVersion {
+		res.Version = bi.Version.String()
+		if bi.HasDate {
+			res.BuildDate = bi.Date
+		}
+	}
+	if fw.EndMarker != nil {
+		res.EndMarker = fmt.Sprintf("% 02x", fw.EndMarker)
+	}
+	if regions, errM := fw.MemoryMap(); errM == nil {
+		for _, r := range regions {
+			res.MemoryMap = append(res.MemoryMap, r.String())
+		}
+	}
+	if vectors, errV := fw.Vectors(); errV == nil {
+		for _, v := range vectors {
+			res.Vectors = append(res.Vectors, v.String())
+		}
+	}
+	return printOutput(res, "\n"+res.String())
+}
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze <file.hex|file.shex|file.bin>",
+	Short: "Print memory map, vectors and metadata of a firmware file (no receiver needed)",
+	Long: `Print memory map, vectors and metadata of a firmware file (no receiver needed).
+
+Files with extension .hex or .shex are parsed as Intel hex, all other files as raw firmware blob. The report
+covers target type, receiver family, version, bootloader, the regions of the blob (offsets into the file), the
+8051 reset/interrupt vectors (TI firmware only), CRC status, end marker and signature presence. An invalid CRC
+is reported, but doesn't abort the analysis (use 'verify' to check a file before flashing).`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return AnalyzeFirmwareFile(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(analyzeCmd)
+}
@@ -0,0 +1,97 @@
+// Copyright © 2019 Marcus Mengs
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/mame82/munifying/unifying"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"time"
+)
+
+var tmpBatteryMonitorInterval time.Duration
+
+// BatteryMonitor prints the battery state of all paired devices every interval, till Ctrl-C. The paired devices
+// are enumerated again on each round, so devices going offline (or coming back) are picked up.
+func BatteryMonitor(interval time.Duration) {
+	usb, err := openDongle()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	defer usb.Close()
+	usb.SetShowInOut(false)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("Polling battery status every %v, press Ctrl-C to stop ...\n", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ts := time.Now().Format("15:04:05")
+		devices, err := usb.GetPairedDevices()
+		if err != nil {
+			fmt.Printf("%s ERROR: couldn't enumerate paired devices: %v\n", ts, err)
+		} else if len(devices) == 0 {
+			fmt.Printf("%s no paired devices\n", ts)
+		}
+		for _, d := range devices {
+			model := fmt.Sprintf("WPID %#04x", d.WPID)
+			if name, _, known := unifying.DeviceModelFromWPID(d.WPID); known {
+				model = name
+			}
+			prefix := fmt.Sprintf("%s device %d (%s, %s):", ts, d.DeviceIndex, model, d.DeviceType)
+			if !d.Link {
+				fmt.Println(prefix, "offline")
+				continue
+			}
+			battery, eBat := usb.GetBatteryStatus(d.DeviceIndex)
+			if eBat != nil {
+				fmt.Println(prefix, "battery status unavailable:", eBat)
+				continue
+			}
+			fmt.Println(prefix, battery.String())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+var batteryMonitorCmd = &cobra.Command{
+	Use:   "battery-monitor",
+	Short: "Periodically print battery status of all devices paired to first receiver found on USB, till Ctrl-C",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		if tmpBatteryMonitorInterval <= 0 {
+			fmt.Println("ERROR: interval has to be positive")
+			return
+		}
+		BatteryMonitor(tmpBatteryMonitorInterval)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(batteryMonitorCmd)
+	batteryMonitorCmd.Flags().DurationVar(&tmpBatteryMonitorInterval, "interval", 30*time.Second, "polling interval")
+}
@@ -0,0 +1,56 @@
+// Copyright © 2019 Marcus Mengs
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+func ShowConnectedDeviceCount() {
+	usb, err := openDongle()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	defer usb.Close()
+
+	usb.SetShowInOut(false)
+	count, err := usb.GetConnectedDeviceCount()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	printOutput(struct {
+		Count int `json:"count"`
+	}{count}, fmt.Sprintln(count))
+}
+
+var countCmd = &cobra.Command{
+	Use:   "count",
+	Short: "Print the device count reported by the connection state register of first receiver found on USB",
+	Long: `Print the device count reported by the connection state register of first receiver found on USB.
+
+Only a single register is read and no device arrival notifications are triggered, so the command is cheap
+enough to be used by monitoring scripts which poll frequently. The output is the plain number.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ShowConnectedDeviceCount()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(countCmd)
+}
@@ -0,0 +1,55 @@
+// Copyright © 2019 Marcus Mengs
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/mame82/munifying/unifying"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+func DecodeReport(hexbytes string) {
+	// allow common separators of captured hex dumps, f.e. "10:ff:81:f1:01:00:00" or "10 ff 81 f1 01 00 00"
+	hexbytes = strings.NewReplacer(" ", "", ":", "", "-", "", "0x", "").Replace(hexbytes)
+	report, err := hex.DecodeString(hexbytes)
+	if err != nil {
+		fmt.Printf("ERROR: invalid hex input: %v\n", err)
+		return
+	}
+
+	res, err := unifying.DecodeHIDPP(report)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	fmt.Println(res)
+}
+
+var decodeCmd = &cobra.Command{
+	Use:   "decode <hexbytes>",
+	Short: "Decode a raw HID++ / DJ report (f.e. from a USB capture) into human-readable form",
+	Long:  "",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		DecodeReport(strings.Join(args, ""))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(decodeCmd)
+}
@@ -0,0 +1,64 @@
+// Copyright © 2019 Marcus Mengs
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"strconv"
+)
+
+func ShowDeviceInfo(index byte) {
+	usb, err := openDongle()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	defer usb.Close()
+
+	usb.SetShowInOut(false)
+	info, err := usb.GetDeviceInfo(index)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	text := info.String()
+	if !info.HasProtocol {
+		text += "\tDevice not reachable, only the pairing information of the receiver is shown\n"
+	}
+	if eOut := printOutput(info, text); eOut != nil {
+		fmt.Printf("ERROR: %v\n", eOut)
+	}
+}
+
+var deviceCmd = &cobra.Command{
+	Use:   "device <index>",
+	Short: "Show pairing info, protocol, name, battery and feature count of a device paired to first receiver found on USB",
+	Long:  "",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		index, err := strconv.ParseUint(args[0], 0, 8)
+		if err != nil || index < 1 || index > 6 {
+			fmt.Println("ERROR: device index has to be between 1 and 6")
+			return
+		}
+		ShowDeviceInfo(byte(index))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deviceCmd)
+}
@@ -0,0 +1,65 @@
+// Copyright © 2019 Marcus Mengs
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mame82/munifying/unifying"
+	"github.com/spf13/cobra"
+	"strconv"
+)
+
+func ShowMouseDPI(index byte) {
+	usb, err := openDongle()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	defer usb.Close()
+
+	usb.SetShowInOut(false)
+	supported, current, err := usb.GetMouseDPI(index)
+	if err != nil {
+		if errors.Is(err, unifying.ErrFeatureUnsupported) {
+			fmt.Println("ERROR: device does not support adjustable DPI (HID++ 2.0 feature 0x2201)")
+			return
+		}
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	fmt.Printf("Current DPI:   %d\n", current)
+	fmt.Printf("Supported DPI: %v\n", supported)
+}
+
+var dpiCmd = &cobra.Command{
+	Use:   "dpi <index>",
+	Short: "Show supported and current DPI of a HID++ 2.0 mouse paired to first receiver found on USB",
+	Long:  "",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		index, err := strconv.ParseUint(args[0], 0, 8)
+		if err != nil || index < 1 || index > 6 {
+			fmt.Println("ERROR: device index has to be between 1 and 6")
+			return
+		}
+		ShowMouseDPI(byte(index))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dpiCmd)
+}
@@ -17,14 +17,13 @@ package cmd
 
 import (
 	"fmt"
-	"github.com/mame82/munifying/unifying"
 	"io/ioutil"
 
 	"github.com/spf13/cobra"
 )
 
 func DumpDongleInfo() {
-	usb, err := unifying.NewLocalUSBDongle()
+	usb, err := openDongle()
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,63 @@
+// Copyright © 2019 Marcus Mengs
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+)
+
+var tmpDumpDeviceDataOut string
+
+// DumpDeviceData reads both device data flash pages of the receiver and writes them to outPath
+func DumpDeviceData(outPath string) {
+	usb, err := openDongle()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	defer usb.Close()
+	usb.SetShowInOut(false)
+
+	data, pages, err := usb.DumpDeviceData()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	if err = ioutil.WriteFile(outPath, data, 0644); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	fmt.Printf("device data pages %#04x and %#04x (XDATA) stored to file '%s'\n", pages[0], pages[1], outPath)
+}
+
+var dumpDeviceDataCmd = &cobra.Command{
+	Use:   "dump-devicedata",
+	Short: "Dump the device data flash pages (pairing info, keys) of a TI receiver utilizing secret HID++ command",
+	Long: `Dump the device data flash pages (pairing info, keys) of a TI receiver utilizing secret HID++ command.
+
+The page addresses depend on the bootloader version of the receiver: 0xec00/0xf000 for BOT03.01 and older,
+0xe400/0xe800 for newer ones. The output holds both pages (2 * 0x400 bytes) in this order.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		DumpDeviceData(tmpDumpDeviceDataOut)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dumpDeviceDataCmd)
+	dumpDeviceDataCmd.Flags().StringVar(&tmpDumpDeviceDataOut, "out", "devicedata.bin", "output file")
+}
@@ -26,7 +26,7 @@ import (
 )
 
 func DumpDongleNordic() (err error) {
-	usbReceiver, err := unifying.NewLocalUSBDongle()
+	usbReceiver, err := openDongle()
 	if err != nil {
 		fmt.Println(err)
 	} else {
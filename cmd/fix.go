@@ -0,0 +1,87 @@
+// Copyright © 2019 Marcus Mengs
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mame82/munifying/unifying"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// FixFirmwareFile repairs the metadata of a (hand-edited) firmware file and writes the result as raw firmware blob
+// to outPath. The input is parsed with SkipCRC and the image CRC is recalculated. The end marker needs no repair, as
+// parsing TI images already requires a known one. The result is parsed again, before it is written.
+func FixFirmwareFile(inPath string, outPath string) (err error) {
+	var fw *unifying.Firmware
+	switch strings.ToLower(filepath.Ext(inPath)) {
+	case ".hex", ".shex":
+		fw, err = unifying.ParseFirmwareHexWithOptions(inPath, unifying.HexParseOptions{SkipCRC: true})
+	default:
+		var blob []byte
+		if blob, err = ioutil.ReadFile(inPath); err == nil {
+			fw, err = unifying.ParseFirmwareBinWithOptions(blob, unifying.BinParseOptions{SkipCRC: true})
+		}
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("can't parse '%s': %v", inPath, err))
+	}
+	fmt.Println()
+
+	oldCRC, oldValid := fw.CRC, fw.CRCValid
+	if err = fw.UpdateCRC(); err != nil {
+		return
+	}
+	if !oldValid || oldCRC != fw.CRC {
+		fmt.Printf("CRC: %#04x -> %#04x\n", oldCRC, fw.CRC)
+	} else {
+		fmt.Println("Nothing to fix, CRC is valid")
+	}
+
+	// make sure the result passes the checks applied by flash
+	if _, err = unifying.ParseFirmwareBin(fw.Bytes()); err != nil {
+		return errors.New(fmt.Sprintf("repaired firmware still invalid: %v", err))
+	}
+	if err = ioutil.WriteFile(outPath, fw.Bytes(), 0644); err != nil {
+		return
+	}
+	fmt.Printf("Repaired firmware written to '%s'\n", outPath)
+	return nil
+}
+
+var fixCmd = &cobra.Command{
+	Use:   "fix <in.hex|in.shex|in.bin> <out.bin>",
+	Short: "Repair the CRC of a firmware file (no receiver needed)",
+	Long: `Repair the CRC of a firmware file (no receiver needed).
+
+The input is parsed like with 'verify', but an invalid CRC is accepted. The image CRC is recalculated and the
+repaired firmware is written as raw blob (including the bootloader, if the input has one). The changes are
+printed. TI firmware has to be terminated by the known end marker (fe c0 ad de), which all receiver families
+use.`,
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return FixFirmwareFile(args[0], args[1])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fixCmd)
+}
@@ -16,12 +16,15 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/mame82/munifying/unifying"
 	"github.com/spf13/cobra"
 	"io/ioutil"
 	"log"
+	"os"
+	"os/signal"
 	"time"
 )
 
@@ -29,8 +32,16 @@ var (
 	tmpFirmwarePathRaw  = ""
 	tmpFirmwarePathHex  = ""
 	tmpSignaturePathRaw = ""
+	tmpFirmwareURL      = ""
+	tmpForce            = false // enables all of the following overrides
+	tmpForceUpdateCheck = false
+	tmpForceMismatch    = false
+	tmpForceDowngrade   = false
 )
 
+// flashAttempts bounds how often flashing is tried, if the receiver is lost during flashing
+const flashAttempts = 3
+
 func FlashFirmwareFromHexFile(fw_hex_file string, fw_sig_file string) {
 	fw, err := unifying.ParseFirmwareHex(fw_hex_file)
 	if err == nil {
@@ -51,7 +62,10 @@ func FlashFirmwareFromHexFile(fw_hex_file string, fw_sig_file string) {
 				fmt.Println("WARNING: The firmware file already has a signature included, but the provided signature")
 				fmt.Println("file will be used instead.")
 			}
-			fw.AddSignature(fw_sig_bytes)
+			if err := fw.AddSignature(fw_sig_bytes); err != nil {
+				fmt.Printf("error adding firmware signature, %v\n", err)
+				fmt.Println("...continue without signature")
+			}
 		}
 	}
 
@@ -82,7 +96,36 @@ func FlashFirmwareFromRawFiles(fw_file string, fw_sig_file string) {
 			fmt.Printf("error reading firmware signature file, %v\n", err)
 			fmt.Println("...continue without signature")
 		} else {
-			firmware.AddSignature(fw_sig_bytes)
+			if err := firmware.AddSignature(fw_sig_bytes); err != nil {
+				fmt.Printf("error adding firmware signature, %v\n", err)
+				fmt.Println("...continue without signature")
+			}
+		}
+	}
+
+	if err := FlashFirmware(firmware); err != nil {
+		fmt.Println("Error", err)
+	}
+}
+
+func FlashFirmwareFromURL(fw_url string, fw_sig_file string) {
+	firmware, err := unifying.ParseFirmwareFromURL(fw_url)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// add signature data
+	if len(fw_sig_file) > 0 {
+		fw_sig_bytes, err := ioutil.ReadFile(fw_sig_file)
+		if err != nil {
+			fmt.Printf("error reading firmware signature file, %v\n", err)
+			fmt.Println("...continue without signature")
+		} else {
+			if err := firmware.AddSignature(fw_sig_bytes); err != nil {
+				fmt.Printf("error adding firmware signature, %v\n", err)
+				fmt.Println("...continue without signature")
+			}
 		}
 	}
 
@@ -105,8 +148,10 @@ func FlashFirmware(firmware *unifying.Firmware) (err error) {
 	*/
 
 	// Access receiver to obtain info on running firmware and reset to bootloader mode
-	usbReceiver, err := unifying.NewLocalUSBDongle()
-	if err != nil {
+	usbReceiver, err := openDongle()
+	if err == unifying.ErrReceiverInBootloaderMode {
+		fmt.Println("Receiver already runs in bootloader mode, skipping the firmware update support check")
+	} else if err != nil {
 		fmt.Println(err)
 	} else {
 		defer usbReceiver.Close()
@@ -128,6 +173,32 @@ func FlashFirmware(firmware *unifying.Firmware) (err error) {
 
 		usbReceiver.GetReceiverFirmwareBuildVersion()
 
+		// same probe as for DongleInfo.SupportsFwUpdate
+		updatable, errUpdatable := usbReceiver.SupportsFirmwareUpdate()
+		if errUpdatable != nil || !updatable {
+			reason := "receiver doesn't support firmware updates (no firmware update register)"
+			if errUpdatable != nil {
+				reason = fmt.Sprintf("can not check if receiver supports firmware updates (%v)", errUpdatable)
+			}
+			if !tmpForce && !tmpForceUpdateCheck {
+				return errors.New(fmt.Sprintf("%s, use --force-update-check to try anyway", reason))
+			}
+			fmt.Printf("WARNING: %s, trying anyway (forced)\n", reason)
+		}
+
+		compatible, reason, errCompat := usbReceiver.IsCompatibleWith(firmware)
+		if errCompat != nil {
+			return errors.New(fmt.Sprintf("can not check if firmware matches receiver: %v", errCompat))
+		}
+		if !compatible {
+			if !tmpForce && !tmpForceMismatch {
+				return errors.New(fmt.Sprintf("firmware doesn't match receiver (%s), use --force-mismatch to flash anyway", reason))
+			}
+			fmt.Printf("WARNING: firmware doesn't match receiver (%s), flashing anyway (forced)\n", reason)
+		} else if reason != "" {
+			fmt.Printf("WARNING: %s\n", reason)
+		}
+
 		fmt.Println("Try to reset dongle into bootloader mode ...")
 		usbReceiver.SwitchToBootloader()
 
@@ -144,8 +215,32 @@ func FlashFirmware(firmware *unifying.Firmware) (err error) {
 		defer usbReceiverBL.Close()
 	}
 	usbReceiverBL.SetShowInOut(false)
+	usbReceiverBL.SetForceDowngrade(tmpForce || tmpForceDowngrade)
 
-	err = usbReceiverBL.FlashReceiver(firmware)
+	// abort flashing between chunks on Ctrl-C, instead of killing the process in the middle of a write
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	// the receiver occasionally drops off the bus while flashing (re-enumeration), in this case it is re-opened and
+	// flashing resumes behind the last page written successfully
+	lastPercent := -1
+	progress := func(written int, total int) {
+		if percent := written * 100 / total; percent/10 != lastPercent/10 {
+			lastPercent = percent
+			fmt.Printf("Written %#x of %#x bytes (%d%%)\n", written, total, percent)
+		}
+	}
+	written := 0
+	for attempt := 1; ; attempt++ {
+		written, err = usbReceiverBL.FlashFirmwareResume(ctx, firmware, written, progress)
+		if err == nil || attempt >= flashAttempts || ctx.Err() != nil || !unifying.IsRecoverableUSBError(err) {
+			break
+		}
+		fmt.Printf("Flashing interrupted at offset %#x (%v), re-opening receiver (attempt %d of %d) ...\n", written, err, attempt+1, flashAttempts)
+		time.Sleep(time.Second)
+		if eReopen := usbReceiverBL.Reopen(); eReopen != nil {
+			return errors.New(fmt.Sprintf("can not re-open receiver in bootloader mode: %v", eReopen))
+		}
+	}
 	if err != nil {
 		return err
 	} else {
@@ -167,11 +262,15 @@ var flashCmd = &cobra.Command{
 		} else if len(tmpFirmwarePathRaw) > 0 {
 			fmt.Printf("Trying to flash raw file '%s'\n", tmpFirmwarePathRaw)
 			FlashFirmwareFromRawFiles(tmpFirmwarePathRaw, tmpSignaturePathRaw)
+		} else if len(tmpFirmwareURL) > 0 {
+			fmt.Printf("Trying to flash firmware from '%s'\n", tmpFirmwareURL)
+			FlashFirmwareFromURL(tmpFirmwareURL, tmpSignaturePathRaw)
 		} else {
 			fmt.Println("Error: no firmware file given for flashing")
 			fmt.Println()
 			fmt.Println("A firmware file could either be provided as hex/shex file with the `-f` flag")
-			fmt.Println("or as raw binary using the `-r` flag")
+			fmt.Println("or as raw binary using the `-r` flag. With `--url` the firmware is downloaded")
+			fmt.Println("instead (URLs ending in .hex/.shex are treated as hex file, others as raw binary).")
 			fmt.Println()
 			fmt.Println("If the receiver uses a secure bootloader, the firmwyare has to be signed.")
 			fmt.Println("For `shex` firmware files the signature should already be included (in contrast")
@@ -191,5 +290,10 @@ func init() {
 	// -h --hex, -r --raw, -s --sig
 	flashCmd.Flags().StringVarP(&tmpFirmwarePathHex, "hexfile", "f", "", "path to firmware file in Logitech hex/shex format")
 	flashCmd.Flags().StringVarP(&tmpFirmwarePathRaw, "rawfile", "r", "", "path to firmware file in raw binary format")
+	flashCmd.Flags().StringVar(&tmpFirmwareURL, "url", "", "download the firmware from this http(s) URL (hex/shex if the path ends with .hex/.shex, raw binary otherwise)")
 	flashCmd.Flags().StringVarP(&tmpSignaturePathRaw, "sigfile", "s", "", "path to firmware signature file, if not included in firmware file")
+	flashCmd.Flags().BoolVar(&tmpForceUpdateCheck, "force-update-check", false, "flash even if the receiver lacks the firmware update register, or probing it fails")
+	flashCmd.Flags().BoolVar(&tmpForceMismatch, "force-mismatch", false, "flash firmware not matching the receiver (MCU, family or bootloader VID)")
+	flashCmd.Flags().BoolVar(&tmpForceDowngrade, "force-downgrade", false, "downgrade even for receiver families with unvalidated patch set (R500, SPOTLIGHT)")
+	flashCmd.Flags().BoolVar(&tmpForce, "force", false, "enable all overrides: --force-update-check, --force-mismatch and --force-downgrade")
 }
@@ -0,0 +1,56 @@
+// Copyright © 2019 Marcus Mengs
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	OUTPUT_FORMAT_TEXT = "text"
+	OUTPUT_FORMAT_JSON = "json"
+)
+
+var tmpOutputFormat = OUTPUT_FORMAT_TEXT
+
+// checkOutputFormat validates the global --format flag
+func checkOutputFormat() error {
+	switch tmpOutputFormat {
+	case OUTPUT_FORMAT_TEXT, OUTPUT_FORMAT_JSON:
+		return nil
+	case "yaml":
+		return errors.New("output format 'yaml' isn't supported, yet (use 'text' or 'json')")
+	}
+	return errors.New(fmt.Sprintf("unknown output format '%s' (use 'text' or 'json')", tmpOutputFormat))
+}
+
+// printOutput prints the result of a command in the format selected with --format. For 'text', text is printed as is
+// (usually the String() representation of v), otherwise v is marshaled.
+func printOutput(v interface{}, text string) error {
+	switch tmpOutputFormat {
+	case OUTPUT_FORMAT_JSON:
+		j, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(j))
+	default:
+		fmt.Print(text)
+	}
+	return nil
+}
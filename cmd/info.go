@@ -18,12 +18,19 @@ package cmd
 import (
 	"fmt"
 	"github.com/mame82/munifying/unifying"
-
 	"github.com/spf13/cobra"
 )
 
+var tmpInfoJSON bool
+
 func ListDongleInfo() {
-	usb, err := unifying.NewLocalUSBDongle()
+	usb, err := openDongle()
+	if err == unifying.ErrReceiverInBootloaderMode {
+		// no runtime info available, at least show what the bootloader reports
+		fmt.Println("Receiver runs in bootloader mode, reading bootloader info ...")
+		ListBootloaderInfo()
+		return
+	}
 	if err != nil {
 		fmt.Printf("ERROR: %v\n", err)
 		return
@@ -34,7 +41,36 @@ func ListDongleInfo() {
 	usb.SetShowInOut(false)
 	set,err := usb.GetSetInfo()
 	if err == nil {
-		fmt.Println(set.String())
+		if tmpInfoJSON {
+			tmpOutputFormat = OUTPUT_FORMAT_JSON
+		}
+		if eOut := printOutput(set, set.String()+"\n"); eOut != nil {
+			fmt.Printf("ERROR: %v\n", eOut)
+		}
+	}
+}
+
+
+// ListBootloaderInfo prints version and memory layout of the first receiver in bootloader mode
+func ListBootloaderInfo() {
+	usbBL, err := unifying.NewUSBBootloaderDongle()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	defer usbBL.Close()
+
+	usbBL.SetShowInOut(false)
+	blInfo, err := usbBL.GetBootloaderInfo()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	if tmpInfoJSON {
+		tmpOutputFormat = OUTPUT_FORMAT_JSON
+	}
+	if eOut := printOutput(blInfo, blInfo.String()); eOut != nil {
+		fmt.Printf("ERROR: %v\n", eOut)
 	}
 }
 
@@ -51,5 +87,6 @@ var infoCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(infoCmd)
+	infoCmd.Flags().BoolVar(&tmpInfoJSON, "json", false, "print info as JSON (same as --format json)")
 
 }
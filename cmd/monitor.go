@@ -0,0 +1,115 @@
+// Copyright © 2019 Marcus Mengs
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/mame82/munifying/unifying"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"time"
+)
+
+var tmpMonitorRaw bool
+var tmpMonitorLinkStatus time.Duration
+
+// Monitor prints the notifications of the receiver and its paired devices. The link status of the connected devices
+// is only queried if linkStatusInterval is > 0, as notifications arriving during a query are consumed by its requests
+// (see LocalUSBDongle.Notifications).
+func Monitor(raw bool, linkStatusInterval time.Duration) {
+	usb, err := openDongle()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	defer usb.Close()
+	usb.SetShowInOut(false)
+
+	err = usb.EnableNotifications()
+	if err != nil {
+		fmt.Printf("ERROR: couldn't enable notifications: %v\n", err)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var linkStatusTick <-chan time.Time
+	if linkStatusInterval > 0 {
+		ticker := time.NewTicker(linkStatusInterval)
+		defer ticker.Stop()
+		linkStatusTick = ticker.C
+	}
+	linked := make(map[byte]bool) // link state of the devices, as reported by the last connection notification
+
+	fmt.Println("Monitoring notifications, press Ctrl-C to stop ...")
+	notifications := usb.Notifications(ctx)
+	for done := false; !done; {
+		select {
+		case r, ok := <-notifications:
+			if !ok {
+				done = true
+				break
+			}
+			ts := time.Now().Format("15:04:05.000")
+			dc, isConnection := unifying.DeviceConnection{}, false
+			if r.IsHIDPP() {
+				if parsed, eDc := unifying.ParseDeviceConnection(r.(*unifying.HidPPMsg)); eDc == nil {
+					dc, isConnection = parsed, true
+					linked[dc.DeviceIndex] = dc.Link
+				}
+			}
+			switch {
+			case raw:
+				wire, _ := r.ToWire()
+				fmt.Printf("%s % 02x\n", ts, wire)
+			case isConnection:
+				fmt.Printf("%s %s\n", ts, dc.String())
+			default:
+				fmt.Printf("%s %s\n", ts, r.String())
+			}
+		case <-linkStatusTick:
+			for index := byte(1); index <= 6; index++ {
+				if !linked[index] {
+					continue
+				}
+				if ls, eLs := usb.GetLinkQuality(index); eLs == nil {
+					fmt.Printf("%s LINK STATUS: %s\n", time.Now().Format("15:04:05.000"), ls.String())
+				}
+			}
+		}
+	}
+	if dropped := usb.DroppedNotifications(); dropped > 0 {
+		fmt.Printf("%d notifications dropped, because output didn't keep up\n", dropped)
+	}
+}
+
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Print notifications of first receiver found on USB and its paired devices, till Ctrl-C",
+	Long:  "",
+	Run: func(cmd *cobra.Command, args []string) {
+		Monitor(tmpMonitorRaw, tmpMonitorLinkStatus)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(monitorCmd)
+	monitorCmd.Flags().BoolVar(&tmpMonitorRaw, "raw", false, "print raw reports as hex")
+	monitorCmd.Flags().DurationVar(&tmpMonitorLinkStatus, "link-status", 0, "query the link status of connected devices in this interval (f.e. 10s), notifications arriving meanwhile are missed")
+}
@@ -29,7 +29,7 @@ var pairCmd = &cobra.Command{
 	Short: "Pair new devices to first receiver found on USB",
 	Long: "",
 	Run: func(cmd *cobra.Command, args []string) {
-		usb, err := unifying.NewLocalUSBDongle()
+		usb, err := openDongle()
 		if err != nil {
 			panic(err)
 		}
@@ -40,6 +40,15 @@ var pairCmd = &cobra.Command{
 		//Pair new device
 		deviceNumber := byte(0x01) //According to specs: Same value as device index transmitted in 0x41 notification, but we haven't tx'ed anything
 		openLockTimeout := byte(60)
+		// remember the pairing lock state, to restore it once pairing is done
+		wasLocked, errLock := usb.GetPairingLock()
+		if errLock == nil {
+			defer func() {
+				if locked, eLock := usb.GetPairingLock(); eLock == nil && locked != wasLocked {
+					usb.SetPairingLock(wasLocked)
+				}
+			}()
+		}
 		err = usb.EnablePairing(openLockTimeout, deviceNumber,false)
 		if err != nil {
 			fmt.Println(err)
@@ -54,7 +63,8 @@ var pairCmd = &cobra.Command{
 			signal.Notify(signalChan, os.Interrupt)
 			go func() {
 				<-signalChan
-				fmt.Println("\nReceived an interrupt, exit pairing mode...\n")
+				fmt.Println("\nReceived an interrupt, exit pairing mode...")
+				fmt.Println()
 
 				usb.DisablePairing()
 				close(cleanupDone)
@@ -98,17 +108,9 @@ var pairCmd = &cobra.Command{
 
 					// device connection
 					if hidppRsp.MsgSubID == unifying.HIDPP_MSG_ID_DEVICE_CONNECTION {
-						devIdx := hidppRsp.DeviceID
-						wpid := uint16(hidppRsp.Parameters[3])<<8 + uint16(hidppRsp.Parameters[2])
-						encrypted := false
-						if (hidppRsp.Parameters[1] & (1 << 5)) > 0 {
-							encrypted = true
-						}
-						link := true
-						if (hidppRsp.Parameters[1] & (1 << 6)) > 0 {
-							link = false
+						if dc, eDc := unifying.ParseDeviceConnection(hidppRsp); eDc == nil {
+							fmt.Println(dc.String())
 						}
-						fmt.Printf("DEVICE CONNECTION ON INDEX: %02x TYPE: %s WPID: %#04x ENCRYPTED: %v CONNECTED: %v\n", devIdx, unifying.DeviceType(hidppRsp.Parameters[1]&0x0F), wpid, encrypted, link)
 
 						//request additional information
 					}
@@ -23,7 +23,7 @@ import (
 )
 
 func PatchdumpDongle() {
-	usb, eDongle := unifying.NewLocalUSBDongle()
+	usb, eDongle := openDongle()
 	if eDongle != nil {
 		panic(eDongle)
 	}
@@ -0,0 +1,72 @@
+// Copyright © 2019 Marcus Mengs
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mame82/munifying/unifying"
+	"github.com/spf13/cobra"
+	"strconv"
+)
+
+var tmpResetConfirm bool
+
+func ResetPairedDevice(index byte) {
+	usb, err := openDongle()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	defer usb.Close()
+
+	usb.SetShowInOut(false)
+	if err := usb.ResetDeviceSettings(index); err != nil {
+		if errors.Is(err, unifying.ErrFeatureUnsupported) {
+			fmt.Println("ERROR: device does not support restoring factory settings (HID++ 2.0 feature 0x1805)")
+			return
+		}
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+	fmt.Printf("Device %d restored its factory settings and reconnects\n", index)
+}
+
+var resetCmd = &cobra.Command{
+	Use:   "reset <index>",
+	Short: "Restore the factory settings of a HID++ 2.0 device paired to first receiver found on USB",
+	Long: `Restore the factory settings (out-of-box state) of a HID++ 2.0 device. All
+settings stored on the device (f.e. button assignments, DPI) are lost, the
+device stays paired. As this can't be undone, --yes has to be given.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		index, err := strconv.ParseUint(args[0], 0, 8)
+		if err != nil || index < 1 || index > 6 {
+			fmt.Println("ERROR: device index has to be between 1 and 6")
+			return
+		}
+		if !tmpResetConfirm {
+			fmt.Printf("ERROR: resetting device %d loses all its settings, confirm with --yes\n", index)
+			return
+		}
+		ResetPairedDevice(byte(index))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resetCmd)
+	resetCmd.Flags().BoolVar(&tmpResetConfirm, "yes", false, "confirm restoring the factory settings")
+}
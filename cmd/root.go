@@ -18,12 +18,31 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/mame82/munifying/unifying"
 	"github.com/spf13/cobra"
 )
 
 var cfgFile string
 
+var (
+	tmpDongleSerial = ""
+	tmpDonglePath   = ""
+	tmpTimeout      = 2 * time.Second
+)
+
+// openDongle opens the receiver selected with the global --serial/--device-path flags, or the first receiver found
+// on USB if none is given. The response timeout is set from the global --timeout flag.
+func openDongle() (*unifying.LocalUSBDongle, error) {
+	usb, err := unifying.OpenLocalUSBDongle(tmpDongleSerial, tmpDonglePath)
+	if err != nil {
+		return nil, err
+	}
+	usb.SetTimeout(tmpTimeout)
+	return usb, nil
+}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "munifying",
@@ -33,6 +52,19 @@ Proof-of-Concepts for vulnerabilities of Logitech wireless
 peripherals. It is focused on USB interaction with Unifying 
 receivers. Interaction with the radio end of respective 
 receivers should be done with 'mjackit', not 'munifying'.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkOutputFormat(); err != nil {
+			return err
+		}
+		// the unifying package is silent by default, the CLI shows its progress output (on stderr for JSON output,
+		// which has to be the only content of stdout)
+		if tmpOutputFormat == OUTPUT_FORMAT_JSON {
+			unifying.SetLogger(unifying.StderrLogger)
+		} else {
+			unifying.SetLogger(unifying.StdoutLogger)
+		}
+		return nil
+	},
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
@@ -48,6 +80,10 @@ func Execute() {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&tmpDongleSerial, "serial", "", "use the receiver with this USB serial number, instead of the first one found")
+	rootCmd.PersistentFlags().StringVar(&tmpDonglePath, "device-path", "", "use the receiver at this USB 'bus:address' (as shown by lsusb), instead of the first one found")
+	rootCmd.PersistentFlags().DurationVar(&tmpTimeout, "timeout", tmpTimeout, "time to wait for responses of the receiver and paired devices (f.e. 500ms, 5s)")
+	rootCmd.PersistentFlags().StringVar(&tmpOutputFormat, "format", OUTPUT_FORMAT_TEXT, "output format of command results: text or json")
 	//rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.munifying.yaml)")
 	//rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
@@ -17,13 +17,12 @@ package cmd
 
 import (
 	"fmt"
-	"github.com/mame82/munifying/unifying"
 
 	"github.com/spf13/cobra"
 )
 
 func StoreDongleInfo() {
-	usb, err := unifying.NewLocalUSBDongle()
+	usb, err := openDongle()
 	if err != nil {
 		panic(err)
 	}
@@ -75,7 +75,7 @@ var unpairCmd = &cobra.Command{
 	Short: "Unpair devices of first receiver found on USB",
 	Long: "",
 	Run: func(cmd *cobra.Command, args []string) {
-		usb, err := unifying.NewLocalUSBDongle()
+		usb, err := openDongle()
 		if err != nil {
 			panic(err)
 		}
@@ -17,7 +17,6 @@ package cmd
 
 import (
 	"fmt"
-	"github.com/mame82/munifying/unifying"
 	"github.com/spf13/cobra"
 	"log"
 )
@@ -27,7 +26,7 @@ var unpairAllCmd = &cobra.Command{
 	Short: "Unpair all paired devices of first receiver found on USB",
 	Long:  "",
 	Run: func(cmd *cobra.Command, args []string) {
-		usb, err := unifying.NewLocalUSBDongle()
+		usb, err := openDongle()
 		if err != nil {
 			panic(err)
 		}
@@ -0,0 +1,121 @@
+// Copyright © 2019 Marcus Mengs
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mame82/munifying/unifying"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// firmwareSummary holds the properties of a verified firmware file
+type firmwareSummary struct {
+	File       string `json:"file"`
+	Target     string `json:"target,omitempty"`
+	Version    string `json:"version"`
+	BuildDate  string `json:"build_date,omitempty"`
+	Family     string `json:"family,omitempty"`
+	Bootloader bool   `json:"bootloader"`
+	CRC        uint16 `json:"crc"`
+	Signature  bool   `json:"signature"`
+}
+
+func (s firmwareSummary) String() (res string) {
+	if s.Target != "" {
+		res += fmt.Sprintf("Target:     %s\n", s.Target)
+	}
+	res += fmt.Sprintf("Version:    %s\n", s.Version)
+	if s.BuildDate != "" {
+		res += fmt.Sprintf("Build date: %s\n", s.BuildDate)
+	}
+	if s.Family != "" {
+		res += fmt.Sprintf("Family:     %s\n", s.Family)
+	}
+	res += fmt.Sprintf("Bootloader: %v\n", s.Bootloader)
+	res += fmt.Sprintf("CRC:        %#04x (valid)\n", s.CRC)
+	if s.Signature {
+		res += fmt.Sprintln("Signature:  present (not verified)")
+	} else {
+		res += fmt.Sprintln("Signature:  none")
+	}
+	return
+}
+
+// VerifyFirmwareFile parses the given firmware file (Intel hex for .hex/.shex, raw blob otherwise) and returns an
+// error, if the file doesn't hold a valid firmware. Hex files are parsed strictly, invalid records and records
+// overwriting each other fail the check.
+func VerifyFirmwareFile(path string) (err error) {
+	var fw *unifying.Firmware
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hex", ".shex":
+		fw, err = unifying.ParseFirmwareHexWithOptions(path, unifying.HexParseOptions{AbortOnInvalidLine: true, RejectOverlaps: true})
+	default:
+		var blob []byte
+		if blob, err = ioutil.ReadFile(path); err == nil {
+			fw, err = unifying.ParseFirmwareBin(blob)
+		}
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("verification of '%s' failed: %v", path, err))
+	}
+
+	res := firmwareSummary{
+		File:       path,
+		Version:    "unknown",
+		Bootloader: fw.HasBL,
+		CRC:        fw.CRC,
+		Signature:  fw.HasSignature,
+	}
+	if fw.TargetType != unifying.FIRMWARE_TARGET_TYPE_UNKNOWN {
+		res.Target = fw.TargetType.String()
+	}
+	if bi, errBI := fw.BuildInfo(); errBI == nil && bi.HasVersion {
+		res.Version = bi.Version.String()
+		if bi.HasDate {
+			res.BuildDate = bi.Date
+		}
+	}
+	if family, errF := fw.Family(); errF == nil {
+		res.Family = family.String()
+	}
+	return printOutput(res, "\n"+res.String())
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify <file.hex|file.shex|file.bin>",
+	Short: "Check CRC and structure of a firmware file (no receiver needed)",
+	Long: `Check CRC and structure of a firmware file (no receiver needed).
+
+Files with extension .hex or .shex are parsed as Intel hex, all other files as raw firmware blob. The command
+exits with a non-zero status, if the file doesn't hold a valid firmware.
+
+Signatures of .shex files are only reported, not validated, as the signature scheme used by the bootloader
+isn't known.`,
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return VerifyFirmwareFile(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
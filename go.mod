@@ -5,6 +5,5 @@ require (
 	github.com/google/gousb v0.0.0-20181222214327-04360a545728
 	github.com/sigurn/crc16 v0.0.0-20160107003519-da416fad5162
 	github.com/sigurn/utils v0.0.0-20151230205143-f19e41f79f8f // indirect
-	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/cobra v0.0.5
 )
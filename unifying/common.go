@@ -40,6 +40,65 @@ func (fm FirmwareMajor) String() string {
 
 }
 
+// TargetType returns the MCU the firmware major version is built for, FIRMWARE_TARGET_TYPE_UNKNOWN for unknown ones
+func (fm FirmwareMajor) TargetType() FirmwareTargetType {
+	switch fm {
+	case FIRMWARE_MAJOR_UNIFYING_NORDIC, FIRMWARE_MAJOR_G700_NORDIC:
+		return FIRMWARE_TARGET_TYPE_NORDIC
+	case FIRMWARE_MAJOR_UNIFYING_TI, FIRMWARE_MAJOR_LIGHTSPEED_TI, FIRMWARE_MAJOR_SPOTLIGHT_CLICKER_TI, FIRMWARE_MAJOR_R500_CLICKER_TI:
+		return FIRMWARE_TARGET_TYPE_TI
+	default:
+		return FIRMWARE_TARGET_TYPE_UNKNOWN
+	}
+}
+
+// ReceiverFamily is the receiver product family a firmware belongs to, independent of the MCU it targets
+type ReceiverFamily byte
+
+const (
+	FAMILY_UNKNOWN    ReceiverFamily = 0x00
+	FAMILY_UNIFYING   ReceiverFamily = 0x01
+	FAMILY_G700       ReceiverFamily = 0x02
+	FAMILY_LIGHTSPEED ReceiverFamily = 0x03
+	FAMILY_SPOTLIGHT  ReceiverFamily = 0x04
+	FAMILY_R500       ReceiverFamily = 0x05
+)
+
+func (rf ReceiverFamily) String() string {
+	switch rf {
+	case FAMILY_UNIFYING:
+		return "Unifying"
+	case FAMILY_G700:
+		return "G700/G700s"
+	case FAMILY_LIGHTSPEED:
+		return "Lightspeed"
+	case FAMILY_SPOTLIGHT:
+		return "SPOTLIGHT Presentation Clicker"
+	case FAMILY_R500:
+		return "R500 Presentation Clicker"
+	default:
+		return "Unknown"
+	}
+}
+
+// Family returns the receiver family of the firmware major version, FAMILY_UNKNOWN for unknown ones
+func (fm FirmwareMajor) Family() ReceiverFamily {
+	switch fm {
+	case FIRMWARE_MAJOR_UNIFYING_NORDIC, FIRMWARE_MAJOR_UNIFYING_TI:
+		return FAMILY_UNIFYING
+	case FIRMWARE_MAJOR_G700_NORDIC:
+		return FAMILY_G700
+	case FIRMWARE_MAJOR_LIGHTSPEED_TI:
+		return FAMILY_LIGHTSPEED
+	case FIRMWARE_MAJOR_SPOTLIGHT_CLICKER_TI:
+		return FAMILY_SPOTLIGHT
+	case FIRMWARE_MAJOR_R500_CLICKER_TI:
+		return FAMILY_R500
+	default:
+		return FAMILY_UNKNOWN
+	}
+}
+
 type DeviceType byte
 
 const (
@@ -81,10 +140,48 @@ func (t DeviceType) String() string {
 	case DEVICE_TYPE_UNKNOWN:
 		return "UNKNOWN"
 	default:
-		return fmt.Sprintf("UNDEFINED DEVICE TYPE %02x", t)
+		return fmt.Sprintf("UNDEFINED DEVICE TYPE %02x", byte(t))
 	}
 }
 
+// DeviceModel describes a Logitech wireless device model
+type DeviceModel struct {
+	Name string
+	Type DeviceType
+}
+
+// KnownWPIDs maps wireless product IDs (as reported in device connection notifications) to device models. Entries
+// could be added for devices missing here.
+var KnownWPIDs = map[uint16]DeviceModel{
+	0x101b: {"M705 Marathon", DEVICE_TYPE_MOUSE},
+	0x1025: {"M510", DEVICE_TYPE_MOUSE},
+	0x1028: {"M570", DEVICE_TYPE_TRACKBALL},
+	0x2010: {"K800 Illuminated", DEVICE_TYPE_KEYBOARD},
+	0x4002: {"K750 Solar", DEVICE_TYPE_KEYBOARD},
+	0x4003: {"K270", DEVICE_TYPE_KEYBOARD},
+	0x4004: {"K360", DEVICE_TYPE_KEYBOARD},
+	0x4024: {"K400", DEVICE_TYPE_KEYBOARD},
+	0x4041: {"MX Master", DEVICE_TYPE_MOUSE},
+	0x404a: {"MX Anywhere 2", DEVICE_TYPE_MOUSE},
+	0x404d: {"K400 Plus", DEVICE_TYPE_KEYBOARD},
+	0x4066: {"Craft", DEVICE_TYPE_KEYBOARD},
+	0x4069: {"MX Master 2S", DEVICE_TYPE_MOUSE},
+	0x406a: {"MX Anywhere 2S", DEVICE_TYPE_MOUSE},
+	0x406f: {"MX Ergo", DEVICE_TYPE_TRACKBALL},
+	0x4082: {"MX Master 3", DEVICE_TYPE_MOUSE},
+	0x408a: {"MX Keys", DEVICE_TYPE_KEYBOARD},
+	0x4101: {"T650", DEVICE_TYPE_TOUCHPAD},
+}
+
+// DeviceModelFromWPID looks up the model name and device type for the given wireless product ID in KnownWPIDs
+func DeviceModelFromWPID(wpid uint16) (name string, kind DeviceType, known bool) {
+	model, known := KnownWPIDs[wpid]
+	if !known {
+		return "", DEVICE_TYPE_UNKNOWN, false
+	}
+	return model.Name, model.Type, true
+}
+
 type UsabilityInfo byte
 
 const (
@@ -216,32 +313,215 @@ func (rt *ReportTypes) FromSlice(sl []byte) (err error) {
 	return nil
 }
 
+// ReceiverGeneration distinguishes receivers by the layout of their pairing information
+type ReceiverGeneration byte
+
+const (
+	RECEIVER_GENERATION_UNIFYING ReceiverGeneration = iota // Unifying layout, also used by nano, Lightspeed and presenter receivers
+	RECEIVER_GENERATION_BOLT
+)
+
+func (g ReceiverGeneration) String() string {
+	switch g {
+	case RECEIVER_GENERATION_UNIFYING:
+		return "Unifying"
+	case RECEIVER_GENERATION_BOLT:
+		return "Bolt"
+	default:
+		return fmt.Sprintf("unknown receiver generation %d", byte(g))
+	}
+}
+
+// ErrBoltReceiver is returned by methods decoding pairing information records, if the receiver is a Bolt receiver.
+// Decoding its record layout isn't supported, so no Unifying decoding is attempted.
+var ErrBoltReceiver = errors.New("pairing information of Bolt receivers isn't supported (different record layout)")
+
 type DongleInfo struct {
+	Generation          ReceiverGeneration
 	NumConnectedDevices byte
 	WPID                []byte
-	FwMajor             byte
+	FwMajor             byte // firmware version stored in the device data flash page, see RunningFirmware
 	FwMinor             byte
 	FwBuild             uint16
 	LikelyProto         byte
 	BootloaderMajor     byte
 	BootloaderMinor     byte
+	MaxDevices          byte // number of device slots, 0 if unknown
+
+	RunningFirmware    FirmwareVersionInfo // version reported by the running firmware (could differ after a failed update)
+	HasRunningFirmware bool
+	EntityVersions     []EntityVersion // versions of the firmware entities reported by the running firmware
 
 	Serial []byte
+
+	SupportsPairing  bool // receiver has device slots (pairing table) reported
+	SupportsFwUpdate bool // receiver implements the firmware update register (see SupportsFirmwareUpdate)
+}
+
+// FirmwareVersionInfo is the version of a receiver firmware
+type FirmwareVersionInfo struct {
+	Major FirmwareMajor
+	Minor byte
+	Build uint16
+}
+
+func (v FirmwareVersionInfo) String() string {
+	return fmt.Sprintf("RQR%02x.%02x.B%04x", byte(v.Major), v.Minor, v.Build)
+}
+
+// EntityType is the kind of a firmware entity, the values follow the firmware types of the HID++ 2.0 device
+// information feature (0x0003)
+type EntityType byte
+
+const (
+	ENTITY_TYPE_MAIN_APPLICATION EntityType = 0x00
+	ENTITY_TYPE_BOOTLOADER       EntityType = 0x01
+	ENTITY_TYPE_HARDWARE         EntityType = 0x02
+	ENTITY_TYPE_SOFTDEVICE       EntityType = 0x05
+	ENTITY_TYPE_OTHER            EntityType = 0xff
+)
+
+func (t EntityType) String() string {
+	switch t {
+	case ENTITY_TYPE_MAIN_APPLICATION:
+		return "firmware"
+	case ENTITY_TYPE_BOOTLOADER:
+		return "bootloader"
+	case ENTITY_TYPE_HARDWARE:
+		return "hardware"
+	case ENTITY_TYPE_SOFTDEVICE:
+		return "softdevice"
+	case ENTITY_TYPE_OTHER:
+		return "other"
+	default:
+		return fmt.Sprintf("unknown entity type %#02x", byte(t))
+	}
+}
+
+// EntityVersion is the version of a firmware entity, as reported by the running receiver firmware
+type EntityVersion struct {
+	Type     EntityType
+	Name     string // version prefix (f.e. RQR for the receiver firmware), empty if unknown
+	Major    byte
+	Minor    byte
+	Build    uint16
+	HasBuild bool // false for entities only reporting major.minor
+}
+
+func (e EntityVersion) Version() string {
+	if e.HasBuild {
+		return fmt.Sprintf("%02x.%02x.B%04x", e.Major, e.Minor, e.Build)
+	}
+	return fmt.Sprintf("%02x.%02x", e.Major, e.Minor)
+}
+
+func (e EntityVersion) String() string {
+	return fmt.Sprintf("%s %s%s", e.Type, e.Name, e.Version())
+}
+
+// ValidDeviceIndex reports if the given (zero based) device index addresses a device slot of the receiver. If the
+// slot count is unknown, the maximum of 6 slots (Unifying) is assumed.
+func (di *DongleInfo) ValidDeviceIndex(deviceIndex byte) bool {
+	maxDevices := di.MaxDevices
+	if maxDevices == 0 {
+		maxDevices = 6
+	}
+	return deviceIndex < maxDevices
 }
 
 func (di *DongleInfo) String() string {
 	res := fmt.Sprintf("Dongle Info\n")
 	res += fmt.Sprintf("-------------------------------------\n")
+	if di.Generation != RECEIVER_GENERATION_UNIFYING {
+		res += fmt.Sprintf("\tReceiver generation:         %s\n", di.Generation)
+	}
 	res += fmt.Sprintf("\tFirmware (maj.minor.build):  RQR%02x.%02x.B%04x\n", di.FwMajor, di.FwMinor, di.FwBuild)
+	if di.HasRunningFirmware {
+		stored := FirmwareVersionInfo{Major: FirmwareMajor(di.FwMajor), Minor: di.FwMinor, Build: di.FwBuild}
+		if di.RunningFirmware == stored {
+			res += fmt.Sprintf("\tRunning firmware:            %s (matches stored version)\n", di.RunningFirmware)
+		} else {
+			res += fmt.Sprintf("\tRunning firmware:            %s (DIFFERS from stored version, incomplete update?)\n", di.RunningFirmware)
+		}
+	}
 	res += fmt.Sprintf("\tBootloader (maj.minor):      %02x.%02x\n", di.BootloaderMajor, di.BootloaderMinor)
 	res += fmt.Sprintf("\tWPID:                        %02x%02x\n", di.WPID[0], di.WPID[1])
 	res += fmt.Sprintf("\t(likely) protocol:           %#02x\n", di.LikelyProto)
 	res += fmt.Sprintf("\tSerial:                      %02x:%02x:%02x:%02x\n", di.Serial[0], di.Serial[1], di.Serial[2], di.Serial[3])
-	res += fmt.Sprintf("\tConnected devices:           %d\n", di.NumConnectedDevices)
+	if di.MaxDevices > 0 {
+		res += fmt.Sprintf("\tConnected devices:           %d of %d slots used\n", di.NumConnectedDevices, di.MaxDevices)
+	} else {
+		res += fmt.Sprintf("\tConnected devices:           %d\n", di.NumConnectedDevices)
+	}
+	res += fmt.Sprintf("\tSupports pairing:            %v\n", di.SupportsPairing)
+	res += fmt.Sprintf("\tSupports firmware update:    %v\n", di.SupportsFwUpdate)
+	if len(di.EntityVersions) > 0 {
+		res += fmt.Sprintf("\tFirmware entities:\n")
+		res += fmt.Sprintf("\t\t%-12s %-6s %s\n", "Type", "Name", "Version")
+		for _, e := range di.EntityVersions {
+			res += fmt.Sprintf("\t\t%-12s %-6s %s\n", e.Type, e.Name, e.Version())
+		}
+	}
 
 	return res
 }
 
+// PAIRING_RECORD_LEN is the size of a pairing info record, as stored in the device data flash page and returned by
+// the pairing information register (0xb5, sub-register 0x20 + slot)
+const PAIRING_RECORD_LEN = 8
+
+// PairingRecord is the decoded form of a pairing info record. In device data dumps, each record follows a
+// 0x2n 0xff 0xff 0xff entry header (n is the device slot), the register returns it following the sub-register byte.
+type PairingRecord struct {
+	DestinationID         byte // last byte of the device RF address, the leading bytes are the receiver serial
+	DefaultReportInterval time.Duration
+	WPID                  []byte
+	Unknown               [2]byte
+	DeviceType            DeviceType
+	Caps                  LogitechDeviceCapabilities
+}
+
+// ParsePairingRecord decodes a pairing info record from data, additional trailing bytes are ignored
+func ParsePairingRecord(data []byte) (rec PairingRecord, err error) {
+	if len(data) < PAIRING_RECORD_LEN {
+		return rec, errors.New(fmt.Sprintf("pairing record too short (%d bytes, %d needed)", len(data), PAIRING_RECORD_LEN))
+	}
+	rec.DestinationID = data[0]
+	rec.DefaultReportInterval = time.Duration(data[1]) * time.Millisecond
+	rec.WPID = []byte{data[2], data[3]}
+	copy(rec.Unknown[:], data[4:6])
+	rec.DeviceType = DeviceType(data[6])
+	rec.Caps = LogitechDeviceCapabilities(data[7])
+	return
+}
+
+func (r PairingRecord) String() string {
+	return fmt.Sprintf("Destination ID: %#02x, report interval: %v, WPID: %02x%02x, type: %s, caps: %s",
+		r.DestinationID, r.DefaultReportInterval, r.WPID[0], r.WPID[1], r.DeviceType.String(), r.Caps.String())
+}
+
+// EXTENDED_PAIRING_INFO_LEN is the size of the extended pairing info returned by the pairing information register
+// (0xb5, sub-register 0x30 + slot), following the sub-register
+const EXTENDED_PAIRING_INFO_LEN = 9
+
+// ExtendedPairingInfo is the decoded form of the extended pairing info of a paired device
+type ExtendedPairingInfo struct {
+	Serial        [4]byte // unit ID of the device
+	ReportTypes   ReportTypes
+	UsabilityInfo UsabilityInfo
+}
+
+// ParseExtendedPairingInfo decodes the extended pairing info from data, additional trailing bytes are ignored
+func ParseExtendedPairingInfo(data []byte) (info ExtendedPairingInfo, err error) {
+	if len(data) < EXTENDED_PAIRING_INFO_LEN {
+		return info, errors.New(fmt.Sprintf("extended pairing info too short (%d bytes, %d needed)", len(data), EXTENDED_PAIRING_INFO_LEN))
+	}
+	copy(info.Serial[:], data[0:4])
+	info.ReportTypes.FromSlice(data[4:8])
+	info.UsabilityInfo = UsabilityInfo(data[8])
+	return
+}
+
 type DeviceInfo struct {
 	DeviceIndex           byte
 	DestinationID         byte
@@ -257,6 +537,14 @@ type DeviceInfo struct {
 	Key                   []byte //derived from keydata
 
 	Name string
+
+	// reported by the device itself (see GetDeviceInfo), only set if the device was reachable
+	HasProtocol   bool
+	ProtocolMajor byte
+	ProtocolMinor byte
+	DeviceName    string       // name reported by a HID++ 2.0 device, could differ from Name
+	Battery       *BatteryInfo // nil if unknown
+	FeatureCount  int          // number of HID++ 2.0 features (including the root feature), 0 if unknown
 }
 
 func (di *DeviceInfo) String() string {
@@ -264,7 +552,11 @@ func (di *DeviceInfo) String() string {
 	res += fmt.Sprintf("-------------------------------------\n")
 	res += fmt.Sprintf("\tDestination ID:              %#02x\n", di.DestinationID)
 	res += fmt.Sprintf("\tDefault report interval:     %v\n", di.DefaultReportInterval)
-	res += fmt.Sprintf("\tWPID:                        %02x%02x\n", di.WPID[0], di.WPID[1])
+	res += fmt.Sprintf("\tWPID:                        %02x%02x", di.WPID[0], di.WPID[1])
+	if name, _, known := DeviceModelFromWPID(uint16(di.WPID[0])<<8 | uint16(di.WPID[1])); known {
+		res += fmt.Sprintf(" (%s)", name)
+	}
+	res += fmt.Sprintln()
 	res += fmt.Sprintf("\tDevice type:                 %#02x (%s)\n", byte(di.DeviceType), di.DeviceType.String())
 	res += fmt.Sprintf("\tSerial:                      %02x:%02x:%02x:%02x\n", di.Serial[0], di.Serial[1], di.Serial[2], di.Serial[3])
 	res += fmt.Sprintf("\tReport types:                %08x (%s)\n", uint32(di.ReportTypes), di.ReportTypes.String())
@@ -272,6 +564,18 @@ func (di *DeviceInfo) String() string {
 	res += fmt.Sprintf("\tUsability Info:              %#02x (%s)\n", byte(di.UsabilityInfo), di.UsabilityInfo.String())
 	res += fmt.Sprintf("\tName:                        %s\n", di.Name)
 	res += fmt.Sprintf("\tRF address:                  %02x:%02x:%02x:%02x:%02x\n", di.RFAddr[0], di.RFAddr[1], di.RFAddr[2], di.RFAddr[3], di.RFAddr[4])
+	if di.HasProtocol {
+		res += fmt.Sprintf("\tProtocol:                    HID++ %d.%d\n", di.ProtocolMajor, di.ProtocolMinor)
+		if len(di.DeviceName) > 0 {
+			res += fmt.Sprintf("\tName (reported by device):   %s\n", di.DeviceName)
+		}
+		if di.Battery != nil {
+			res += fmt.Sprintf("\tBattery:                     %s\n", di.Battery.String())
+		}
+		if di.FeatureCount > 0 {
+			res += fmt.Sprintf("\tHID++ 2.0 features:          %d\n", di.FeatureCount)
+		}
+	}
 	res += fmt.Sprintf("\tKeyData:                     % 02x\n", di.RawKeyData)
 
 	if len(di.Key) > 0 {
@@ -309,7 +613,7 @@ func (si *SetInfo) StoreAutoname() (err error) {
 	filename := fmt.Sprintf("dongle_%02x_%02x_%02x_%02x.dat", si.Dongle.Serial[0], si.Dongle.Serial[1], si.Dongle.Serial[2], si.Dongle.Serial[3])
 	err = si.Store(filename)
 	if err == nil {
-		fmt.Printf("Dongle data stored to file '%s'\n", filename)
+		logf("Dongle data stored to file '%s'\n", filename)
 	}
 	return
 }
@@ -0,0 +1,41 @@
+package unifying
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParsePairingRecord(t *testing.T) {
+	// pairing record of device slot 1, taken from a device data dump of a CU0012 (entry header 21ffffff), followed by
+	// trailing bytes which have to be ignored
+	data := []byte{0x42, 0x14, 0x40, 0x04, 0x04, 0x02, 0x01, 0x0d, 0x00, 0x00}
+	rec, err := ParsePairingRecord(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.DestinationID != 0x42 || rec.DefaultReportInterval != 20*time.Millisecond || !bytes.Equal(rec.WPID, []byte{0x40, 0x04}) ||
+		rec.Unknown != [2]byte{0x04, 0x02} || rec.DeviceType != DEVICE_TYPE_KEYBOARD || rec.Caps != LogitechDeviceCapabilities(0x0d) {
+		t.Errorf("unexpected record %s", rec.String())
+	}
+
+	if _, err := ParsePairingRecord(data[:PAIRING_RECORD_LEN-1]); err == nil {
+		t.Error("truncated pairing record accepted")
+	}
+}
+
+func TestParseExtendedPairingInfo(t *testing.T) {
+	// unit ID, report types (little endian) and usability info, followed by trailing bytes which have to be ignored
+	data := []byte{0x4e, 0x2a, 0x91, 0x07, 0x1a, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00}
+	info, err := ParseExtendedPairingInfo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Serial != [4]byte{0x4e, 0x2a, 0x91, 0x07} || info.ReportTypes != ReportTypes(0x1a) || info.UsabilityInfo != USABILITY_INFO_PS_LOCATION_ON_THE_BASE {
+		t.Errorf("unexpected extended pairing info %+v", info)
+	}
+
+	if _, err := ParseExtendedPairingInfo(data[:EXTENDED_PAIRING_INFO_LEN-1]); err == nil {
+		t.Error("truncated extended pairing info accepted")
+	}
+}
@@ -0,0 +1,77 @@
+package unifying
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	FIRMWARE_DOWNLOAD_TIMEOUT  = 30 * time.Second
+	FIRMWARE_DOWNLOAD_MAX_SIZE = 1 << 20 // hex files of the 32KB flash stay far below this
+)
+
+// ParseFirmwareFromURL downloads a firmware file over HTTP(S) and parses it, see ParseFirmwareFromURLContext. The
+// download is aborted after FIRMWARE_DOWNLOAD_TIMEOUT.
+func ParseFirmwareFromURL(firmwareURL string) (f *Firmware, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), FIRMWARE_DOWNLOAD_TIMEOUT)
+	defer cancel()
+	return ParseFirmwareFromURLContext(ctx, firmwareURL)
+}
+
+// ParseFirmwareFromURLContext downloads a firmware file over HTTP(S) and parses it. URLs with a path ending in .hex or
+// .shex are parsed as Intel hex (like ParseFirmwareHex), all others as raw firmware blob (like ParseFirmwareBin).
+// Downloads announcing or delivering more than FIRMWARE_DOWNLOAD_MAX_SIZE bytes are rejected.
+func ParseFirmwareFromURLContext(ctx context.Context, firmwareURL string) (f *Firmware, err error) {
+	u, err := url.Parse(firmwareURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New(fmt.Sprintf("unsupported URL scheme '%s', use http or https", u.Scheme))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	logf("Downloading firmware from '%s'\n", u)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("firmware download failed: %s", resp.Status))
+	}
+	if resp.ContentLength > FIRMWARE_DOWNLOAD_MAX_SIZE {
+		return nil, errors.New(fmt.Sprintf("firmware download too large (%d bytes, max %d)", resp.ContentLength, FIRMWARE_DOWNLOAD_MAX_SIZE))
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, FIRMWARE_DOWNLOAD_MAX_SIZE+1))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("firmware download failed: %v", err))
+	}
+	if len(data) > FIRMWARE_DOWNLOAD_MAX_SIZE {
+		return nil, errors.New(fmt.Sprintf("firmware download exceeds %d bytes", FIRMWARE_DOWNLOAD_MAX_SIZE))
+	}
+	if resp.ContentLength >= 0 && int64(len(data)) != resp.ContentLength {
+		return nil, errors.New(fmt.Sprintf("firmware download incomplete (%d of %d bytes)", len(data), resp.ContentLength))
+	}
+	logf("... received %d bytes\n", len(data))
+
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".hex", ".shex":
+		return ParseFirmwareHexReader(bytes.NewReader(data), HexParseOptions{})
+	default:
+		return ParseFirmwareBin(data)
+	}
+}
@@ -0,0 +1,64 @@
+package unifying
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseFirmwareFromURL(t *testing.T) {
+	img := testTIImage(0x6000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/fw.bin":
+			w.Write(img)
+		case "/fw.hex":
+			w.Write(testHex(t, mustParseBin(t, img), FLASH_IMAGE_START_TI))
+		case "/too-large-announced.bin":
+			w.Header().Set("Content-Length", strconv.Itoa(FIRMWARE_DOWNLOAD_MAX_SIZE+1))
+		case "/too-large-chunked.bin":
+			// flushing before the body is complete forces a chunked response without Content-Length
+			w.Write(img)
+			w.(http.Flusher).Flush()
+			w.Write(bytes.Repeat([]byte{0xff}, FIRMWARE_DOWNLOAD_MAX_SIZE))
+		case "/truncated.bin":
+			w.Header().Set("Content-Length", strconv.Itoa(len(img)))
+			w.Write(img[:len(img)/2])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	for _, name := range []string{"/fw.bin", "/fw.hex"} {
+		f, err := ParseFirmwareFromURLContext(context.Background(), srv.URL+name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if f.TargetType != FIRMWARE_TARGET_TYPE_TI || f.Size != 0x6000 {
+			t.Errorf("%s: unexpected firmware %s", name, f.String())
+		}
+	}
+
+	tests := []struct {
+		url     string
+		wantErr string
+	}{
+		{srv.URL + "/missing.bin", "404"},
+		{srv.URL + "/too-large-announced.bin", "too large"},
+		{srv.URL + "/too-large-chunked.bin", "exceeds"},
+		{srv.URL + "/truncated.bin", "unexpected EOF"},
+		{"ftp://example.com/fw.bin", "unsupported URL scheme"},
+		{"file:///tmp/fw.bin", "unsupported URL scheme"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseFirmwareFromURLContext(context.Background(), tt.url); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error %v, want error containing '%s'", tt.url, err, tt.wantErr)
+		}
+	}
+}
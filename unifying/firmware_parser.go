@@ -6,9 +6,12 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/google/gousb"
 	"github.com/sigurn/crc16"
+	"io"
 	"os"
-	"strings"
+	"regexp"
+	"strconv"
 )
 
 type FirmwareTargetType byte
@@ -19,25 +22,203 @@ const (
 	FIRMWARE_TARGET_TYPE_TI      FirmwareTargetType = 0x02
 )
 
+func (t FirmwareTargetType) String() string {
+	switch t {
+	case FIRMWARE_TARGET_TYPE_NORDIC:
+		return "Nordic (nRF24LU1+)"
+	case FIRMWARE_TARGET_TYPE_TI:
+		return "Texas Instruments (CC2544)"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	FLASH_PAGE_SIZE_NORDIC uint16 = 0x200 // nRF24LU1+
+	FLASH_PAGE_SIZE_TI     uint16 = 0x400 // CC2544: 1 KB pages, matches the page numbers 0x19/0x1a the firmware uses for its device data at 0x6400/0x6800
+)
+
+// Image sizes of the BOT03.02 -> BOT03.01 downgrade (BaseImageDowngradeFromBL0302ToBL0301). Behind the 0x400 byte
+// bootloader, the downgraded image ends at flash address 0x6bff. The resize delta (0x800) is derived from these sizes,
+// both have to be multiples of FLASH_PAGE_SIZE_TI.
+const (
+	DOWNGRADE_SOURCE_SIZE_TI uint16 = 0x6000 // BOT03.02 image, last flash address 0x63ff
+	DOWNGRADE_TARGET_SIZE_TI uint16 = 0x6800 // BOT03.01 image, last flash address 0x6bff
+)
+
+// Flash layout of TI (CC2544) receivers
+const (
+	FLASH_IMAGE_START_TI  uint16 = 0x0400 // flash address of the firmware image, behind the bootloader
+	FLASH_XDATA_OFFSET_TI uint16 = 0x8000 // flash is mapped to XDATA at this offset, device data is accessed this way
+)
+
+// FirmwareCRCTable is the CRC table used for firmware image checksums (CRC-16/CCITT-FALSE for all known receivers).
+// It could be replaced to experiment with firmware of unfamiliar receivers.
+var FirmwareCRCTable = crc16.MakeTable(crc16.CRC16_CCITT_FALSE)
+
+// NordicImageSizes are the candidate sizes of firmware images for Nordic based receivers, tried in order by
+// ParseFirmwareNordic (older builds use smaller images)
+var NordicImageSizes = []uint16{0x6000, 0x6400, 0x6800}
+
+// TIEndMarkers lists the known end markers of firmware images for Texas Instruments based receivers (the magic bytes
+// directly following the image CRC). All known families (Unifying, Lightspeed, SPOTLIGHT and R500 clickers) use the
+// same marker. ParseFirmwareTI tries each entry, so support for a marker of another family only needs a new entry.
+var TIEndMarkers = [][4]byte{
+	{0xfe, 0xc0, 0xad, 0xde},
+}
+
+// HexRecordOverlap describes a firmware data record of a .hex file, which (partially) overwrites data written by
+// an earlier record
+type HexRecordOverlap struct {
+	Line   int
+	Addr   uint16
+	Length byte
+}
+
+// ParseReport collects findings of a .hex parse, which don't prevent the firmware from being parsed
+type ParseReport struct {
+	Overlaps    []HexRecordOverlap
+	CRCMismatch bool // the image CRC is invalid, only possible if the firmware was parsed with SkipCRC
+}
+
+func (r *ParseReport) HasOverlaps() bool {
+	return len(r.Overlaps) > 0
+}
+
+// AddressRange is a range of firmware addresses, End is inclusive
+type AddressRange struct {
+	Start uint16
+	End   uint16
+}
+
+func (r AddressRange) Len() int {
+	return int(r.End) - int(r.Start) + 1
+}
+
+func (r AddressRange) String() string {
+	return fmt.Sprintf("%#04x-%#04x", r.Start, r.End)
+}
+
+// HexParseOptions control how strict ParseFirmwareHexWithOptions treats irregularities of the input file. The zero
+// value equals the behavior of ParseFirmwareHex.
+type HexParseOptions struct {
+	RejectOverlaps     bool  // abort parsing if a data record overwrites an address written by an earlier record
+	AbortOnInvalidLine bool  // abort parsing on the first line, which can't be decoded or fails the record checksum
+	FillByte           *byte // value used for addresses not covered by data records (erased flash state), nil for 0xFF
+	SkipCRC            bool  // accept images with invalid CRC (see BinParseOptions)
+}
+
+// BinParseOptions control ParseFirmwareBinWithOptions. The zero value equals the behavior of ParseFirmwareBin.
+type BinParseOptions struct {
+	// SkipCRC accepts images with an invalid CRC, for analysis of modified or corrupted firmware. The mismatch is
+	// reported by CRCValid and ParseReport.CRCMismatch instead of failing the parse. As Nordic images are only
+	// delimited by their CRC, the largest candidate size (NordicImageSizes) fitting the data is assumed for them.
+	SkipCRC bool
+	// Target forces the parser for the given target type, instead of trying TI and Nordic (FIRMWARE_TARGET_TYPE_UNKNOWN).
+	// The error of the forced parser is returned unchanged.
+	Target FirmwareTargetType
+}
+
+// DEFAULT_FILL_BYTE is the erased state of flash memory, used to fill gaps between .hex data records
+const DEFAULT_FILL_BYTE byte = 0xFF
+
+func (o HexParseOptions) fillByte() byte {
+	if o.FillByte == nil {
+		return DEFAULT_FILL_BYTE
+	}
+	return *o.FillByte
+}
+
 type Firmware struct {
-	RawData      []byte
-	Size         uint16
-	StartOffset  uint16
-	LastOffset   uint16
-	HasBL        bool
-	CRC          uint16
-	TailPos      uint16
-	Signature    [256]byte
-	HasSignature bool
-	TargetType   FirmwareTargetType
-}
-
-func (f *Firmware) pushRawHexLine(hexline []byte) (err error) {
+	RawData       []byte
+	Size          uint16
+	StartOffset   uint16
+	LastOffset    uint16
+	HasBL         bool
+	BootloaderVID gousb.ID // USB IDs stored in the bootloader part of the blob (PID only for TI), zero without bootloader
+	BootloaderPID gousb.ID
+	CRC           uint16
+	TailPos       uint16
+	Signature     [256]byte
+	HasSignature  bool
+	TargetType    FirmwareTargetType
+	EndMarker     []byte // end marker found by ParseFirmwareTI, nil for other targets
+	CRCValid      bool   // the stored CRC matches the image
+	ParseReport   ParseReport
+
+	skipCRC bool // don't fail parsing on CRC mismatch
+
+	hexWritten []bool // addresses populated by .hex data records, only used during hex parsing
+	coverage   []AddressRange
+}
+
+// CoverageRanges returns the address ranges populated by data records of the parsed .hex file, in ascending order.
+// Addresses not covered by any range have been filled with the fill byte (0xFF by default). For firmware not parsed from a .hex file, nil is
+// returned.
+func (f *Firmware) CoverageRanges() []AddressRange {
+	return f.coverage
+}
+
+// coverageFromHexWritten converts the written address map of a .hex parse to address ranges
+func (f *Firmware) coverageFromHexWritten() {
+	f.coverage = make([]AddressRange, 0)
+	for addr := 0; addr < len(f.hexWritten); addr++ {
+		if !f.hexWritten[addr] {
+			continue
+		}
+		start := addr
+		for addr+1 < len(f.hexWritten) && f.hexWritten[addr+1] {
+			addr++
+		}
+		f.coverage = append(f.coverage, AddressRange{Start: uint16(start), End: uint16(addr)})
+	}
+}
+
+// hexGrowChunk is the minimum growth of buffers during .hex parsing, so that records in ascending order (the common
+// case) don't cause an allocation each
+const hexGrowChunk = 0x1000
+
+// growFilled extends buf to size, the new bytes are set to fill. The backing array grows in chunks of at least
+// hexGrowChunk bytes.
+func growFilled(buf []byte, size int, fill byte) []byte {
+	oldLen := len(buf)
+	if cap(buf) < size {
+		grown := make([]byte, oldLen, size+hexGrowChunk)
+		copy(grown, buf)
+		buf = grown
+	}
+	buf = buf[:size]
+	for i := oldLen; i < size; i++ {
+		buf[i] = fill
+	}
+	return buf
+}
+
+// growWritten extends the written address map of a .hex parse to size, like growFilled
+func growWritten(written []bool, size int) []bool {
+	oldLen := len(written)
+	if cap(written) < size {
+		grown := make([]bool, oldLen, size+hexGrowChunk)
+		copy(grown, written)
+		written = grown
+	}
+	written = written[:size]
+	for i := oldLen; i < size; i++ {
+		written[i] = false
+	}
+	return written
+}
+
+func (f *Firmware) pushRawHexLine(hexline []byte, lineNo int, fill byte) (err error) {
 	if hexline == nil || len(hexline) < 4 {
 		return errors.New("invalid")
 	}
 
 	length := hexline[0]
+	if len(hexline) < 4+int(length) {
+		// f.e. the last line of a truncated file, slicing the data would read behind the record
+		return errors.New(fmt.Sprintf("record truncated, %d data bytes announced", length))
+	}
 	addr := int(hexline[1])<<8 | int(hexline[2])
 	target := hexline[3] // 0x00 - firmware data, 0xfd - signature data
 	resultsize := addr + int(length)
@@ -51,13 +232,23 @@ func (f *Firmware) pushRawHexLine(hexline []byte) (err error) {
 			f.RawData = make([]byte, 0)
 		}
 
-		//append 0xFF till new size requirement is met
+		//append fill bytes till new size requirement is met
 		if len(f.RawData) < resultsize {
-			tail := make([]byte, resultsize-len(f.RawData))
-			for i, _ := range tail {
-				tail[i] = 0xFF
+			f.RawData = growFilled(f.RawData, resultsize, fill)
+		}
+
+		//track addresses written so far, to detect records overwriting earlier ones (last write wins)
+		if len(f.hexWritten) < resultsize {
+			f.hexWritten = growWritten(f.hexWritten, resultsize)
+		}
+		for _, written := range f.hexWritten[addr:resultsize] {
+			if written {
+				f.ParseReport.Overlaps = append(f.ParseReport.Overlaps, HexRecordOverlap{Line: lineNo, Addr: uint16(addr), Length: length})
+				break
 			}
-			f.RawData = append(f.RawData, tail...)
+		}
+		for i := addr; i < resultsize; i++ {
+			f.hexWritten[i] = true
 		}
 
 		//copy in new data
@@ -73,7 +264,7 @@ func (f *Firmware) pushRawHexLine(hexline []byte) (err error) {
 	case 0xfd:
 		// signature data
 		if !f.HasSignature {
-			fmt.Println("signature data added")
+			logln("signature data added")
 		}
 		f.HasSignature = true
 		if resultsize > 0x100 {
@@ -88,24 +279,518 @@ func (f *Firmware) pushRawHexLine(hexline []byte) (err error) {
 	return
 }
 
+// AddSignature sets the signature sent along with the firmware when flashing. sig has to be 256 bytes long and has to
+// pass the plausibility checks of SignatureLooksValid, otherwise the firmware is left without signature.
 func (f *Firmware) AddSignature(sig []byte) (err error) {
-	fmt.Printf("signature length length: %#x (%d) bytes\n", len(sig), len(sig))
+	logf("signature length length: %#x (%d) bytes\n", len(sig), len(sig))
 
 	if len(sig) != 256 {
 		f.HasSignature = false
 		return errors.New("wrong size of firmware signature")
 	}
+	if reason := checkSignature(sig); reason != "" {
+		f.HasSignature = false
+		return errors.New(fmt.Sprintf("implausible firmware signature: %s", reason))
+	}
 	copy(f.Signature[:], sig)
 	f.HasSignature = true
 	return
 }
 
+// SignatureLooksValid applies structural heuristics to the signature of the firmware. The signature scheme isn't known,
+// but a 2048 bit signature is indistinguishable from random data. Thus blank signatures (all bytes equal), text (f.e.
+// a hex file or PEM key passed by mistake) and data with too few distinct byte values (f.e. a firmware fragment with
+// padding) are rejected. The signature isn't verified cryptographically. Returns false if the firmware has no signature.
+func (f *Firmware) SignatureLooksValid() bool {
+	return f.HasSignature && checkSignature(f.Signature[:]) == ""
+}
+
+// checkSignature returns the reason why sig fails the heuristics of SignatureLooksValid, an empty string if it passes
+func checkSignature(sig []byte) (reason string) {
+	var seen [256]bool
+	distinct, printable := 0, 0
+	for _, b := range sig {
+		if !seen[b] {
+			seen[b] = true
+			distinct++
+		}
+		if (b >= 0x20 && b < 0x7f) || b == '\r' || b == '\n' || b == '\t' {
+			printable++
+		}
+	}
+	switch {
+	case distinct == 1:
+		return fmt.Sprintf("all bytes are %#02x", sig[0])
+	case printable == len(sig):
+		return "signature is text, not binary data"
+	case distinct < 64:
+		return fmt.Sprintf("only %d distinct byte values, signature data should look random", distinct)
+	}
+	return ""
+}
+
+// FlashGeometry returns the flash page size of the target chip and the number of pages covered by the firmware image
+// (a partially used last page counts as page). Edits which have to stay page aligned could be checked against it.
+// Note: When flashing, the write chunk size reported by the bootloader is used (for TI it has to divide
+// FLASH_PAGE_SIZE_TI).
+func (f *Firmware) FlashGeometry() (pageSize uint16, pageCount int, err error) {
+	switch f.TargetType {
+	case FIRMWARE_TARGET_TYPE_TI:
+		pageSize = FLASH_PAGE_SIZE_TI
+	case FIRMWARE_TARGET_TYPE_NORDIC:
+		pageSize = FLASH_PAGE_SIZE_NORDIC
+	default:
+		return 0, 0, errors.New("flash geometry unknown for firmware target type")
+	}
+	pageCount = (int(f.Size) + int(pageSize) - 1) / int(pageSize)
+	return
+}
+
+// Pages returns an iterator over the base image in chunks of pageSize bytes (the flash page size of the target, see
+// FlashGeometry, if pageSize is 0). Each chunk is yielded with its absolute flash address (TI images start behind the
+// bootloader at FLASH_IMAGE_START_TI, Nordic images at 0x0000), a partial last chunk is padded with 0xFF (erased
+// flash). The data slices are copies, which could be kept by the caller. Iteration stops when yield returns false.
+// Nothing is yielded for firmware with unknown target type or a base image exceeding the raw data.
+//
+// With Go 1.23 the iterator could be used with range: for addr, data := range f.Pages(0) { ... }
+func (f *Firmware) Pages(pageSize uint16) func(yield func(addr uint16, data []byte) bool) {
+	return func(yield func(addr uint16, data []byte) bool) {
+		if pageSize == 0 {
+			var err error
+			if pageSize, _, err = f.FlashGeometry(); err != nil {
+				return
+			}
+		}
+		var start uint16
+		switch f.TargetType {
+		case FIRMWARE_TARGET_TYPE_TI:
+			start = FLASH_IMAGE_START_TI
+		case FIRMWARE_TARGET_TYPE_NORDIC:
+			start = 0x0000
+		default:
+			return
+		}
+		img, err := f.BaseImage()
+		if err != nil {
+			return
+		}
+		for off := 0; off < len(img); off += int(pageSize) {
+			page := make([]byte, pageSize)
+			n := copy(page, img[off:])
+			for i := n; i < len(page); i++ {
+				page[i] = 0xFF
+			}
+			if !yield(start+uint16(off), page) {
+				return
+			}
+		}
+	}
+}
+
+// Family determines the receiver family the firmware belongs to. The bootloader PID (TI images with prepended
+// bootloader) is used first, the major of the embedded RQR version string otherwise. If neither is available or
+// known (f.e. for a firmware without data), FAMILY_UNKNOWN is returned without error.
+func (f *Firmware) Family() (family ReceiverFamily, err error) {
+	if f.TargetType == FIRMWARE_TARGET_TYPE_TI && f.HasBL && len(f.RawData) >= 0x400 {
+		pid := gousb.ID(uint16(f.RawData[0x3fb])<<8 | uint16(f.RawData[0x3fa]))
+		if fm, known := BootloaderPIDFamily[pid]; known {
+			return fm.Family(), nil
+		}
+	}
+	if v, errV := f.Version(); errV == nil {
+		return FirmwareMajor(v.Major).Family(), nil
+	}
+	return FAMILY_UNKNOWN, nil
+}
+
+// FreeSpace returns the number of unused (0xFF) bytes at the end of the firmware image, in front of the image tail
+// (CRC and end marker for TI, CRC for Nordic). As the device data pages directly follow the image, this is the room
+// left for appended code, which doesn't collide with device data.
+func (f *Firmware) FreeSpace() (free uint16, err error) {
+	var tailLen int
+	switch f.TargetType {
+	case FIRMWARE_TARGET_TYPE_TI:
+		tailLen = 6
+	case FIRMWARE_TARGET_TYPE_NORDIC:
+		tailLen = 2
+	default:
+		return 0, errors.New("image layout unknown for firmware target type")
+	}
+	if int(f.StartOffset)+int(f.Size) > len(f.RawData) || int(f.Size) < tailLen {
+		return 0, errors.New("firmware image exceeds raw data")
+	}
+	img := f.RawData[f.StartOffset : int(f.StartOffset)+int(f.Size)-tailLen]
+	for pos := len(img) - 1; pos >= 0 && img[pos] == 0xFF; pos-- {
+		free++
+	}
+	return
+}
+
+// MemoryRegion is a named part of the firmware blob, the range is given as offsets into RawData
+type MemoryRegion struct {
+	Name  string
+	Range AddressRange
+}
+
+func (r MemoryRegion) String() string {
+	return fmt.Sprintf("%s %-10s (%d bytes)", r.Range, r.Name, r.Range.Len())
+}
+
+// MemoryMap splits the firmware blob into its regions, ordered by address: bootloader (if present, or erased region), code, unused
+// space in front of the image tail (see FreeSpace) and the tail itself (CRC and end marker for TI, CRC for Nordic).
+// The device data pages following the image in flash aren't part of the blob, thus they aren't listed.
+func (f *Firmware) MemoryMap() (regions []MemoryRegion, err error) {
+	free, err := f.FreeSpace()
+	if err != nil {
+		return nil, err
+	}
+	tailLen := uint16(6)
+	if f.TargetType == FIRMWARE_TARGET_TYPE_NORDIC {
+		tailLen = 2
+	}
+
+	if f.HasBL && f.TargetType == FIRMWARE_TARGET_TYPE_TI {
+		regions = append(regions, MemoryRegion{"bootloader", AddressRange{Start: 0x0000, End: 0x03ff}})
+	} else if f.StartOffset > 0 && f.TargetType == FIRMWARE_TARGET_TYPE_TI {
+		regions = append(regions, MemoryRegion{"erased", AddressRange{Start: 0x0000, End: f.StartOffset - 1}})
+	}
+	tail := f.StartOffset + f.Size - tailLen
+	if code := tail - free; code > f.StartOffset {
+		regions = append(regions, MemoryRegion{"code", AddressRange{Start: f.StartOffset, End: code - 1}})
+	}
+	if free > 0 {
+		regions = append(regions, MemoryRegion{"free", AddressRange{Start: tail - free, End: tail - 1}})
+	}
+	regions = append(regions, MemoryRegion{"tail", AddressRange{Start: tail, End: tail + tailLen - 1}})
+	if f.HasBL && f.TargetType == FIRMWARE_TARGET_TYPE_NORDIC && len(f.RawData) > 0x7400 {
+		regions = append(regions, MemoryRegion{"bootloader", AddressRange{Start: 0x7400, End: uint16(len(f.RawData) - 1)}})
+	}
+	return
+}
+
+// FirmwareVersion is the version of a firmware image, as found in the image
+type FirmwareVersion struct {
+	Major    byte
+	Minor    byte
+	Build    uint16
+	HasBuild bool
+	Offset   int // offset of the version string in the base image
+}
+
+func (v FirmwareVersion) String() string {
+	if v.HasBuild {
+		return fmt.Sprintf("RQR%02x.%02x_B%04x", v.Major, v.Minor, v.Build)
+	}
+	return fmt.Sprintf("RQR%02x.%02x", v.Major, v.Minor)
+}
+
+// version strings have the form 'RQR24.07_B0030' (major, minor and build are hex/BCD encoded)
+var firmwareVersionRegexp = regexp.MustCompile(`RQR([0-9A-Fa-f]{2})\.([0-9A-Fa-f]{2})(_B([0-9A-Fa-f]{4}))?`)
+
+// Version locates the embedded version string (f.e. 'RQR24.07_B0030') in the base image. The layout of the version
+// data isn't documented, thus only images carrying the version as ASCII string are supported. If no version string is
+// found, an error is returned.
+func (f *Firmware) Version() (v FirmwareVersion, err error) {
+	img, err := f.BaseImage()
+	if err != nil {
+		return v, err
+	}
+	m := firmwareVersionRegexp.FindSubmatchIndex(img)
+	if m == nil {
+		return v, errors.New("no version string found in firmware image")
+	}
+	maj, _ := strconv.ParseUint(string(img[m[2]:m[3]]), 16, 8)
+	min, _ := strconv.ParseUint(string(img[m[4]:m[5]]), 16, 8)
+	v = FirmwareVersion{Major: byte(maj), Minor: byte(min), Offset: m[0]}
+	if m[8] >= 0 {
+		build, _ := strconv.ParseUint(string(img[m[8]:m[9]]), 16, 16)
+		v.Build = uint16(build)
+		v.HasBuild = true
+	}
+	return v, nil
+}
+
+// BuildInfo is the build metadata embedded in a firmware image, fields not found in the image are flagged
+type BuildInfo struct {
+	Version    FirmwareVersion
+	HasVersion bool
+	Date       string // build date as embedded by the compiler, f.e. 'Mar  7 2016' or 'Mar  7 2016 11:02:45'
+	HasDate    bool
+}
+
+func (bi BuildInfo) String() string {
+	version, date := "unknown", "unknown"
+	if bi.HasVersion {
+		version = bi.Version.String()
+	}
+	if bi.HasDate {
+		date = bi.Date
+	}
+	return fmt.Sprintf("version %s, build date %s", version, date)
+}
+
+// build dates use the format of the C __DATE__ macro, optionally followed by __TIME__
+var firmwareBuildDateRegexp = regexp.MustCompile(`(Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) [ 0-3][0-9] (19|20)[0-9]{2}( ?[0-2][0-9]:[0-5][0-9]:[0-5][0-9])?`)
+
+// BuildInfo collects the version string and a build date (if embedded) from the base image. Missing information
+// is flagged in the result, an error is only returned if the base image can't be accessed.
+func (f *Firmware) BuildInfo() (bi BuildInfo, err error) {
+	img, err := f.BaseImage()
+	if err != nil {
+		return bi, err
+	}
+	if v, errV := f.Version(); errV == nil {
+		bi.Version = v
+		bi.HasVersion = true
+	}
+	if date := firmwareBuildDateRegexp.Find(img); date != nil {
+		bi.Date = string(date)
+		bi.HasDate = true
+	}
+	return bi, nil
+}
+
+// SetVersion replaces major and minor version of the version string located by Version and recomputes the CRC of
+// the image
+func (f *Firmware) SetVersion(major, minor byte) (err error) {
+	v, err := f.Version()
+	if err != nil {
+		return err
+	}
+	pos := int(f.StartOffset) + v.Offset + len("RQR")
+	copy(f.RawData[pos:], fmt.Sprintf("%02x.%02x", major, minor))
+	return f.UpdateCRC()
+}
+
+// ComputeCRC calculates the CRC (FirmwareCRCTable) of the raw data from start to end (both inclusive, like
+// AddressRange) without modifying the firmware. end is clamped to the raw data, an empty range yields the CRC of
+// no data.
+func (f *Firmware) ComputeCRC(start, end uint16) uint16 {
+	stop := int(end) + 1
+	if stop > len(f.RawData) {
+		stop = len(f.RawData)
+	}
+	if int(start) >= stop {
+		return crc16.Checksum(nil, FirmwareCRCTable)
+	}
+	return crc16.Checksum(f.RawData[start:stop], FirmwareCRCTable)
+}
+
+// CRCDebug returns the CRC stored in the image, the CRC computed (FirmwareCRCTable) from the current raw data and the
+// checksummed range (offsets into RawData, both inclusive like AddressRange), the same range UpdateCRC uses. Unlike
+// parsing, a mismatch isn't treated as error, so the values help to tell a wrong range from corrupted data. For unknown
+// target types or images too small to hold a CRC, all values are zero.
+func (f *Firmware) CRCDebug() (stored uint16, computed uint16, rangeStart, rangeEnd uint16) {
+	switch f.TargetType {
+	case FIRMWARE_TARGET_TYPE_TI:
+		if f.Size < 7 || int(f.TailPos)+2 > len(f.RawData) {
+			return
+		}
+		rangeStart, rangeEnd = f.StartOffset, f.StartOffset+f.Size-7
+		stored = uint16(f.RawData[f.TailPos+1])<<8 | uint16(f.RawData[f.TailPos])
+	case FIRMWARE_TARGET_TYPE_NORDIC:
+		if f.Size < 3 || int(f.Size) > len(f.RawData) {
+			return
+		}
+		rangeStart, rangeEnd = 0, f.Size-3
+		stored = uint16(f.RawData[f.Size-2])<<8 | uint16(f.RawData[f.Size-1])
+	default:
+		return
+	}
+	return stored, f.ComputeCRC(rangeStart, rangeEnd), rangeStart, rangeEnd
+}
+
+// UpdateCRC recalculates the CRC of the image and stores it at the CRC location of the target type
+func (f *Firmware) UpdateCRC() (err error) {
+	switch f.TargetType {
+	case FIRMWARE_TARGET_TYPE_TI:
+		f.CRC = f.ComputeCRC(f.StartOffset, f.StartOffset+f.Size-7)
+		f.RawData[f.TailPos] = byte(f.CRC & 0x00ff)
+		f.RawData[f.TailPos+1] = byte(f.CRC >> 8)
+	case FIRMWARE_TARGET_TYPE_NORDIC:
+		f.CRC = f.ComputeCRC(0, f.Size-3)
+		f.RawData[f.Size-2] = byte(f.CRC >> 8)
+		f.RawData[f.Size-1] = byte(f.CRC & 0x00ff)
+	default:
+		return errors.New("can't update CRC for unknown firmware target type")
+	}
+	f.CRCValid = true
+	return nil
+}
+
+// FindPattern returns the offsets (relative to the base image) of all occurrences of pattern, including overlapping
+// ones
+func (f *Firmware) FindPattern(pattern []byte) []uint16 {
+	return f.FindPatternMasked(pattern, nil)
+}
+
+// FindPatternMasked works like FindPattern, but only compares the bits set in mask (which has to have the length of
+// pattern). A mask byte 0xff requires an exact match, 0x00 makes the byte a wildcard. A nil mask matches exactly.
+func (f *Firmware) FindPatternMasked(pattern []byte, mask []byte) (offsets []uint16) {
+	if len(pattern) == 0 || (mask != nil && len(mask) != len(pattern)) {
+		return nil
+	}
+	img, err := f.BaseImage()
+	if err != nil {
+		return nil
+	}
+
+	for pos := 0; pos+len(pattern) <= len(img); pos++ {
+		match := true
+		for i, p := range pattern {
+			m := byte(0xff)
+			if mask != nil {
+				m = mask[i]
+			}
+			if img[pos+i]&m != p&m {
+				match = false
+				break
+			}
+		}
+		if match {
+			offsets = append(offsets, uint16(pos))
+		}
+	}
+	return
+}
+
+// FirmwareDiff is a region of consecutive bytes, which differ between two firmware images
+type FirmwareDiff struct {
+	Addr uint16
+	Old  []byte
+	New  []byte
+}
+
+func (d FirmwareDiff) String() string {
+	return fmt.Sprintf("%#04x (%d bytes): % 02x --> % 02x", d.Addr, len(d.Old), d.Old, d.New)
+}
+
+// DiffImages compares two images, which both start at address base, and returns the differing
+// regions. Bytes beyond the end of the shorter image are ignored.
+func DiffImages(base uint16, oldImg []byte, newImg []byte) (diffs []FirmwareDiff) {
+	n := len(oldImg)
+	if len(newImg) < n {
+		n = len(newImg)
+	}
+	for i := 0; i < n; i++ {
+		if oldImg[i] == newImg[i] {
+			continue
+		}
+		start := i
+		for i+1 < n && oldImg[i+1] != newImg[i+1] {
+			i++
+		}
+		diffs = append(diffs, FirmwareDiff{
+			Addr: base + uint16(start),
+			Old:  oldImg[start : i+1],
+			New:  newImg[start : i+1],
+		})
+	}
+	return
+}
+
+// MetadataRegions returns the regions of the base image (offsets relative to the base image, like FindPattern), which
+// differ between builds of the same code: the version string (if found) and the image tail (CRC and end marker for
+// TI, CRC for Nordic). The result could be passed to SameBaseAs.
+func (f *Firmware) MetadataRegions() (regions []AddressRange) {
+	img, err := f.BaseImage()
+	if err != nil {
+		return nil
+	}
+	if m := firmwareVersionRegexp.FindIndex(img); m != nil {
+		regions = append(regions, AddressRange{Start: uint16(m[0]), End: uint16(m[1] - 1)})
+	}
+	tailLen := uint16(0)
+	switch f.TargetType {
+	case FIRMWARE_TARGET_TYPE_TI:
+		tailLen = 6
+	case FIRMWARE_TARGET_TYPE_NORDIC:
+		tailLen = 2
+	}
+	if tailLen > 0 && f.Size >= tailLen {
+		regions = append(regions, AddressRange{Start: f.Size - tailLen, End: f.Size - 1})
+	}
+	return
+}
+
+// SameBaseAs reports if the base images of f and other are equal, ignoring the bytes covered by ignoreRegions
+// (offsets relative to the base image, f.e. from MetadataRegions). Images of different target type or size never
+// share the same base.
+func (f *Firmware) SameBaseAs(other *Firmware, ignoreRegions []AddressRange) bool {
+	if other == nil || f.TargetType != other.TargetType || f.Size != other.Size {
+		return false
+	}
+	img, errImg := f.BaseImage()
+	otherImg, errOther := other.BaseImage()
+	if errImg != nil || errOther != nil {
+		return false
+	}
+	for _, r := range ignoreRegions {
+		for i := int(r.Start); i <= int(r.End) && i < len(img); i++ {
+			img[i] = 0
+			otherImg[i] = 0
+		}
+	}
+	return bytes.Equal(img, otherImg)
+}
+
+// Equal reports if both firmwares hold the same data (raw blob and signature) and parse results. Findings of the
+// parser (ParseReport) aren't compared, as they depend on the input format.
+func (f *Firmware) Equal(other *Firmware) bool {
+	if f == nil || other == nil {
+		return f == other
+	}
+	return bytes.Equal(f.RawData, other.RawData) &&
+		f.Size == other.Size &&
+		f.StartOffset == other.StartOffset &&
+		f.LastOffset == other.LastOffset &&
+		f.HasBL == other.HasBL &&
+		f.BootloaderVID == other.BootloaderVID &&
+		f.BootloaderPID == other.BootloaderPID &&
+		f.CRC == other.CRC &&
+		f.TailPos == other.TailPos &&
+		f.Signature == other.Signature &&
+		f.HasSignature == other.HasSignature &&
+		f.TargetType == other.TargetType &&
+		bytes.Equal(f.EndMarker, other.EndMarker) &&
+		f.CRCValid == other.CRCValid
+}
+
+// BaseImage returns a copy of the firmware image (Size bytes from StartOffset), without bootloader. An error is
+// returned if StartOffset and Size don't fit into RawData (f.e. after a failed parse).
 func (f *Firmware) BaseImage() (img []byte, err error) {
+	end := int(f.StartOffset) + int(f.Size)
+	if end > len(f.RawData) {
+		return nil, errors.New(fmt.Sprintf("base image %#04x..%#04x exceeds firmware blob of size %#04x", f.StartOffset, end, len(f.RawData)))
+	}
 	img = make([]byte, f.Size)
-	copy(img, f.RawData[f.StartOffset:f.StartOffset+f.Size])
+	copy(img, f.RawData[f.StartOffset:end])
 	return
 }
 
+// Bootloader returns a copy of the bootloader contained in the firmware blob. For TI firmware this is the prepended
+// region 0x0000..0x03ff, for Nordic firmware the region appended from 0x7400 to the end of the blob. An error is
+// returned, if the blob has no bootloader.
+func (f *Firmware) Bootloader() (bl []byte, err error) {
+	if !f.HasBL {
+		return nil, errors.New("firmware blob has no bootloader")
+	}
+	switch f.TargetType {
+	case FIRMWARE_TARGET_TYPE_TI:
+		if len(f.RawData) < 0x400 {
+			return nil, errors.New("firmware blob too short to contain a bootloader")
+		}
+		return append([]byte{}, f.RawData[:0x400]...), nil
+	case FIRMWARE_TARGET_TYPE_NORDIC:
+		if len(f.RawData) <= 0x7400 {
+			return nil, errors.New("firmware blob too short to contain a bootloader")
+		}
+		return append([]byte{}, f.RawData[0x7400:]...), nil
+	default:
+		return nil, errors.New("unknown firmware target type")
+	}
+}
+
 /*
 Firmware images are either meant for <=BOT03.01 (unsigned) or BOT03.02 (signed)
 Images for BOT03.01 have a start address of 0x0400 and end address of 0x6bff, while images for BOT03.02 start at 0x0400
@@ -119,7 +804,7 @@ The following steps have to be done, in order to downgrade an image:
 1) the image has to be resized from 0x6000 bytes to 0x6800 bytes (change last address from 0x63ff to 0x6bff), this
 involves:
     - appending 0xFF bytes
-    - moving the end marker '\xfe\xac\xad\xde' to the new image end location
+    - moving the end marker '\xfe\xc0\xad\xde' to the new image end location
     - recalculate the CRC for the new image (uint16 in directly before end marker)
 
 2) Patching the image
@@ -172,77 +857,243 @@ func (f *Firmware) BaseImageDowngradeFromBL0302ToBL0301() (patched_baseimage []b
 		return nil, errors.New("error: downgrade only supported for CC2544 firmware")
 	}
 
-	if f.Size != 0x6000 {
-		err = errors.New("can't downgrade an image which hasn't a size of 0x6000")
+	if f.IsDowngraded() {
+		return nil, ErrFirmwareAlreadyDowngraded
+	}
+
+	if f.Size != DOWNGRADE_SOURCE_SIZE_TI {
+		err = errors.New(fmt.Sprintf("can't downgrade an image which hasn't a size of %#04x", DOWNGRADE_SOURCE_SIZE_TI))
 		return
 	}
 
+	patched_baseimage = make([]byte, DOWNGRADE_TARGET_SIZE_TI)
+	err = f.downgradeInPlace(patched_baseimage)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// ErrDowngradeUnvalidated is matched (errors.Is) by the error returned when flashing would need a downgrade, which
+// isn't validated for the family of the receiver (see DowngradeValidated)
+var ErrDowngradeUnvalidated = errors.New("downgrade patch set isn't validated for this receiver family (force to try anyway)")
+
+// DowngradeValidated reports if the downgrade patch set of BaseImageDowngradeFromBL0302ToBL0301 has been validated for
+// the given firmware family. The SPOTLIGHT (RQR41) and R500 (RQR45) receivers use the same memory layout (0x6000 byte
+// images for BOT03.02), but the patches haven't been tested for them.
+func DowngradeValidated(family FirmwareMajor) bool {
+	switch family {
+	case FIRMWARE_MAJOR_UNIFYING_TI, FIRMWARE_MAJOR_LIGHTSPEED_TI:
+		return true
+	default:
+		return false
+	}
+}
+
+var ErrFirmwareAlreadyDowngraded = errors.New("firmware is already downgraded (or built for BOT03.01)")
+
+// IsDowngraded checks if a TI firmware already targets BOT03.01, which is the case if it has a size of 0x6800 and
+// accesses device data at 0xec00/0xf000 (the patched `mov dptr` instructions). Note: This can't distinguish an image
+// downgraded by BaseImageDowngradeFromBL0302ToBL0301 from one natively built for BOT03.01.
+func (f *Firmware) IsDowngraded() bool {
+	if f.TargetType != FIRMWARE_TARGET_TYPE_TI || f.Size != DOWNGRADE_TARGET_SIZE_TI || int(f.StartOffset)+int(f.Size) > len(f.RawData) {
+		return false
+	}
+	img := f.RawData[f.StartOffset : f.StartOffset+f.Size]
+	return bytes.Contains(img, []byte{0x90, 0xec, 0x00}) || bytes.Contains(img, []byte{0x90, 0xf0, 0x00})
+}
+
+// Patch replaces all occurrences of From with To (both have to be of same length) in a firmware image
+type Patch struct {
+	From        []byte
+	To          []byte
+	Description string
+}
+
+func (p Patch) String() string {
+	return fmt.Sprintf("% 02x -> % 02x: %s", p.From, p.To, p.Description)
+}
+
+/*
+CAUTION: The following patch-set was only tested for working downgrades of RQR39.04 (G-Series G603 receiver)
+and RQR24.07 (latest Unifying firmware for TI receiver, downgrade basically ends up being 24.06).
+It is likely that wrong results are produced on other firmwares.
+
+It very likely works for RQR41.00 (SPOTLIGHT receiver firmware) and RQR45.00 (R500 receiver firmware), but as this
+is unvalidated, flashing refuses the downgrade for those families unless forced (see DowngradeValidated).
+
+Patches are applied in order, later patterns see the result of earlier ones.
+
+The patches relocate the device data pages from 0x6400/0x6800 to 0x6c00/0x7000, which shows up in the code as
+XDATA addresses (flash mapped to 0x8000, thus 0xe400/0xe800 -> 0xec00/0xf000), flash page numbers (0x400 byte pages,
+0x19/0x1a -> 0x1b/0x1c) and CODE address high bytes (0x64 -> 0x6c). The downgrade computes the patch set from the
+device data pages of the source image (see DeviceDataBase), DowngradeBL0302ToBL0301Patches is the result for the
+known image sizes.
+*/
+var DowngradeBL0302ToBL0301Patches = DeviceDataRelocationPatches(
+	[2]uint16{FLASH_IMAGE_START_TI + DOWNGRADE_SOURCE_SIZE_TI, FLASH_IMAGE_START_TI + DOWNGRADE_SOURCE_SIZE_TI + FLASH_PAGE_SIZE_TI},
+	[2]uint16{FLASH_IMAGE_START_TI + DOWNGRADE_TARGET_SIZE_TI, FLASH_IMAGE_START_TI + DOWNGRADE_TARGET_SIZE_TI + FLASH_PAGE_SIZE_TI},
+)
+
+// DeviceDataRelocationPatches builds the patch set moving device data access from the flash pages in from to the
+// flash pages in to (flash addresses as returned by DeviceDataBase). The instruction patterns are the ones of the
+// BOT03.02 -> BOT03.01 downgrade, only the addresses are computed: XDATA address and high byte, flash page number and
+// CODE high byte of each page.
+func DeviceDataRelocationPatches(from [2]uint16, to [2]uint16) []Patch {
+	xdata := func(addr uint16) uint16 { return addr + FLASH_XDATA_OFFSET_TI }
+	xhi := func(addr uint16) byte { return byte(xdata(addr) >> 8) }
+	page := func(addr uint16) byte { return byte(addr / FLASH_PAGE_SIZE_TI) }
+	f0, f1, t0, t1 := from[0], from[1], to[0], to[1]
+
+	return []Patch{
+		{[]byte{0x90, xhi(f0), byte(f0)}, []byte{0x90, xhi(t0), byte(t0)}, fmt.Sprintf("MOV DPTR,#%#04x -> #%#04x (XDATA address of data page 1)", xdata(f0), xdata(t0))},
+		{[]byte{0x7a, 0x04, 0x7b, xhi(f0)}, []byte{0x7a, 0x04, 0x7b, xhi(t0)}, fmt.Sprintf("MOV R3,#%#02x -> #%#02x (XDATA high byte of data page 1)", xhi(f0), xhi(t0))},
+		{[]byte{0x90, xhi(f1), byte(f1)}, []byte{0x90, xhi(t1), byte(t1)}, fmt.Sprintf("MOV DPTR,#%#04x -> #%#04x (XDATA address of data page 2)", xdata(f1), xdata(t1))},
+		{[]byte{0x7a, 0x04, 0x7b, xhi(f1)}, []byte{0x7a, 0x04, 0x7b, xhi(t1)}, fmt.Sprintf("MOV R3,#%#02x -> #%#02x (XDATA high byte of data page 2)", xhi(f1), xhi(t1))},
+		{[]byte{0x08, 0x74, xhi(f0)}, []byte{0x08, 0x74, xhi(t0)}, fmt.Sprintf("MOV A,#%#02x -> #%#02x (XDATA high byte of data page 1)", xhi(f0), xhi(t0))},
+		{[]byte{0x75, 0x0f, xhi(f1)}, []byte{0x75, 0x0f, xhi(t1)}, fmt.Sprintf("MOV 0x0f,#%#02x -> #%#02x (XDATA high byte of data page 2)", xhi(f1), xhi(t1))},
+		{[]byte{0x79, page(f1)}, []byte{0x79, page(t1)}, fmt.Sprintf("MOV R1,#%#02x -> #%#02x (flash page number of data page 2)", page(f1), page(t1))},
+		{[]byte{0x7f, page(f1), 0x79, 0x7f}, []byte{0x7f, page(t1), 0x79, 0x7f}, fmt.Sprintf("MOV R7,#%#02x -> #%#02x (flash page number of data page 2)", page(f1), page(t1))},
+		{[]byte{0x7f, page(f0)}, []byte{0x7f, page(t0)}, fmt.Sprintf("MOV R7,#%#02x -> #%#02x (flash page number of data page 1)", page(f0), page(t0))},
+		{[]byte{0x79, page(f0)}, []byte{0x79, page(t0)}, fmt.Sprintf("MOV R1,#%#02x -> #%#02x (flash page number of data page 1)", page(f0), page(t0))},
+		{[]byte{0xf2, 0x08, 0x74, xhi(f1)}, []byte{0xf2, 0x08, 0x74, xhi(t1)}, fmt.Sprintf("MOV A,#%#02x -> #%#02x (XDATA high byte of data page 2)", xhi(f1), xhi(t1))},
+		{[]byte{0x0f, xhi(f0), 0x22}, []byte{0x0f, xhi(t0), 0x22}, fmt.Sprintf("%#02x -> %#02x (XDATA high byte of data page 1)", xhi(f0), xhi(t0))},
+		{[]byte{0x00, 0x7b, byte(f0 >> 8)}, []byte{0x00, 0x7b, byte(t0 >> 8)}, fmt.Sprintf("MOV R3,#%#02x -> #%#02x (CODE high byte of data page 1)", byte(f0>>8), byte(t0>>8))},
+		{[]byte{0x05, 0x79, page(f0)}, []byte{0x05, 0x79, page(t0)}, fmt.Sprintf("MOV R1,#%#02x -> #%#02x (flash page number of data page 1)", page(f0), page(t0))},
+	}
+}
+
+// DeviceDataBase returns the flash addresses of the two device data pages a TI firmware accesses. All firmwares
+// store device data in the two flash pages directly following the image, thus the addresses are derived from the
+// image size (0x6400/0x6800 for BOT03.02 images, 0x6c00/0x7000 for BOT03.01 images). Add FLASH_XDATA_OFFSET_TI to
+// get the addresses used by the code.
+func (f *Firmware) DeviceDataBase() (page0, page1 uint16, err error) {
+	if f.TargetType != FIRMWARE_TARGET_TYPE_TI {
+		return 0, 0, errors.New("device data layout only known for CC2544 firmware")
+	}
+	if f.Size == 0 || f.Size%FLASH_PAGE_SIZE_TI != 0 {
+		return 0, 0, errors.New(fmt.Sprintf("image size %#04x isn't aligned to flash pages of %#04x bytes", f.Size, FLASH_PAGE_SIZE_TI))
+	}
+	page0 = FLASH_IMAGE_START_TI + f.Size
+	page1 = page0 + FLASH_PAGE_SIZE_TI
+	if int(page1)+int(FLASH_PAGE_SIZE_TI) > int(FLASH_XDATA_OFFSET_TI) {
+		return 0, 0, errors.New(fmt.Sprintf("image size %#04x leaves no room for device data in flash", f.Size))
+	}
+	return
+}
+
+// downgradeInPlace writes the image downgraded from BOT03.02 to BOT03.01 to buf, which has to have a size of
+// DOWNGRADE_TARGET_SIZE_TI. All patches are equal in length, so they are applied directly to buf, without allocating
+// intermediate slices.
+func (f *Firmware) downgradeInPlace(buf []byte) (err error) {
+	if len(buf) != int(DOWNGRADE_TARGET_SIZE_TI) || f.Size != DOWNGRADE_SOURCE_SIZE_TI {
+		return errors.New(fmt.Sprintf("downgrade buffer has to have a size of %#04x", DOWNGRADE_TARGET_SIZE_TI))
+	}
+
 	//grab a copy of the base image
-	patched_baseimage = make([]byte, f.Size+0x800)
-	copy(patched_baseimage, f.RawData[f.StartOffset:f.StartOffset+f.Size])
+	copy(buf, f.RawData[f.StartOffset:f.StartOffset+f.Size])
 
-	fmt.Println("... resizing firmware")
+	logln("... resizing firmware")
 	//overwrite image CRC and end marker with 0xFF
 	for i := 0; i < 6; i++ {
-		patched_baseimage[0x6000-6+i] = 0xFF
+		buf[int(DOWNGRADE_SOURCE_SIZE_TI)-6+i] = 0xFF
 	}
 
 	// fill appended data with 0xFF
-	for i := 0x6000; i < len(patched_baseimage); i++ {
-		patched_baseimage[i] = 0xFF
-	}
-
-	/*
-	CAUTION: The following patch-set was only tested for working downgrades of RQR39.04 (G-Series G603 receiver)
-	and RQR24.07 (latest Unifying firmware for TI receiver, downgrade basically ends up being 24.06).
-	It is likely that wrong results are produced on other firmwares.
-
-	It very likely works for RQR41.00 (SPOTLIGHT receiver firmware) and RQR45.00 (R500 receiver firmware).
-	 */
-
-	// Apply patches
-	//1		90e400		-->	90ec00
-	//2		7a047be4	-->	7a047bec
-	//3		90e800		-->	90f000
-	//4		7a047be8	-->	7a047bf0
-	//5		0874e4		-->	0874ec
-	//6		750fe8		-->	750ff0
-	//7		791a		-->	791c
-	//8		7f1a797f	-->	7f1c797f
-	//9		7f19		-->	7f1b
-	//10	7919		-->	791b
-	//11	f20874e8	-->	f20874f0
-	//12	0fe422		-->	0fec22
-	//13	007b64		-->	007b6c
-	//14	057919		-->	05791b
-
-	fmt.Println("... patching firmware")
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x90, 0xe4, 0x00}, []byte{0x90, 0xec, 0x00}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x7a, 0x04, 0x7b, 0xe4}, []byte{0x7a, 0x04, 0x7b, 0xec}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x90, 0xe8, 0x00}, []byte{0x90, 0xf0, 0x00}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x7a, 0x04, 0x7b, 0xe8}, []byte{0x7a, 0x04, 0x7b, 0xf0}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x08, 0x74, 0xe4}, []byte{0x08, 0x74, 0xec}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x75, 0x0f, 0xe8}, []byte{0x75, 0x0f, 0xf0}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x79, 0x1a}, []byte{0x79, 0x1c}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x7f, 0x1a, 0x79, 0x7f}, []byte{0x7f, 0x1c, 0x79, 0x7f}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x7f, 0x19}, []byte{0x7f, 0x1b}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x79, 0x19}, []byte{0x79, 0x1b}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0xf2, 0x08, 0x74, 0xe8}, []byte{0xf2, 0x08, 0x74, 0xf0}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x0f, 0xe4, 0x22}, []byte{0x0f, 0xec, 0x22}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x00, 0x7b, 0x64}, []byte{0x00, 0x7b, 0x6c}, -1)
-	patched_baseimage = bytes.Replace(patched_baseimage, []byte{0x05, 0x79, 0x19}, []byte{0x05, 0x79, 0x1b}, -1)
-
-	//put in the new end marker
-	copy(patched_baseimage[len(patched_baseimage)-4:], []byte{0xfe, 0xc0, 0xad, 0xde})
+	for i := int(DOWNGRADE_SOURCE_SIZE_TI); i < len(buf); i++ {
+		buf[i] = 0xFF
+	}
+
+	// relocate device data access from the pages behind the source image to the ones behind the target image
+	from0, from1, err := f.DeviceDataBase()
+	if err != nil {
+		return err
+	}
+	to0 := FLASH_IMAGE_START_TI + DOWNGRADE_TARGET_SIZE_TI
+	patches := DeviceDataRelocationPatches([2]uint16{from0, from1}, [2]uint16{to0, to0 + FLASH_PAGE_SIZE_TI})
+
+	// Apply patches, each one replaces all non-overlapping occurrences from left to right (like bytes.Replace)
+	logln("... patching firmware")
+	for _, p := range patches {
+		for pos := 0; pos < len(buf); {
+			i := bytes.Index(buf[pos:], p.From)
+			if i < 0 {
+				break
+			}
+			pos += i
+			copy(buf[pos:], p.To)
+			pos += len(p.From)
+		}
+	}
+
+	//put in the new end marker (the one of the source image, if known)
+	endMarker := TIEndMarkers[0][:]
+	if len(f.EndMarker) == len(endMarker) {
+		endMarker = f.EndMarker
+	}
+	copy(buf[len(buf)-4:], endMarker)
 
 	//recalculate CRC
-	fmt.Println("... recalculating firmware CRC")
-	calculated_crc := crc16.Checksum(patched_baseimage[:len(patched_baseimage)-6], crc16.MakeTable(crc16.CRC16_CCITT_FALSE)) //only regard data up to CRC offset
-	patched_baseimage[len(patched_baseimage)-6] = byte(calculated_crc & 0x00ff)
-	patched_baseimage[len(patched_baseimage)-5] = byte(calculated_crc >> 8)
+	logln("... recalculating firmware CRC")
+	calculated_crc := crc16.Checksum(buf[:len(buf)-6], FirmwareCRCTable) //only regard data up to CRC offset
+	buf[len(buf)-6] = byte(calculated_crc & 0x00ff)
+	buf[len(buf)-5] = byte(calculated_crc >> 8)
 
 	return
+}
+
+// Vector describes an entry of the 8051 reset/interrupt vector table of a firmware image
+type Vector struct {
+	Name    string
+	Address uint16 // code address of the vector (in flash, behind the bootloader)
+	IsLJMP  bool   // false if the vector doesn't hold a long jump (f.e. RETI for unused interrupts)
+	Target  uint16 // jump target, only valid if IsLJMP is true
+}
+
+func (v Vector) String() string {
+	if !v.IsLJMP {
+		return fmt.Sprintf("%#04x %-6s: no LJMP", v.Address, v.Name)
+	}
+	return fmt.Sprintf("%#04x %-6s: LJMP %#04x", v.Address, v.Name, v.Target)
+}
 
+// Vectors8051 lists the standard 8051 vector addresses (relative to the image start) and their names
+var Vectors8051 = []struct {
+	Offset uint16
+	Name   string
+}{
+	{0x00, "RESET"},
+	{0x03, "IE0"},
+	{0x0b, "TF0"},
+	{0x13, "IE1"},
+	{0x1b, "TF1"},
+	{0x23, "RI/TI"},
+	{0x2b, "TF2"},
+}
+
+// Vectors decodes the reset and interrupt vectors at the start of a TI (8051) firmware image. Each vector is
+// expected to hold a LJMP instruction (opcode 0x02, followed by the big endian target address).
+func (f *Firmware) Vectors() (vectors []Vector, err error) {
+	if f.TargetType != FIRMWARE_TARGET_TYPE_TI {
+		return nil, errors.New("vector table only available for CC2544 firmware")
+	}
+
+	for _, v := range Vectors8051 {
+		pos := int(f.StartOffset) + int(v.Offset)
+		vec := Vector{
+			Name:    v.Name,
+			Address: FLASH_IMAGE_START_TI + v.Offset,
+		}
+		if pos+3 > len(f.RawData) {
+			return nil, errors.New(fmt.Sprintf("firmware too short for %s vector at %#04x", v.Name, vec.Address))
+		}
+		if f.RawData[pos] == 0x02 {
+			vec.IsLJMP = true
+			vec.Target = uint16(f.RawData[pos+1])<<8 | uint16(f.RawData[pos+2])
+		}
+		vectors = append(vectors, vec)
+	}
+	return
 }
 
 func (f *Firmware) String() string {
@@ -251,6 +1102,54 @@ func (f *Firmware) String() string {
 	return res
 }
 
+// ExpectedBootloaderVID is the USB VID identifying the bootloader part of firmware blobs (TI at 0x03f8, Nordic at
+// 0x7400+0xbb0). Change it for receivers with rebranded bootloaders.
+var ExpectedBootloaderVID = VID
+
+// detectTIBootloader checks if blob (at least 0x400 bytes) starts with a bootloader. This is the case if the USB VID
+// at 0x03f8 is ExpectedBootloaderVID or, for rebranded receivers, if the trailing bootloader info is plausible: TI
+// bootloader major version (0x03) at 0x03fc and neither VID nor PID erased (0x0000 / 0xffff). As code of an image
+// without bootloader could look plausible, too, heuristic is set in the latter case and the caller has to confirm
+// the bootloader (f.e. by a valid image following it).
+func detectTIBootloader(blob []byte) (vid, pid gousb.ID, found bool, heuristic bool) {
+	if len(blob) < 0x400 {
+		return 0, 0, false, false
+	}
+	vid = gousb.ID(uint16(blob[0x3f9])<<8 | uint16(blob[0x3f8]))
+	pid = gousb.ID(uint16(blob[0x3fb])<<8 | uint16(blob[0x3fa]))
+	if vid == ExpectedBootloaderVID {
+		return vid, pid, true, false
+	}
+	erased := func(id gousb.ID) bool { return id == 0x0000 || id == 0xffff }
+	if blob[0x3fc] == 0x03 && !erased(vid) && !erased(pid) {
+		return vid, pid, true, true
+	}
+	return 0, 0, false, false
+}
+
+// findTIImageEnd searches img (starting at the image start) for the end marker terminating the image. The marker bytes
+// could appear inside code or data, too, thus the first occurrence with a valid CRC in front of it terminates the
+// image. If no occurrence has a valid CRC, the first one is returned with crcValid unset (-1 if there is none).
+// ignored holds the positions of markers skipped because of their CRC.
+func findTIImageEnd(img []byte) (pos int, marker []byte, crcValid bool, ignored []int) {
+	pos = -1
+	for from := 0; ; {
+		emPos, em := nextTIEndMarker(img, from)
+		if emPos < 0 {
+			return
+		}
+		if pos < 0 {
+			// fallback if no occurrence has a valid CRC
+			pos, marker = emPos, em
+		}
+		if stored, calculated := tiImageCRC(img[:emPos+4]); stored == calculated {
+			return emPos, em, true, ignored
+		}
+		ignored = append(ignored, emPos)
+		from = emPos + 1
+	}
+}
+
 func (f *Firmware) ParseFirmwareTI() (err error) {
 	// if a bootloader is present the following data is present
 	// - 0x03f8 uint16, USB VID (LE)
@@ -258,24 +1157,50 @@ func (f *Firmware) ParseFirmwareTI() (err error) {
 	// - 0x03fc byte, BL major
 	// - 0x03fd byte, BL minor
 	// - 0x03fe uint16, BL Build number
+	if len(f.RawData) < 0x0400 {
+		return errors.New("firmware blob too short for Texas Instruments firmware")
+	}
 	assumed_bootloader := f.RawData[:0x0400]
 
 	// check USB VID in order to determine if a BL is prepended to the firmware blob (Logitech VID is 0x046d)
-	if (assumed_bootloader[0x3f8] == 0x6d && assumed_bootloader[0x3f9] == 0x04) {
+	vid, pid, found, heuristic := detectTIBootloader(assumed_bootloader)
+	if found && heuristic {
+		// plausible bootloader info without matching VID, only accepted if a valid image follows the bootloader
+		if _, _, crcValid, _ := findTIImageEnd(trimTrailingFill(f.RawData[0x400:])); !crcValid {
+			logf("...ignoring bootloader info (VID %s, PID %s), no valid image follows\n", vid, pid)
+			found = false
+		}
+	}
+	if found {
 		f.HasBL = true
 		f.StartOffset = 0x400
-		fmt.Println("...firmware blob has a bootloader prepended")
+		f.BootloaderVID, f.BootloaderPID = vid, pid
+		logf("...firmware blob has a bootloader prepended (VID %s, PID %s)\n", vid, pid)
+	} else if isErasedFlash(assumed_bootloader) {
+		// f.e. hex files starting at the image address or dumps of an erased bootloader region, the image keeps its
+		// flash address
+		f.HasBL = false
+		f.StartOffset = FLASH_IMAGE_START_TI
+		f.BootloaderVID, f.BootloaderPID = 0, 0
+		logln("...firmware blob has an erased bootloader region")
 	} else {
 		f.HasBL = false
 		f.StartOffset = 0x0000
-		fmt.Println("...firmware blob has no bootloader prepended")
+		f.BootloaderVID, f.BootloaderPID = 0, 0
+		logln("...firmware blob has no bootloader prepended")
 	}
 
 	// ToDo: The firmware type could be determined from bootloader PID
-	if pos := strings.Index(string(f.RawData[f.StartOffset:]), "\xfe\xc0\xad\xde"); pos < 0 {
+	// try all known end markers. Trailing erased flash is ignored, no matter if the dump represents it as 0xFF or 0x00.
+	pos, marker, _, ignored := findTIImageEnd(trimTrailingFill(f.RawData[f.StartOffset:]))
+	for _, emPos := range ignored {
+		logf("...ignoring end marker at %#04x, CRC doesn't match\n", int(f.StartOffset)+emPos)
+	}
+	if pos < 0 {
 		//can't find magic bytes
 		return errors.New("seems to be no valid Logitech firmware for TI, magic bytes missing")
 	} else {
+		f.EndMarker = append([]byte{}, marker...)
 		f.Size = uint16(pos) + 4
 		f.LastOffset = f.Size + f.StartOffset - 1
 		f.TailPos = f.StartOffset + f.Size - 6
@@ -283,142 +1208,504 @@ func (f *Firmware) ParseFirmwareTI() (err error) {
 
 	//	fmt.Println(f.String())
 
-	// extract CRC
-	f.CRC = uint16(f.RawData[f.TailPos+1])<<8 | uint16(f.RawData[f.TailPos])
-
-	// check CRC
-	calculated_crc := crc16.Checksum(f.RawData[f.StartOffset:f.StartOffset+f.Size-6], crc16.MakeTable(crc16.CRC16_CCITT_FALSE))
-	if calculated_crc != f.CRC {
-		return errors.New(fmt.Sprintf("Firmware has wrong CRC (inteded %#04x, found %#04x)", calculated_crc, f.CRC))
+	// extract and check CRC
+	var calculated_crc uint16
+	f.CRC, calculated_crc = tiImageCRC(f.RawData[f.StartOffset : f.StartOffset+f.Size])
+	f.CRCValid = calculated_crc == f.CRC
+	if !f.CRCValid {
+		if !f.skipCRC {
+			return errors.New(fmt.Sprintf("Firmware has wrong CRC (inteded %#04x, found %#04x)", calculated_crc, f.CRC))
+		}
+		f.ParseReport.CRCMismatch = true
+		logf("Warning: firmware has wrong CRC (inteded %#04x, found %#04x)\n", calculated_crc, f.CRC)
+		return nil
 	}
-	fmt.Printf("...firmware CRC correct: %04x\n", calculated_crc)
+	logf("...firmware CRC correct: %04x\n", calculated_crc)
 
 	return nil
 
 }
 
+// nextTIEndMarker returns the position of the first known end marker in img at or after from, -1 if there is none.
+// Markers starting before offset 2 are skipped, as the CRC has to precede them.
+func nextTIEndMarker(img []byte, from int) (pos int, marker []byte) {
+	if from < 2 {
+		from = 2
+	}
+	pos = -1
+	if from > len(img) {
+		return
+	}
+	for k := range TIEndMarkers {
+		em := TIEndMarkers[k][:]
+		if i := bytes.Index(img[from:], em); i >= 0 && (pos < 0 || from+i < pos) {
+			pos = from + i
+			marker = em
+		}
+	}
+	return
+}
+
+// tiImageCRC returns the CRC stored in a TI image (terminated by CRC and end marker) and the CRC calculated for it
+func tiImageCRC(img []byte) (stored uint16, calculated uint16) {
+	tail := len(img) - 6
+	stored = uint16(img[tail+1])<<8 | uint16(img[tail])
+	calculated = crc16.Checksum(img[:tail], FirmwareCRCTable)
+	return
+}
+
+// isErasedFlash reports if data only consists of 0xFF or only of 0x00 bytes (erased flash, depending on the dump)
+func isErasedFlash(data []byte) bool {
+	if len(data) == 0 || (data[0] != 0xFF && data[0] != 0x00) {
+		return false
+	}
+	for _, b := range data {
+		if b != data[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// trimTrailingFill strips the trailing run of 0xFF or 0x00 bytes (whichever terminates data) from data
+func trimTrailingFill(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	fill := data[len(data)-1]
+	if fill != 0xFF && fill != 0x00 {
+		return data
+	}
+	end := len(data)
+	for end > 0 && data[end-1] == fill {
+		end--
+	}
+	return data[:end]
+}
+
+// nordicCRCCheck checks if data holds a Nordic firmware image of the given size, which is terminated by a valid
+// (big endian) CRC. The CRC stored in the image is returned along with the result.
+func nordicCRCCheck(data []byte, size uint16) (crc uint16, valid bool) {
+	if size < 2 || len(data) < int(size) {
+		return 0, false
+	}
+	crc = uint16(data[size-2])<<8 | uint16(data[size-1])
+	return crc, crc16.Checksum(data[:size-2], FirmwareCRCTable) == crc
+}
+
 func (f *Firmware) ParseFirmwareNordic() (err error) {
 	// check USB VID in order to determine if a BL is prepended to the firmware blob (Logitech VID is 0x046d)
-	if len(f.RawData) > 0x7400 && f.RawData[0x7400+0xbb0] == 0x04 && f.RawData[0x7400+0xbb1] == 0x6d {
+	f.BootloaderVID, f.BootloaderPID = 0, 0
+	if len(f.RawData) > 0x7400+0xbb1 {
+		f.BootloaderVID = gousb.ID(uint16(f.RawData[0x7400+0xbb0])<<8 | uint16(f.RawData[0x7400+0xbb1]))
+	}
+	if f.BootloaderVID == ExpectedBootloaderVID {
 		f.HasBL = true
-		fmt.Println("...firmware blob has a bootloader appended")
+		logln("...firmware blob has a bootloader appended")
 	} else {
 		f.HasBL = false
-		fmt.Println("...firmware blob has no bootloader appended")
+		f.BootloaderVID = 0
+		logln("...firmware blob has no bootloader appended")
 	}
 
-	var crc_calc uint16
-	if len(f.RawData) < 0x6400 {
-		goto invalid_crc
+	// check CRC for each candidate image size, the first match determines the image size (f is only updated then)
+	for _, size := range NordicImageSizes {
+		if crc, valid := nordicCRCCheck(f.RawData, size); valid {
+			f.StartOffset = 0x0000
+			f.Size = size
+			f.LastOffset = size - 1
+			f.CRC = crc
+			f.CRCValid = true
+			logf("...firmware CRC correct: %04x (image size %#04x)\n", crc, size)
+			return nil
+		}
 	}
 
-	// check CRC, assuming image size 0x6400
-	f.StartOffset = 0x0000
-	f.LastOffset = 0x63ff
-	f.Size = 0x6400
-	f.CRC = uint16(f.RawData[f.Size-2])<<8 | uint16(f.RawData[f.Size-1])
+	if f.skipCRC {
+		// no size validates, assume the largest one fitting the data
+		for i := len(NordicImageSizes) - 1; i >= 0; i-- {
+			size := NordicImageSizes[i]
+			if len(f.RawData) < int(size) {
+				continue
+			}
+			f.StartOffset = 0x0000
+			f.Size = size
+			f.LastOffset = size - 1
+			f.CRC, _ = nordicCRCCheck(f.RawData, size)
+			f.CRCValid = false
+			f.ParseReport.CRCMismatch = true
+			logf("Warning: no valid firmware CRC found, assuming image size %#04x\n", size)
+			return nil
+		}
+	}
 
-	crc_calc = crc16.Checksum(f.RawData[:f.Size-2], crc16.MakeTable(crc16.CRC16_CCITT_FALSE))
-	if crc_calc == f.CRC {
-		fmt.Printf("...firmware CRC correct: %04x\n", crc_calc)
-		return nil
+	return errors.New("No valid firmware image")
+}
+
+// FirmwareFromBytes parses a raw firmware blob (with or without bootloader), it is the counterpart of Firmware.Bytes
+func FirmwareFromBytes(blob []byte) (f *Firmware, err error) {
+	return ParseFirmwareBin(blob)
+}
+
+// Bytes returns a copy of the canonical raw image of the firmware, so that FirmwareFromBytes(f.Bytes()) results in
+// an equivalent Firmware (the signature of .shex files isn't part of the raw image). For TI firmware this is the
+// bootloader (or the erased bootloader region, if present) followed by the image up to the end marker. For Nordic firmware the whole blob is kept, as
+// the bootloader is located behind the image.
+func (f *Firmware) Bytes() []byte {
+	data := f.RawData
+	if f.TargetType == FIRMWARE_TARGET_TYPE_TI && int(f.StartOffset)+int(f.Size) <= len(data) {
+		data = data[:int(f.StartOffset)+int(f.Size)]
 	}
+	return append([]byte{}, data...)
+}
+
+// WriteBin writes the canonical raw image (see Bytes) as flat binary to w, the output could be read back with
+// ParseFirmwareBin
+func (f *Firmware) WriteBin(w io.Writer) (err error) {
+	_, err = w.Write(f.Bytes())
+	return
+}
 
-	if len(f.RawData) < 0x6800 {
-		goto invalid_crc
+// WriteTo implements io.WriterTo, it writes the canonical raw image (see Bytes) to w and returns the number of bytes
+// written. Errors of w are wrapped, thus they could be checked with errors.Is.
+func (f *Firmware) WriteTo(w io.Writer) (n int64, err error) {
+	data := f.Bytes()
+	written, err := w.Write(data)
+	n = int64(written)
+	if err == nil && written != len(data) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		return n, fmt.Errorf("writing firmware image failed after %d of %d bytes: %w", written, len(data), err)
 	}
+	return n, nil
+}
 
-	// repeat CRC check, assuming image size 0x6800
-	f.StartOffset = 0x0000
-	f.LastOffset = 0x67ff
-	f.Size = 0x6800
-	f.CRC = uint16(f.RawData[f.Size-2])<<8 | uint16(f.RawData[f.Size-1])
+// HexConvention selects the record types used by WriteHex
+type HexConvention byte
 
-	crc_calc = crc16.Checksum(f.RawData[:f.Size-2], crc16.MakeTable(crc16.CRC16_CCITT_FALSE))
-	if crc_calc == f.CRC {
-		fmt.Printf("...firmware CRC correct: %04x\n", crc_calc)
-		return nil
+const (
+	HEX_CONVENTION_INTEL    HexConvention = 0x00 // data records (target byte 0x00) and end-of-file record only
+	HEX_CONVENTION_LOGITECH HexConvention = 0x01 // like Intel, plus the signature as records with target byte 0xfd (.shex)
+)
+
+// HEX_RECORD_TYPE_SIGNATURE is the record type (target byte) of signature data in Logitech .shex files
+const HEX_RECORD_TYPE_SIGNATURE byte = 0xfd
+
+// HexWriteOptions control WriteHex. The zero value writes standard Intel hex with 16 data bytes per record.
+type HexWriteOptions struct {
+	RecordLength byte   // data bytes per record, 0 for 16
+	BaseAddress  uint16 // load address of the first byte of the canonical raw image (see Bytes)
+	Convention   HexConvention
+}
+
+// WriteHex writes the canonical raw image (see Bytes) as Intel hex to w. The output only depends on the firmware
+// and the options, it could be read back with ParseFirmwareHex. With HEX_CONVENTION_LOGITECH, the signature (if
+// present) is written as records with target byte 0xfd, otherwise it is omitted.
+func (f *Firmware) WriteHex(w io.Writer, opts HexWriteOptions) (err error) {
+	recLen := int(opts.RecordLength)
+	if recLen == 0 {
+		recLen = 16
+	}
+	data := f.Bytes()
+	if int(opts.BaseAddress)+len(data) > 0x10000 {
+		return errors.New(fmt.Sprintf("firmware of size %#04x doesn't fit into 16 bit address space at %#04x", len(data), opts.BaseAddress))
 	}
 
-invalid_crc:
-	return errors.New("No valid firmware image")
+	bw := bufio.NewWriter(w)
+	writeRecords := func(recType byte, base int, data []byte) {
+		for pos := 0; pos < len(data); pos += recLen {
+			end := pos + recLen
+			if end > len(data) {
+				end = len(data)
+			}
+			addr := base + pos
+			rec := append([]byte{byte(end - pos), byte(addr >> 8), byte(addr), recType}, data[pos:end]...)
+			sum := byte(0)
+			for _, b := range rec {
+				sum += b
+			}
+			fmt.Fprintf(bw, ":%X%02X\n", rec, -sum)
+		}
+	}
+	writeRecords(0x00, int(opts.BaseAddress), data)
+	if opts.Convention == HEX_CONVENTION_LOGITECH && f.HasSignature {
+		writeRecords(HEX_RECORD_TYPE_SIGNATURE, 0, f.Signature[:])
+	}
+	fmt.Fprintln(bw, ":00000001FF")
+	return bw.Flush()
+}
+
+// WriteBaseImageBin writes only the base image (no bootloader) as flat binary to w. For TI firmware this is the
+// flash content from the firmware start address up to (and including) CRC and end marker, as written by the
+// bootloader. The output could be read back with ParseFirmwareBin.
+func (f *Firmware) WriteBaseImageBin(w io.Writer) (err error) {
+	img, err := f.BaseImage()
+	if err != nil {
+		return
+	}
+	_, err = w.Write(img)
+	return
 }
 
 func ParseFirmwareBin(binblob []byte) (f *Firmware, err error) {
-	fmt.Println("Parsing raw firmware blob ...")
+	return ParseFirmwareBinWithOptions(binblob, BinParseOptions{})
+}
+
+// ParseFirmwareBinAs parses a raw firmware blob with the parser for target, bypassing the auto detection of
+// ParseFirmwareBin. This helps with images misdetected by the heuristics, the detailed error of the parser is returned.
+func ParseFirmwareBinAs(binblob []byte, target FirmwareTargetType) (f *Firmware, err error) {
+	return ParseFirmwareBinWithOptions(binblob, BinParseOptions{Target: target})
+}
+
+func ParseFirmwareBinWithOptions(binblob []byte, opts BinParseOptions) (f *Firmware, err error) {
+	logln("Parsing raw firmware blob ...")
 	f = &Firmware{}
 	f.RawData = binblob
+	f.skipCRC = opts.SkipCRC
 
 	f.TargetType = FIRMWARE_TARGET_TYPE_UNKNOWN
+	switch opts.Target {
+	case FIRMWARE_TARGET_TYPE_UNKNOWN:
+	case FIRMWARE_TARGET_TYPE_TI:
+		err = f.ParseFirmwareTI()
+	case FIRMWARE_TARGET_TYPE_NORDIC:
+		err = f.ParseFirmwareNordic()
+	default:
+		return nil, errors.New(fmt.Sprintf("no parser for firmware target type %#02x", byte(opts.Target)))
+	}
+	if opts.Target != FIRMWARE_TARGET_TYPE_UNKNOWN {
+		if err != nil {
+			return nil, err
+		}
+		f.TargetType = opts.Target
+		logf("...firmware parsed as %s firmware (forced)\n", opts.Target)
+		return f, nil
+	}
+
 	err = f.ParseFirmwareTI()
 	if err != nil {
-		fmt.Printf("No Texas Instruments firmware: %v\n", err)
+		logf("No Texas Instruments firmware: %v\n", err)
 		// seems to be no TI firmware, try to parse as Nordic
 		errNordic := f.ParseFirmwareNordic()
 		if errNordic != nil {
-			fmt.Printf("No Nordic firmware: %v\n", errNordic)
+			logf("No Nordic firmware: %v\n", errNordic)
 			return nil, errors.New("unsupported firmware format - neither nordic, nor TI")
 		}
-		fmt.Println("...provided firmware targets Nordic based receiver")
+		logln("...provided firmware targets Nordic based receiver")
 		f.TargetType = FIRMWARE_TARGET_TYPE_NORDIC
 	} else {
 		f.TargetType = FIRMWARE_TARGET_TYPE_TI
-		fmt.Println("...provided firmware targets Texas Instruments based receiver")
+		logln("...provided firmware targets Texas Instruments based receiver")
 	}
 
 	return f, nil
 }
 
-func ParseFirmwareHex(ihex_file_path string) (f *Firmware, err error) {
-	fmt.Printf("Parsing firmware hex file '%s'\n", ihex_file_path)
+// CombineBootloaderAndApp builds a full image for TI based receivers, from a bootloader blob (f.e. a dump) and an
+// application firmware without bootloader. The bootloader occupies 0x0000..0x03ff (the bootloader info at 0x03f8 is
+// checked), the application base image is placed directly behind it, at 0x0400. The combined blob is parsed again,
+// so the result has passed the CRC and end marker checks.
+func CombineBootloaderAndApp(bl []byte, app *Firmware) (f *Firmware, err error) {
+	if app == nil || app.TargetType != FIRMWARE_TARGET_TYPE_TI {
+		return nil, errors.New("combining bootloader and application is only supported for CC2544 firmware")
+	}
+	if len(bl) < 0x400 {
+		return nil, errors.New(fmt.Sprintf("bootloader blob too short (%#x bytes, needs %#x)", len(bl), 0x400))
+	}
+	if _, _, found, _ := detectTIBootloader(bl); !found {
+		return nil, errors.New("bootloader blob has no bootloader info (VID, PID, version) at 0x03f8")
+	}
+	if app.HasBL {
+		return nil, errors.New("application firmware already has a bootloader prepended")
+	}
 
-	file, err := os.Open(ihex_file_path)
+	img, err := app.BaseImage()
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	combined := make([]byte, 0x400+len(img))
+	copy(combined, bl[:0x400])
+	copy(combined[0x400:], img)
 
-	f = &Firmware{}
+	f, err = ParseFirmwareBin(combined)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("combined image is invalid: %v", err))
+	}
+	if f.TargetType != FIRMWARE_TARGET_TYPE_TI || !f.HasBL {
+		return nil, errors.New("combined image isn't recognized as CC2544 firmware with bootloader")
+	}
+	if app.HasSignature {
+		f.Signature = app.Signature
+		f.HasSignature = true
+	}
+	return f, nil
+}
+
+func ParseFirmwareHex(ihex_file_path string) (f *Firmware, err error) {
+	return ParseFirmwareHexWithOptions(ihex_file_path, HexParseOptions{})
+}
+
+// ParseFirmwareHexStrict parses an Intel .hex firmware file like ParseFirmwareHex, but fails on the first line which
+// can't be decoded or has an invalid record checksum, instead of skipping it
+func ParseFirmwareHexStrict(ihex_file_path string) (f *Firmware, err error) {
+	return ParseFirmwareHexWithOptions(ihex_file_path, HexParseOptions{AbortOnInvalidLine: true})
+}
+
+// checkHexRecord validates length and checksum of a decoded Intel hex record (the sum of all bytes, including the
+// trailing checksum byte, has to be 0x00)
+func checkHexRecord(record []byte) error {
+	if len(record) < 5 {
+		return errors.New("record too short")
+	}
+	if len(record) != int(record[0])+5 {
+		return errors.New(fmt.Sprintf("record length mismatch, %d data bytes announced", record[0]))
+	}
+	sum := byte(0)
+	for _, b := range record {
+		sum += b
+	}
+	if sum != 0 {
+		return errors.New(fmt.Sprintf("record checksum mismatch (%#02x)", record[len(record)-1]))
+	}
+	return nil
+}
 
-	scanner := bufio.NewScanner(file)
+// errStopHexScan could be returned by the callback of scanHexRecords to end the scan early, without error
+var errStopHexScan = errors.New("stop hex scan")
+
+// scanHexRecords reads the Intel hex file r line by line and calls fn for each decoded record of interest (firmware
+// data 0x00 and signature data 0xfd), along with its line number. The record is only valid during the call. Blank
+// lines, lines without record mark (f.e. comments) and other record types are skipped, lines which can't be decoded
+// are skipped too, unless abortOnInvalidLine is set (the record checksum is only validated in this case). The scan
+// ends with the first error returned by fn.
+func scanHexRecords(r io.Reader, abortOnInvalidLine bool, fn func(record []byte, lineNo int) error) (err error) {
+	scanner := bufio.NewScanner(r)
 	lineNo := 0
+	var hbuf []byte // decoded records, reused for all lines
 	for scanner.Scan() {
 		lineNo++
-		line := scanner.Text()[1:]
-		hbytes, err := hex.DecodeString(line)
+		// tolerate CRLF line endings, surrounding whitespace and blank lines
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] != ':' {
+			logf("Skip line %d without record mark: %s\n", lineNo, line)
+			continue
+		}
+		line = line[1:]
+		if cap(hbuf) < hex.DecodedLen(len(line)) {
+			hbuf = make([]byte, hex.DecodedLen(len(line)))
+		}
+		n, err := hex.Decode(hbuf[:cap(hbuf)], line)
+		hbytes := hbuf[:n]
+		if err == nil && abortOnInvalidLine {
+			err = checkHexRecord(hbytes)
+		}
 		if err != nil {
-			fmt.Printf("Skip invalid line %d: %s\n", lineNo, line)
+			if abortOnInvalidLine {
+				return errors.New(fmt.Sprintf("invalid line %d: %s (%v)", lineNo, scanner.Text(), err))
+			}
+			logf("Skip invalid line %d: %s\n", lineNo, line)
 			continue
 		}
 		if len(hbytes) < 4 || (hbytes[3] != 0x00 && hbytes[3] != 0xfd) {
 			// skip lines which are too short or out of interest
 			continue
 		}
+		if err = fn(hbytes, lineNo); err == errStopHexScan {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// PeekFirmwareHexHasSignature reports if the Intel hex file at path contains signature records (record type 0xfd,
+// as used by .shex files), without parsing the firmware. The file is read up to the first signature record, lines
+// which can't be decoded are skipped like with ParseFirmwareHex.
+func PeekFirmwareHexHasSignature(path string) (hasSignature bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	err = scanHexRecords(file, false, func(record []byte, lineNo int) error {
+		if record[3] == 0xfd {
+			hasSignature = true
+			return errStopHexScan
+		}
+		return nil
+	})
+	return
+}
+
+func ParseFirmwareHexWithOptions(ihex_file_path string, opts HexParseOptions) (f *Firmware, err error) {
+	logf("Parsing firmware hex file '%s'\n", ihex_file_path)
+
+	file, err := os.Open(ihex_file_path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseFirmwareHexReader(file, opts)
+}
+
+// ParseFirmwareHexReader parses Intel hex firmware data read from r, like ParseFirmwareHexWithOptions does for files
+func ParseFirmwareHexReader(r io.Reader, opts HexParseOptions) (f *Firmware, err error) {
+	f = &Firmware{}
+	f.skipCRC = opts.SkipCRC
+
+	err = scanHexRecords(r, opts.AbortOnInvalidLine, func(hbytes []byte, lineNo int) error {
 		//fmt.Printf("%4d: % 02x\n", lineNo, hbytes)
-		f.pushRawHexLine(hbytes)
+		numOverlaps := len(f.ParseReport.Overlaps)
+		if ePush := f.pushRawHexLine(hbytes, lineNo, opts.fillByte()); ePush != nil {
+			logf("Skip invalid line %d: %v\n", lineNo, ePush)
+			return nil
+		}
+		if len(f.ParseReport.Overlaps) > numOverlaps {
+			o := f.ParseReport.Overlaps[numOverlaps]
+			if opts.RejectOverlaps {
+				return errors.New(fmt.Sprintf("line %d: record at %#04x (%d bytes) overwrites data of an earlier record", o.Line, o.Addr, o.Length))
+			}
+			logf("Warning: line %d: record at %#04x (%d bytes) overwrites data of an earlier record\n", o.Line, o.Addr, o.Length)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	f.coverageFromHexWritten()
+	f.hexWritten = nil
 
-	// trim down firmware to get rid of prepended data
-	f.RawData = f.RawData[f.StartOffset:f.StartOffset+f.Size]
+	if len(f.RawData) == 0 || f.Size == 0 {
+		return nil, errors.New("no firmware data records found")
+	}
 
-	//fmt.Printf("FWIRMWAR\n%02x\n", f.RawData)
+	// RawData keeps the record addresses (a gap in front of the first record is filled), so the result equals the
+	// one of ParseFirmwareBin for a flat binary of the same flash content. A TI image starting at its flash address
+	// (no bootloader records) is detected by the erased bootloader region.
 
-	fmt.Println("Determin firmware type...")
+	logln("Determin firmware type...")
 	f.TargetType = FIRMWARE_TARGET_TYPE_UNKNOWN
 	err = f.ParseFirmwareTI()
 	if err != nil {
-		fmt.Printf("No Texas Instruments firmware: %v\n", err)
+		logf("No Texas Instruments firmware: %v\n", err)
 		// seems to be no TI firmware, try to parse as Nordic
 		errNordic := f.ParseFirmwareNordic()
 		if errNordic != nil {
-			fmt.Printf("No Nordic firmware: %v\n", errNordic)
+			logf("No Nordic firmware: %v\n", errNordic)
 			return nil, errors.New("unsupported firmware format - neither nordic, nor TI")
 		}
-		fmt.Println("Provided firmware targets Nordic based receiver")
+		logln("Provided firmware targets Nordic based receiver")
 		f.TargetType = FIRMWARE_TARGET_TYPE_NORDIC
 	} else {
 		f.TargetType = FIRMWARE_TARGET_TYPE_TI
-		fmt.Println("Provided firmware targets Texas Instruments based receiver")
+		logln("Provided firmware targets Texas Instruments based receiver")
 	}
 
 	return f, nil
@@ -0,0 +1,882 @@
+package unifying
+
+import (
+	"bytes"
+	"github.com/sigurn/crc16"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testTIImage builds a TI base image of the given size: LJMP reset vector, version string, erased free space, CRC and
+// end marker
+func testTIImage(size int) []byte {
+	img := bytes.Repeat([]byte{0xFF}, size)
+	copy(img, []byte{0x02, 0x05, 0x00})
+	copy(img[0x100:], "RQR24.07_B0030")
+	copy(img[size-4:], TIEndMarkers[0][:])
+	updateTestTICRC(img)
+	return img
+}
+
+// updateTestTICRC recomputes the CRC in front of the end marker of a TI base image
+func updateTestTICRC(img []byte) {
+	crc := crc16.Checksum(img[:len(img)-6], FirmwareCRCTable)
+	img[len(img)-6] = byte(crc)
+	img[len(img)-5] = byte(crc >> 8)
+}
+
+// testTIBootloader builds a 0x400 byte bootloader region with Logitech VID, TI bootloader PID and version BOT03.02
+func testTIBootloader() []byte {
+	bl := bytes.Repeat([]byte{0xFF}, 0x400)
+	copy(bl, []byte{0x02, 0x00, 0x80})
+	copy(bl[0x3f8:], []byte{byte(VID & 0xff), byte(VID >> 8), byte(PID_BOOT_LOADER_TI & 0xff), byte(PID_BOOT_LOADER_TI >> 8), 0x03, 0x02, 0x00, 0x07})
+	return bl
+}
+
+func testHex(t *testing.T, f *Firmware, base uint16) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := f.WriteHex(buf, HexWriteOptions{BaseAddress: base}); err != nil {
+		t.Fatalf("writing hex failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func mustParseBin(t *testing.T, blob []byte) *Firmware {
+	t.Helper()
+	f, err := ParseFirmwareBin(blob)
+	if err != nil {
+		t.Fatalf("parsing bin failed: %v", err)
+	}
+	return f
+}
+
+func TestParseFirmwareHexMatchesBin(t *testing.T) {
+	img := testTIImage(0x6000)
+	erased := bytes.Repeat([]byte{0xFF}, 0x400)
+
+	tests := []struct {
+		name        string
+		hexFrom     []byte // blob converted to hex
+		hexBase     uint16 // load address of the hex records
+		bin         []byte // flat binary of the same flash content
+		startOffset uint16
+		hasBL       bool
+	}{
+		{"hex at 0x0000", img, 0x0000, img, 0x0000, false},
+		{"hex at 0x0400", img, 0x0400, append(append([]byte{}, erased...), img...), FLASH_IMAGE_START_TI, false},
+		{"full image with bootloader", append(testTIBootloader(), img...), 0x0000, append(testTIBootloader(), img...), FLASH_IMAGE_START_TI, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hexData := testHex(t, mustParseBin(t, tt.hexFrom), tt.hexBase)
+			fromHex, err := ParseFirmwareHexReader(bytes.NewReader(hexData), HexParseOptions{})
+			if err != nil {
+				t.Fatalf("parsing hex failed: %v", err)
+			}
+			fromBin := mustParseBin(t, tt.bin)
+
+			if !fromHex.Equal(fromBin) {
+				t.Errorf("hex and bin parse differ:\nhex: %s bin: %s", fromHex, fromBin)
+			}
+			if fromHex.StartOffset != tt.startOffset || fromHex.HasBL != tt.hasBL {
+				t.Errorf("StartOffset %#04x HasBL %v, want %#04x %v", fromHex.StartOffset, fromHex.HasBL, tt.startOffset, tt.hasBL)
+			}
+			hexImg, errHex := fromHex.BaseImage()
+			binImg, errBin := fromBin.BaseImage()
+			if errHex != nil || errBin != nil {
+				t.Fatalf("base image unavailable: %v / %v", errHex, errBin)
+			}
+			if !bytes.Equal(hexImg, img) || !bytes.Equal(binImg, img) {
+				t.Error("base image doesn't match the original image")
+			}
+			vHex, errHex := fromHex.Version()
+			vBin, errBin := fromBin.Version()
+			if errHex != nil || errBin != nil || vHex != vBin {
+				t.Errorf("version differs: %v (%v) / %v (%v)", vHex, errHex, vBin, errBin)
+			}
+			if !bytes.Equal(fromHex.Bytes(), fromBin.Bytes()) {
+				t.Error("canonical raw images differ")
+			}
+		})
+	}
+}
+
+func TestParseFirmwareHexLineEndings(t *testing.T) {
+	want := mustParseBin(t, testTIImage(0x6000))
+	lf := string(testHex(t, want, 0x0000))
+	const eof = ":00000001FF\n"
+	withoutEOF := lf[:len(lf)-len(eof)]
+	crlf := strings.Replace(lf, "\n", "\r\n", -1)
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"LF", lf},
+		{"CRLF", crlf},
+		{"no trailing newline", lf[:len(lf)-1]},
+		{"CRLF without trailing newline", crlf[:len(crlf)-2]},
+		{"no EOF record", withoutEOF},
+		{"no EOF record, no trailing newline", withoutEOF[:len(withoutEOF)-1]},
+		// record announcing 16 data bytes at 0x7000, cut off after 2 of them
+		{"truncated last line", withoutEOF + ":10700000FFFF"},
+		{"truncated first line", ":10000000FFFF\n" + lf},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseFirmwareHexReader(strings.NewReader(tt.data), HexParseOptions{})
+			if err != nil {
+				t.Fatalf("parsing failed: %v", err)
+			}
+			if !f.Equal(want) || !f.CRCValid {
+				t.Errorf("parse differs from newline terminated file: %s (CRC valid %v)", f, f.CRCValid)
+			}
+		})
+	}
+}
+
+func TestParseFirmwareHexTruncatedRecordStrict(t *testing.T) {
+	lf := string(testHex(t, mustParseBin(t, testTIImage(0x6000)), 0x0000))
+	_, err := ParseFirmwareHexReader(strings.NewReader(lf+":10700000FFFF"), HexParseOptions{AbortOnInvalidLine: true})
+	if err == nil {
+		t.Error("truncated record accepted in strict mode")
+	}
+}
+
+func TestParseFirmwareHexTruncatedRecordKeepsPreviousData(t *testing.T) {
+	// the decode buffer is reused between lines, a truncated record must not pick up bytes of the previous one
+	data := ":10000000000102030405060708090A0B0C0D0E0F78\n:10001000AABB\n"
+	f := &Firmware{}
+	err := scanHexRecords(strings.NewReader(data), false, func(record []byte, lineNo int) error {
+		f.pushRawHexLine(record, lineNo, DEFAULT_FILL_BYTE)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.RawData) != 0x10 {
+		t.Errorf("raw data has %#x bytes, truncated record wasn't rejected", len(f.RawData))
+	}
+}
+
+func BenchmarkParseFirmwareBin(b *testing.B) {
+	blob := append(testTIBootloader(), testTIImage(0x6000)...)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(blob)))
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseFirmwareBin(blob); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseFirmwareTIEndMarker(t *testing.T) {
+	f := mustParseBin(t, testTIImage(0x6000))
+	if !bytes.Equal(f.EndMarker, TIEndMarkers[0][:]) {
+		t.Errorf("end marker % 02x, want % 02x", f.EndMarker, TIEndMarkers[0])
+	}
+
+	downgraded, err := f.BaseImageDowngradeFromBL0302ToBL0301()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(downgraded, f.EndMarker) {
+		t.Errorf("downgraded image ends with % 02x, want end marker % 02x", downgraded[len(downgraded)-4:], f.EndMarker)
+	}
+
+	noMarker := testTIImage(0x6000)
+	copy(noMarker[len(noMarker)-4:], []byte{0x01, 0x02, 0x03, 0x04})
+	if _, err := ParseFirmwareBinAs(noMarker, FIRMWARE_TARGET_TYPE_TI); err == nil {
+		t.Error("image without end marker parsed as TI firmware")
+	}
+}
+
+// testTIImageWithDeviceDataAccess returns a BOT03.02 image holding every pattern of the downgrade patch set, some of
+// them overlapping
+func testTIImageWithDeviceDataAccess() []byte {
+	img := testTIImage(int(DOWNGRADE_SOURCE_SIZE_TI))
+	pos := 0x400
+	for _, p := range DowngradeBL0302ToBL0301Patches {
+		pos += copy(img[pos:], p.From) + 1
+	}
+	copy(img[0x500:], []byte{0x05, 0x79, 0x19, 0x7f, 0x1a, 0x79, 0x7f, 0x90, 0xe4, 0x00, 0xe0})
+	updateTestTICRC(img)
+	return img
+}
+
+func TestDowngradeMatchesSequentialReplace(t *testing.T) {
+	img := testTIImageWithDeviceDataAccess()
+	f := mustParseBin(t, img)
+	downgraded, err := f.BaseImageDowngradeFromBL0302ToBL0301()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// reference: resize, then apply the patch set with bytes.Replace one patch after the other
+	want := append(append([]byte{}, img[:len(img)-6]...), bytes.Repeat([]byte{0xFF}, int(DOWNGRADE_TARGET_SIZE_TI-DOWNGRADE_SOURCE_SIZE_TI)+6)...)
+	for _, p := range DowngradeBL0302ToBL0301Patches {
+		want = bytes.Replace(want, p.From, p.To, -1)
+	}
+	copy(want[len(want)-4:], TIEndMarkers[0][:])
+	updateTestTICRC(want)
+
+	if !bytes.Equal(downgraded, want) {
+		t.Errorf("downgraded image differs from sequential replace: %v", DiffImages(0, want, downgraded))
+	}
+}
+
+func BenchmarkBaseImageDowngradeFromBL0302ToBL0301(b *testing.B) {
+	f, err := ParseFirmwareBin(testTIImageWithDeviceDataAccess())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := f.BaseImageDowngradeFromBL0302ToBL0301(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// testNordicImage builds a Nordic image of the given size, terminated by its big endian CRC
+func testNordicImage(size uint16) []byte {
+	img := make([]byte, size)
+	for i := range img {
+		img[i] = byte(i * 7)
+	}
+	crc := crc16.Checksum(img[:size-2], FirmwareCRCTable)
+	img[size-2] = byte(crc >> 8)
+	img[size-1] = byte(crc)
+	return img
+}
+
+func TestParseFirmwareNordicImageSizes(t *testing.T) {
+	for _, size := range NordicImageSizes {
+		img := testNordicImage(size)
+		// data behind the image (f.e. erased flash) doesn't change the size
+		blob := append(append([]byte{}, img...), bytes.Repeat([]byte{0xFF}, 0x7400-int(size))...)
+		f, err := ParseFirmwareBin(blob)
+		if err != nil {
+			t.Errorf("image of size %#04x: %v", size, err)
+			continue
+		}
+		if f.TargetType != FIRMWARE_TARGET_TYPE_NORDIC || f.Size != size || f.LastOffset != size-1 || !f.CRCValid {
+			t.Errorf("image of size %#04x parsed as %s firmware of size %#04x", size, f.TargetType, f.Size)
+		}
+	}
+
+	if _, err := ParseFirmwareBinAs(testNordicImage(0x5000), FIRMWARE_TARGET_TYPE_NORDIC); err == nil {
+		t.Error("image smaller than all candidate sizes accepted")
+	}
+}
+
+func TestParseFirmwareNordicKeepsFirmwareOnFailedCandidates(t *testing.T) {
+	// the 0x6000 and 0x6400 candidates fail, the 0x6800 one validates
+	img := testNordicImage(0x6800)
+	if _, valid := nordicCRCCheck(img, 0x6400); valid {
+		t.Fatal("0x6400 candidate validates, test image unusable")
+	}
+	f := &Firmware{RawData: img}
+	if err := f.ParseFirmwareNordic(); err != nil || f.Size != 0x6800 || f.CRC != uint16(img[0x67fe])<<8|uint16(img[0x67ff]) {
+		t.Errorf("parsed size %#04x CRC %#04x (%v), want size 0x6800", f.Size, f.CRC, err)
+	}
+
+	// no candidate validates, the firmware isn't touched
+	img[0x100] ^= 0xff
+	f = &Firmware{RawData: img, Size: 0x1234, CRC: 0x5678, LastOffset: 0x1233}
+	if err := f.ParseFirmwareNordic(); err == nil {
+		t.Fatal("corrupted image accepted")
+	}
+	if f.Size != 0x1234 || f.CRC != 0x5678 || f.LastOffset != 0x1233 || f.CRCValid {
+		t.Errorf("failed parse modified the firmware: size %#04x CRC %#04x", f.Size, f.CRC)
+	}
+}
+
+func TestParseFirmwareHexWithoutDataRecords(t *testing.T) {
+	f := &Firmware{Signature: [256]byte{0x01}, HasSignature: true}
+	buf := &bytes.Buffer{}
+	if err := f.WriteHex(buf, HexWriteOptions{Convention: HEX_CONVENTION_LOGITECH}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFirmwareHexReader(buf, HexParseOptions{}); err == nil {
+		t.Error("hex file holding only signature records accepted")
+	}
+	if _, err := ParseFirmwareHexReader(strings.NewReader(":00000001FF\n"), HexParseOptions{}); err == nil {
+		t.Error("hex file holding only an EOF record accepted")
+	}
+}
+
+func TestFirmwareBytesRoundTrip(t *testing.T) {
+	img := testTIImage(0x6000)
+	tests := []struct {
+		name string
+		blob []byte
+		want []byte // canonical raw image
+	}{
+		{"TI with bootloader", append(testTIBootloader(), img...), append(testTIBootloader(), img...)},
+		{"TI without bootloader", img, img},
+		{"TI with trailing data", append(append([]byte{}, img...), bytes.Repeat([]byte{0xFF}, 0x800)...), img},
+		{"Nordic", testNordicImage(0x6400), testNordicImage(0x6400)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := FirmwareFromBytes(tt.blob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw := f.Bytes()
+			if !bytes.Equal(raw, tt.want) {
+				t.Errorf("Bytes returned %#x bytes, want %#x", len(raw), len(tt.want))
+			}
+			raw[0] ^= 0xff
+			if bytes.Equal(f.Bytes(), raw) {
+				t.Error("Bytes doesn't return a copy")
+			}
+			raw[0] ^= 0xff
+
+			again, err := FirmwareFromBytes(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.Size != f.Size || again.StartOffset != f.StartOffset || again.HasBL != f.HasBL || again.CRC != f.CRC || again.TargetType != f.TargetType {
+				t.Errorf("round trip changed the firmware: %s -> %s", f, again)
+			}
+		})
+	}
+}
+
+func TestParseFirmwareZeroErasedFlash(t *testing.T) {
+	img := testTIImage(0x6000)
+
+	// raw image followed by zeros
+	f, err := ParseFirmwareBin(append(append([]byte{}, img...), make([]byte, 0x2000)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Size != 0x6000 || !f.CRCValid {
+		t.Errorf("image followed by zeros: size %#04x", f.Size)
+	}
+
+	// hex file with a gap between records (the erased free space of the image), filled with 0x00
+	zeroImg := append([]byte{}, img...)
+	for i := 0x200; i < 0x5f00; i++ {
+		zeroImg[i] = 0x00
+	}
+	updateTestTICRC(zeroImg)
+	hexData := string(testHex(t, mustParseBin(t, zeroImg), 0x0000))
+	var records []string
+	for _, line := range strings.SplitAfter(hexData, "\n") {
+		// drop the records of the gap
+		if len(line) > 7 {
+			if addr, _ := strconv.ParseUint(line[3:7], 16, 16); addr >= 0x200 && addr < 0x5f00 {
+				continue
+			}
+		}
+		records = append(records, line)
+	}
+	zero := byte(0x00)
+	f, err = ParseFirmwareHexReader(strings.NewReader(strings.Join(records, "")), HexParseOptions{FillByte: &zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.CRCValid || !bytes.Equal(f.RawData, zeroImg) {
+		t.Error("gap isn't filled with 0x00")
+	}
+	if cov := f.CoverageRanges(); len(cov) != 2 || cov[0].End != 0x1ff || cov[1].Start != 0x5f00 {
+		t.Errorf("coverage %v, want the gap 0x0200-0x5eff to be uncovered", cov)
+	}
+
+	if _, err := ParseFirmwareBinAs(make([]byte, 0x100), FIRMWARE_TARGET_TYPE_TI); err == nil {
+		t.Error("blob shorter than the bootloader region accepted")
+	}
+}
+
+func BenchmarkParseFirmwareHexReader(b *testing.B) {
+	f, err := ParseFirmwareBin(testTIImage(0x6800))
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err = f.WriteHex(buf, HexWriteOptions{BaseAddress: FLASH_IMAGE_START_TI}); err != nil {
+		b.Fatal(err)
+	}
+	hexData := buf.Bytes()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseFirmwareHexReader(bytes.NewReader(hexData), HexParseOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseFirmwareTIEndMarkerInsideImage(t *testing.T) {
+	img := testTIImage(0x6000)
+	copy(img[0x602:], TIEndMarkers[0][:])
+	updateTestTICRC(img)
+
+	f, err := ParseFirmwareBin(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Size != 0x6000 || !f.CRCValid {
+		t.Errorf("image cut at end marker inside code: size %#04x", f.Size)
+	}
+
+	// without a valid CRC, the first occurrence terminates the image (and fails the CRC check)
+	img[0x10] ^= 0xff
+	if _, err = ParseFirmwareBin(img); err == nil {
+		t.Error("image with invalid CRC accepted")
+	}
+	f, err = ParseFirmwareBinWithOptions(img, BinParseOptions{SkipCRC: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Size != 0x606 || f.CRCValid {
+		t.Errorf("image with invalid CRC and SkipCRC: size %#04x, want 0x0606", f.Size)
+	}
+}
+
+func TestParseFirmwareHexRecordMark(t *testing.T) {
+	want := mustParseBin(t, testTIImage(0x6000))
+	lf := string(testHex(t, want, 0x0000))
+	messy := "# exported firmware\n\n" + strings.Replace(lf, "\n", "  \r\n\r\n", -1)
+
+	f, err := ParseFirmwareHexReader(strings.NewReader(messy), HexParseOptions{AbortOnInvalidLine: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Equal(want) {
+		t.Error("comments, blank lines and trailing whitespace changed the parse")
+	}
+
+	// a record without record mark isn't decoded with its first character dropped
+	noMark := strings.Replace(lf, ":", "", 1)
+	if f, err = ParseFirmwareHexReader(strings.NewReader(noMark), HexParseOptions{SkipCRC: true}); err != nil {
+		t.Fatal(err)
+	}
+	if f.Equal(want) || f.RawData[0] != 0xFF {
+		t.Error("line without record mark wasn't skipped")
+	}
+}
+
+func TestBaseImageOutOfRange(t *testing.T) {
+	f := &Firmware{RawData: make([]byte, 0x100), StartOffset: 0xfff0, Size: 0x100}
+	if _, err := f.BaseImage(); err == nil {
+		t.Error("base image exceeding the raw data returned")
+	}
+	f = &Firmware{RawData: make([]byte, 0x100), StartOffset: 0x80, Size: 0x80}
+	if img, err := f.BaseImage(); err != nil || len(img) != 0x80 {
+		t.Errorf("base image ending at the raw data end: %d bytes (%v)", len(img), err)
+	}
+}
+
+func TestBaseImageDowngradeSizes(t *testing.T) {
+	f := mustParseBin(t, testTIImageWithDeviceDataAccess())
+	downgraded, err := f.BaseImageDowngradeFromBL0302ToBL0301()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(downgraded) != int(DOWNGRADE_TARGET_SIZE_TI) {
+		t.Fatalf("downgraded image has %#04x bytes, want %#04x", len(downgraded), DOWNGRADE_TARGET_SIZE_TI)
+	}
+
+	// placed behind the (erased) bootloader region, the image ends at flash address 0x6bff
+	d := mustParseBin(t, append(bytes.Repeat([]byte{0xFF}, int(FLASH_IMAGE_START_TI)), downgraded...))
+	if d.StartOffset != FLASH_IMAGE_START_TI || d.LastOffset != 0x6bff || !bytes.Equal(d.EndMarker, f.EndMarker) {
+		t.Errorf("downgraded image at %#04x-%#04x, want 0x0400-0x6bff", d.StartOffset, d.LastOffset)
+	}
+	if _, err = d.BaseImageDowngradeFromBL0302ToBL0301(); err != ErrFirmwareAlreadyDowngraded {
+		t.Errorf("downgrading twice returned %v, want ErrFirmwareAlreadyDowngraded", err)
+	}
+
+	if _, err = mustParseBin(t, testTIImage(0x5c00)).BaseImageDowngradeFromBL0302ToBL0301(); err == nil {
+		t.Error("image of wrong size downgraded")
+	}
+}
+
+func TestFirmwareEqual(t *testing.T) {
+	f := mustParseBin(t, append(testTIBootloader(), testTIImage(0x6000)...))
+	buf := &bytes.Buffer{}
+	if err := f.WriteBin(buf); err != nil {
+		t.Fatal(err)
+	}
+	again := mustParseBin(t, buf.Bytes())
+	if !f.Equal(again) {
+		t.Error("WriteBin/ParseFirmwareBin round trip isn't equal")
+	}
+
+	f.Signature[0x10] = 0x42
+	f.HasSignature = true
+	again.Signature[0x10] = 0x43
+	again.HasSignature = true
+	if f.Equal(again) {
+		t.Error("firmwares with different signatures are equal")
+	}
+
+	var nilFw *Firmware
+	if !nilFw.Equal(nil) || nilFw.Equal(f) || f.Equal(nil) {
+		t.Error("nil firmwares have to be equal to each other only")
+	}
+}
+
+func TestDeviceDataRelocationPatches(t *testing.T) {
+	// the patch set used before it was computed from the device data pages
+	want := [][2][]byte{
+		{{0x90, 0xe4, 0x00}, {0x90, 0xec, 0x00}},
+		{{0x7a, 0x04, 0x7b, 0xe4}, {0x7a, 0x04, 0x7b, 0xec}},
+		{{0x90, 0xe8, 0x00}, {0x90, 0xf0, 0x00}},
+		{{0x7a, 0x04, 0x7b, 0xe8}, {0x7a, 0x04, 0x7b, 0xf0}},
+		{{0x08, 0x74, 0xe4}, {0x08, 0x74, 0xec}},
+		{{0x75, 0x0f, 0xe8}, {0x75, 0x0f, 0xf0}},
+		{{0x79, 0x1a}, {0x79, 0x1c}},
+		{{0x7f, 0x1a, 0x79, 0x7f}, {0x7f, 0x1c, 0x79, 0x7f}},
+		{{0x7f, 0x19}, {0x7f, 0x1b}},
+		{{0x79, 0x19}, {0x79, 0x1b}},
+		{{0xf2, 0x08, 0x74, 0xe8}, {0xf2, 0x08, 0x74, 0xf0}},
+		{{0x0f, 0xe4, 0x22}, {0x0f, 0xec, 0x22}},
+		{{0x00, 0x7b, 0x64}, {0x00, 0x7b, 0x6c}},
+		{{0x05, 0x79, 0x19}, {0x05, 0x79, 0x1b}},
+	}
+	if len(DowngradeBL0302ToBL0301Patches) != len(want) {
+		t.Fatalf("%d patches, want %d", len(DowngradeBL0302ToBL0301Patches), len(want))
+	}
+	for i, p := range DowngradeBL0302ToBL0301Patches {
+		if !bytes.Equal(p.From, want[i][0]) || !bytes.Equal(p.To, want[i][1]) {
+			t.Errorf("patch %d is %s, want % 02x -> % 02x", i, p, want[i][0], want[i][1])
+		}
+	}
+}
+
+func TestDeviceDataBase(t *testing.T) {
+	tests := []struct {
+		size         int
+		page0, page1 uint16
+	}{
+		{0x6000, 0x6400, 0x6800},
+		{0x6800, 0x6c00, 0x7000},
+	}
+	for _, tt := range tests {
+		page0, page1, err := mustParseBin(t, testTIImage(tt.size)).DeviceDataBase()
+		if err != nil || page0 != tt.page0 || page1 != tt.page1 {
+			t.Errorf("image size %#04x: device data at %#04x/%#04x (%v), want %#04x/%#04x", tt.size, page0, page1, err, tt.page0, tt.page1)
+		}
+	}
+
+	if _, _, err := mustParseBin(t, testTIImage(0x6100)).DeviceDataBase(); err == nil {
+		t.Error("image size not aligned to flash pages accepted")
+	}
+	if _, _, err := mustParseBin(t, testNordicImage(0x6000)).DeviceDataBase(); err == nil {
+		t.Error("device data base returned for Nordic firmware")
+	}
+}
+
+// testSignature returns 256 bytes of pseudo random data, which passes the signature heuristics
+func testSignature() []byte {
+	random := make([]byte, 256)
+	rnd := uint32(1)
+	for i := range random {
+		// xorshift, any data with evenly distributed byte values passes
+		rnd ^= rnd << 13
+		rnd ^= rnd >> 17
+		rnd ^= rnd << 5
+		random[i] = byte(rnd)
+	}
+	return random
+}
+
+func TestSignatureHeuristics(t *testing.T) {
+	random := testSignature()
+	text := []byte(strings.Repeat(":10000000000102030405060708090A0B0C0D0E0F78\n", 6)[:256])
+
+	tests := []struct {
+		name  string
+		sig   []byte
+		valid bool
+	}{
+		{"random", random, true},
+		{"zero filled", make([]byte, 256), false},
+		{"0xff filled", bytes.Repeat([]byte{0xff}, 256), false},
+		{"hex text", text, false},
+		{"few byte values", bytes.Repeat([]byte{0x01, 0x02, 0x03, 0x04}, 64), false},
+		{"wrong size", random[:128], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Firmware{}
+			err := f.AddSignature(tt.sig)
+			if (err == nil) != tt.valid || f.SignatureLooksValid() != tt.valid || f.HasSignature != tt.valid {
+				t.Errorf("signature accepted %v (%v), want %v", err == nil, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestFirmwarePages(t *testing.T) {
+	img := testTIImage(0x6000)
+	f := mustParseBin(t, append(testTIBootloader(), img...))
+
+	var joined []byte
+	addr := FLASH_IMAGE_START_TI
+	f.Pages(0x500)(func(a uint16, data []byte) bool {
+		if a != addr || len(data) != 0x500 {
+			t.Errorf("page at %#04x with %#x bytes, want %#04x", a, len(data), addr)
+		}
+		addr += 0x500
+		joined = append(joined, data...)
+		data[0] ^= 0xff // pages are copies
+		return true
+	})
+	// 0x6000 isn't a multiple of 0x500, the last page is padded
+	want := append(append([]byte{}, img...), bytes.Repeat([]byte{0xFF}, 0x400)...)
+	if !bytes.Equal(joined, want) {
+		t.Error("pages don't join to the base image plus padding")
+	}
+	if base, _ := f.BaseImage(); !bytes.Equal(base, img) {
+		t.Error("modifying a page changed the firmware")
+	}
+
+	count := 0
+	f.Pages(0)(func(a uint16, data []byte) bool {
+		count++
+		return count < 3
+	})
+	if count != 3 {
+		t.Errorf("iteration went on for %d pages after yield returned false", count-3)
+	}
+
+	f.Pages(0)(func(a uint16, data []byte) bool {
+		if a != FLASH_IMAGE_START_TI || len(data) != int(FLASH_PAGE_SIZE_TI) {
+			t.Errorf("first page at %#04x with %#x bytes for the default page size", a, len(data))
+		}
+		return false
+	})
+
+	nordic := mustParseBin(t, testNordicImage(0x6400))
+	nordic.Pages(0)(func(a uint16, data []byte) bool {
+		if a != 0x0000 || len(data) != int(FLASH_PAGE_SIZE_NORDIC) {
+			t.Errorf("first Nordic page at %#04x with %#x bytes", a, len(data))
+		}
+		return false
+	})
+}
+
+func TestSameBaseAs(t *testing.T) {
+	f := mustParseBin(t, append(testTIBootloader(), testTIImage(0x6000)...))
+	other := mustParseBin(t, f.Bytes())
+	if err := other.SetVersion(0x24, 0x09); err != nil {
+		t.Fatal(err)
+	}
+
+	regions := f.MetadataRegions()
+	if len(regions) != 2 || regions[0] != (AddressRange{Start: 0x100, End: 0x10d}) || regions[1] != (AddressRange{Start: 0x6000 - 6, End: 0x6000 - 1}) {
+		t.Errorf("unexpected metadata regions %v", regions)
+	}
+	if !f.SameBaseAs(other, regions) {
+		t.Error("images differing in version and CRC only don't share the same base")
+	}
+	if f.SameBaseAs(other, nil) {
+		t.Error("images with different versions are equal without ignored regions")
+	}
+
+	other.RawData[other.StartOffset+0x200] ^= 0xff
+	if f.SameBaseAs(other, regions) {
+		t.Error("images with different code share the same base")
+	}
+}
+
+func TestComputeCRC(t *testing.T) {
+	tests := []struct {
+		name string
+		blob []byte
+	}{
+		{"TI", append(testTIBootloader(), testTIImage(0x6000)...)},
+		{"Nordic", testNordicImage(0x6400)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := mustParseBin(t, tt.blob)
+			stored, computed, start, end := f.CRCDebug()
+			if stored != f.CRC || computed != stored || f.ComputeCRC(start, end) != stored {
+				t.Errorf("CRC stored %#04x, computed %#04x, parsed %#04x", stored, computed, f.CRC)
+			}
+
+			crc := f.CRC
+			f.RawData[start] ^= 0xff
+			if f.ComputeCRC(start, end) == crc {
+				t.Error("CRC doesn't change with the data")
+			}
+			if err := f.UpdateCRC(); err != nil {
+				t.Fatal(err)
+			}
+			if again := mustParseBin(t, f.Bytes()); again.CRC != f.CRC || f.CRC == crc {
+				t.Errorf("updated CRC %#04x, parsed %#04x", f.CRC, again.CRC)
+			}
+		})
+	}
+
+	f := mustParseBin(t, testNordicImage(0x6400))
+	if f.ComputeCRC(0x10, 0x0f) != crc16.Checksum(nil, FirmwareCRCTable) || f.ComputeCRC(0, 0xffff) != crc16.Checksum(f.RawData, FirmwareCRCTable) {
+		t.Error("empty or clamped range not handled")
+	}
+}
+
+func TestWriteBaseImageBin(t *testing.T) {
+	img := testTIImage(0x6000)
+	f := mustParseBin(t, append(testTIBootloader(), img...))
+
+	buf := &bytes.Buffer{}
+	if err := f.WriteBaseImageBin(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), img) {
+		t.Fatalf("base image has %#x bytes, want the %#x bytes without bootloader", buf.Len(), len(img))
+	}
+	base := mustParseBin(t, buf.Bytes())
+	if base.HasBL || base.StartOffset != 0 || base.Size != f.Size || base.CRC != f.CRC {
+		t.Errorf("base image parsed as %s, want %s without bootloader", base, f)
+	}
+
+	f.Size = 0x7000
+	if err := f.WriteBaseImageBin(&bytes.Buffer{}); err == nil {
+		t.Error("base image exceeding the blob written")
+	}
+}
+
+func TestWriteHexOptions(t *testing.T) {
+	f := mustParseBin(t, append(testTIBootloader(), testTIImage(0x6000)...))
+	if err := f.AddSignature(testSignature()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, recLen := range []byte{0, 16, 32} {
+		for _, convention := range []HexConvention{HEX_CONVENTION_INTEL, HEX_CONVENTION_LOGITECH} {
+			buf := &bytes.Buffer{}
+			if err := f.WriteHex(buf, HexWriteOptions{RecordLength: recLen, Convention: convention}); err != nil {
+				t.Fatal(err)
+			}
+			lineLen := 1 + 2*(4+16+1) // record mark, length, address, type, data and checksum
+			if recLen == 32 {
+				lineLen += 2 * 16
+			}
+			if first := strings.SplitN(buf.String(), "\n", 2)[0]; len(first) != lineLen {
+				t.Errorf("record length %d: first record %q", recLen, first)
+			}
+
+			again, err := ParseFirmwareHexReader(buf, HexParseOptions{AbortOnInvalidLine: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if convention == HEX_CONVENTION_LOGITECH {
+				if !f.Equal(again) {
+					t.Errorf("record length %d: round trip with signature isn't equal", recLen)
+				}
+				continue
+			}
+			if again.HasSignature || !bytes.Equal(again.RawData, f.RawData) || again.Size != f.Size || again.CRC != f.CRC {
+				t.Errorf("record length %d: Intel hex round trip differs: %s", recLen, again)
+			}
+		}
+	}
+
+	if err := f.WriteHex(&bytes.Buffer{}, HexWriteOptions{BaseAddress: 0xc000}); err == nil {
+		t.Error("image exceeding the 16 bit address space written")
+	}
+}
+
+func TestParseFirmwareTIRebrandedBootloader(t *testing.T) {
+	img := testTIImage(0x6000)
+	bl := testTIBootloader()
+	copy(bl[0x3f8:], []byte{0x34, 0x12, 0x78, 0x56}) // VID 0x1234, PID 0x5678
+
+	f := mustParseBin(t, append(bl, img...))
+	if !f.HasBL || f.StartOffset != FLASH_IMAGE_START_TI || f.BootloaderVID != 0x1234 || f.BootloaderPID != 0x5678 {
+		t.Errorf("rebranded bootloader not detected: %s", f)
+	}
+
+	// an image without bootloader, which holds plausible bootloader info at 0x03f8 by chance
+	headless := append([]byte{}, img...)
+	copy(headless[0x3f8:], bl[0x3f8:0x400])
+	updateTestTICRC(headless)
+	f = mustParseBin(t, headless)
+	if f.HasBL || f.StartOffset != 0 || f.Size != 0x6000 || f.BootloaderVID != 0 {
+		t.Errorf("image without bootloader parsed as %s (bootloader VID %s)", f, f.BootloaderVID)
+	}
+}
+
+func TestVectorsAddress(t *testing.T) {
+	img := testTIImage(0x6000)
+	copy(img[0x03:], []byte{0x02, 0x12, 0x34})
+	updateTestTICRC(img)
+
+	for _, blob := range [][]byte{img, append(testTIBootloader(), img...)} {
+		f := mustParseBin(t, blob)
+		vectors, err := f.Vectors()
+		if err != nil {
+			t.Fatalf("decoding vectors failed: %v", err)
+		}
+		if len(vectors) != len(Vectors8051) {
+			t.Fatalf("got %d vectors, want %d", len(vectors), len(Vectors8051))
+		}
+		reset, ie0 := vectors[0], vectors[1]
+		if reset.Address != 0x0400 || !reset.IsLJMP || reset.Target != 0x0500 {
+			t.Errorf("reset vector (start offset %#04x): %v, want 0x0400 LJMP 0x0500", f.StartOffset, reset)
+		}
+		if ie0.Address != 0x0403 || !ie0.IsLJMP || ie0.Target != 0x1234 {
+			t.Errorf("IE0 vector (start offset %#04x): %v, want 0x0403 LJMP 0x1234", f.StartOffset, ie0)
+		}
+	}
+}
+
+func TestFirmwareFamily(t *testing.T) {
+	spotlightBL := testTIBootloader()
+	spotlightBL[0x3fa], spotlightBL[0x3fb] = byte(PID_BOOT_LOADER_TI_SPOTLIGHT&0xff), byte(PID_BOOT_LOADER_TI_SPOTLIGHT>>8)
+
+	tests := []struct {
+		name string
+		f    *Firmware
+		want ReceiverFamily
+	}{
+		{"empty", &Firmware{}, FAMILY_UNKNOWN},
+		{"version string", mustParseBin(t, testTIImage(0x6000)), FAMILY_UNIFYING},
+		{"bootloader PID", mustParseBin(t, append(spotlightBL, testTIImage(0x6000)...)), FAMILY_SPOTLIGHT},
+	}
+	for _, tt := range tests {
+		if got, err := tt.f.Family(); err != nil || got != tt.want {
+			t.Errorf("%s: family %v (%v), want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseFirmwareBinAs(t *testing.T) {
+	tiImg, nordicImg := testTIImage(0x6000), testNordicImage(NordicImageSizes[0])
+
+	tests := []struct {
+		name   string
+		blob   []byte
+		target FirmwareTargetType
+	}{
+		{"TI", tiImg, FIRMWARE_TARGET_TYPE_TI},
+		{"Nordic", nordicImg, FIRMWARE_TARGET_TYPE_NORDIC},
+	}
+	for _, tt := range tests {
+		f, err := ParseFirmwareBinAs(tt.blob, tt.target)
+		if err != nil {
+			t.Errorf("%s image forced to %s: %v", tt.name, tt.target, err)
+			continue
+		}
+		if f.TargetType != tt.target || !f.CRCValid {
+			t.Errorf("%s image forced to %s parsed as %s firmware (CRC valid %v)", tt.name, tt.target, f.TargetType, f.CRCValid)
+		}
+	}
+
+	// the error of the forced parser is returned, not the generic one of the auto detection
+	if _, err := ParseFirmwareBinAs(nordicImg, FIRMWARE_TARGET_TYPE_TI); err == nil || strings.Contains(err.Error(), "neither nordic, nor TI") {
+		t.Errorf("Nordic image forced to TI returned %v, want the error of the TI parser", err)
+	}
+	if _, err := ParseFirmwareBinAs(nordicImg, FirmwareTargetType(0x7f)); err == nil {
+		t.Error("unknown target type accepted")
+	}
+}
@@ -0,0 +1,65 @@
+package unifying
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Logger receives the informational output of the package (progress of firmware parsing and flashing, receiver
+// details, traces of the reports exchanged with the receiver). Without a Logger installed, the package is silent.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(format string, v ...interface{}) {}
+
+type stdoutLogger struct{}
+
+func (stdoutLogger) Printf(format string, v ...interface{}) {
+	fmt.Printf(format, v...)
+}
+
+type stderrLogger struct{}
+
+func (stderrLogger) Printf(format string, v ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, v...)
+}
+
+var (
+	// StdoutLogger prints all output to stdout, as the package did before output went through a Logger
+	StdoutLogger Logger = stdoutLogger{}
+	// StderrLogger prints all output to stderr, this keeps stdout free for machine readable results
+	StderrLogger Logger = stderrLogger{}
+
+	loggerMutex   sync.Mutex
+	packageLogger Logger = discardLogger{}
+)
+
+// SetLogger installs the Logger used by the package and by all dongles without a Logger of their own (see
+// LocalUSBDongle.SetLogger). A nil Logger discards the output again.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = discardLogger{}
+	}
+	loggerMutex.Lock()
+	packageLogger = l
+	loggerMutex.Unlock()
+}
+
+func currentLogger() Logger {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+	return packageLogger
+}
+
+func logf(format string, v ...interface{}) {
+	currentLogger().Printf(format, v...)
+}
+
+// logln formats like fmt.Println
+func logln(v ...interface{}) {
+	currentLogger().Printf("%s", fmt.Sprintln(v...))
+}
@@ -0,0 +1,725 @@
+package unifying
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/*
+HID++ 2.0 requests are addressed to a device feature, instead of a register:
+
+	report ID (0x10/0x11), device index, feature index, function ID << 4 | software ID, parameters
+
+The HID++ 1.0 sub ID takes the place of the feature index. Feature index 0x00 is always the root feature, errors are
+reported with feature index 0xff. Devices only speaking HID++ 1.0 answer requests to the root feature with a HID++ 1.0
+error message (invalid sub ID).
+*/
+
+const (
+	HIDPP20_FEATURE_ROOT_INDEX byte = 0x00
+	HIDPP20_ERROR_MSG          byte = 0xff
+
+	HIDPP20_ROOT_FUNCTION_GET_FEATURE byte = 0x00
+	HIDPP20_ROOT_FUNCTION_PING        byte = 0x01
+
+	HIDPP20_FEATURE_FEATURE_SET uint16 = 0x0001
+
+	HIDPP20_FEATURE_SET_FUNCTION_GET_COUNT      byte = 0x00
+	HIDPP20_FEATURE_SET_FUNCTION_GET_FEATURE_ID byte = 0x01
+
+	// flags of the feature type byte, reported by getFeature and getFeatureID
+	HIDPP20_FEATURE_TYPE_OBSOLETE    byte = 0x80
+	HIDPP20_FEATURE_TYPE_HIDDEN      byte = 0x40
+	HIDPP20_FEATURE_TYPE_ENGINEERING byte = 0x20
+
+	// software ID used for HID++ 2.0 requests, has to be non-zero to distinguish responses from notifications
+	HIDPP20_SOFTWARE_ID byte = 0x01
+
+	hidpp10ErrorInvalidSubID   byte = 0x01
+	hidpp10ErrorInvalidAddress byte = 0x02
+	hidpp10ErrorUnknownDevice  byte = 0x08 // no device paired to the addressed index
+	hidpp10ErrorResourceError  byte = 0x09 // device paired, but not connected
+)
+
+const (
+	HIDPP20_FEATURE_ADJUSTABLE_DPI uint16 = 0x2201
+
+	HIDPP20_ADJUSTABLE_DPI_FUNCTION_GET_SENSOR_COUNT    byte = 0x00
+	HIDPP20_ADJUSTABLE_DPI_FUNCTION_GET_SENSOR_DPI_LIST byte = 0x01
+	HIDPP20_ADJUSTABLE_DPI_FUNCTION_GET_SENSOR_DPI      byte = 0x02
+)
+
+const (
+	HIDPP20_FEATURE_DEVICE_NAME uint16 = 0x0005
+
+	HIDPP20_DEVICE_NAME_FUNCTION_GET_COUNT byte = 0x00
+	HIDPP20_DEVICE_NAME_FUNCTION_GET_NAME  byte = 0x01
+)
+
+const (
+	HIDPP20_FEATURE_BATTERY_STATUS  uint16 = 0x1000
+	HIDPP20_FEATURE_UNIFIED_BATTERY uint16 = 0x1004
+
+	HIDPP20_BATTERY_STATUS_FUNCTION_GET_LEVEL_STATUS byte = 0x00
+	HIDPP20_UNIFIED_BATTERY_FUNCTION_GET_STATUS      byte = 0x01
+)
+
+const (
+	HIDPP20_FEATURE_REPROG_CONTROLS_V4 uint16 = 0x1b04
+
+	HIDPP20_REPROG_CONTROLS_FUNCTION_GET_COUNT    byte = 0x00
+	HIDPP20_REPROG_CONTROLS_FUNCTION_GET_CID_INFO byte = 0x01
+)
+
+const (
+	// device reset feature, the function layout isn't publicly documented
+	HIDPP20_FEATURE_DEVICE_RESET uint16 = 0x1802
+
+	HIDPP20_DEVICE_RESET_FUNCTION_FORCE_RESET byte = 0x01
+)
+
+const (
+	// out-of-box state feature, setOobState restores the factory settings of the device
+	HIDPP20_FEATURE_OOB_STATE uint16 = 0x1805
+
+	HIDPP20_OOB_STATE_FUNCTION_SET_OOB_STATE byte = 0x00
+)
+
+// HidPP20Error is returned if a device answers a HID++ 2.0 request with an error message (feature index 0xff)
+type HidPP20Error struct {
+	FeatureIndex byte
+	Function     byte
+	Code         HidPPErrorCode
+}
+
+func (e *HidPP20Error) Error() string {
+	return fmt.Sprintf("HID++ 2.0 error response: %s for feature index %#02x function %#02x", e.Code.String(), e.FeatureIndex, e.Function)
+}
+
+// ErrFeatureUnsupported is matched (errors.Is) by errors returned for HID++ 2.0 features, which aren't supported by
+// the addressed device
+var ErrFeatureUnsupported = errors.New("feature not supported by device")
+
+// FeatureUnsupportedError is returned by GetFeatureIndex (and the methods using features), if the device doesn't
+// support the requested feature, or doesn't speak HID++ 2.0 at all
+type FeatureUnsupportedError struct {
+	DeviceIndex byte
+	FeatureID   uint16
+}
+
+func (e *FeatureUnsupportedError) Error() string {
+	return fmt.Sprintf("feature %#04x not supported by device %d", e.FeatureID, e.DeviceIndex)
+}
+
+func (e *FeatureUnsupportedError) Is(target error) bool {
+	return target == ErrFeatureUnsupported
+}
+
+// featureRequest calls a function of the given feature (by feature index) of the device with the given index and
+// returns the response parameters (following the function/software ID byte), see SendHIDPPToDevice. The response
+// timeout of the receiver (SetTimeout) applies.
+func (u *LocalUSBDongle) featureRequest(index byte, featureIndex byte, function byte, params []byte) (res []byte, err error) {
+	return u.SendHIDPPToDevice(index, featureIndex, function, params, time.Duration(u.responseTimeoutMillis())*time.Millisecond)
+}
+
+// SendHIDPPToDevice calls function funcID of the feature with the given runtime index on the device with the given
+// index (1..6), using a long HID++ report with software ID HIDPP20_SOFTWARE_ID. The response is matched by device
+// index, feature index, function and software ID, other reports received in the meantime (f.e. notifications) are
+// skipped. The returned data follows the function/software ID byte. Error responses are returned as *HidPP20Error
+// (or *HidPPError for HID++ 1.0 devices), if no response arrives within timeout ErrReceiveTimeout is returned.
+func (u *LocalUSBDongle) SendHIDPPToDevice(index byte, featureIndex byte, funcID byte, params []byte, timeout time.Duration) (res []byte, err error) {
+	u.reqMutex.Lock()
+	defer u.reqMutex.Unlock()
+	return u.sendHIDPPToDevice(index, featureIndex, funcID, params, timeout, nil)
+}
+
+// errRequestStopped is returned by sendHIDPPToDevice, if the stop function aborted waiting for the response
+var errRequestStopped = errors.New("waiting for the response has been stopped")
+
+// sendHIDPPToDevice implements SendHIDPPToDevice, the caller has to hold reqMutex. Reports which don't answer the
+// request are passed to stop (if not nil), if it returns true waiting for the response ends with errRequestStopped.
+func (u *LocalUSBDongle) sendHIDPPToDevice(index byte, featureIndex byte, funcID byte, params []byte, timeout time.Duration, stop func(r USBReport) bool) (res []byte, err error) {
+	if funcID > 0x0f {
+		return nil, errors.New(fmt.Sprintf("invalid HID++ 2.0 function ID %#02x", funcID))
+	}
+	if len(params) > USB_REPORT_TYPE_HIDPP_LONG_PAYLOAD_LEN-1 {
+		return nil, errors.New(fmt.Sprintf("HID++ 2.0 request parameters exceed %d bytes", USB_REPORT_TYPE_HIDPP_LONG_PAYLOAD_LEN-1))
+	}
+
+	u.lastRequest = time.Now()
+
+	funcSwID := funcID<<4 | HIDPP20_SOFTWARE_ID
+	payload := make([]byte, USB_REPORT_TYPE_HIDPP_LONG_PAYLOAD_LEN)
+	payload[0] = funcSwID
+	copy(payload[1:], params)
+	err = u.SendUSBReport(&HidPPMsg{
+		ReportID:   USB_REPORT_TYPE_HIDPP_LONG,
+		DeviceID:   index,
+		MsgSubID:   HidPPMsgSubID(featureIndex),
+		Parameters: payload,
+	})
+	if err != nil {
+		return
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, ErrReceiveTimeout
+		}
+		r, eRcv := u.ReceiveUSBReport(int(remaining/time.Millisecond) + 1)
+		if eRcv != nil {
+			return nil, eRcv
+		}
+		if r.IsHIDPP() {
+			msg := r.(*HidPPMsg)
+			if msg.DeviceID == index && len(msg.Parameters) >= 3 {
+				switch {
+				case byte(msg.MsgSubID) == featureIndex && msg.Parameters[0] == funcSwID:
+					return msg.Parameters[1:], nil
+				case byte(msg.MsgSubID) == HIDPP20_ERROR_MSG && msg.Parameters[0] == featureIndex && msg.Parameters[1] == funcSwID:
+					return nil, &HidPP20Error{FeatureIndex: featureIndex, Function: funcID, Code: HidPPErrorCode(msg.Parameters[2])}
+				case msg.MsgSubID == HIDPP_MSG_ID_ERROR_MSG && msg.Parameters[0] == featureIndex && msg.Parameters[1] == funcSwID:
+					return nil, &HidPPError{SubID: HidPPMsgSubID(featureIndex), Register: funcSwID, Code: HidPPErrorCode(msg.Parameters[2])}
+				}
+			}
+		}
+		if stop != nil && stop(r) {
+			return nil, errRequestStopped
+		}
+	}
+}
+
+type featureEntry struct {
+	index       byte
+	featureType byte
+}
+
+// GetFeatureIndex resolves the runtime index of a HID++ 2.0 feature of the device with the given index (1..6), using
+// the getFeature function of the root feature. Results are cached per device, so only the first lookup of a feature
+// is sent to the device. If the device doesn't support the feature (or is a HID++ 1.0 device), a
+// *FeatureUnsupportedError is returned.
+func (u *LocalUSBDongle) GetFeatureIndex(index byte, featureID uint16) (featureIndex byte, featureType byte, err error) {
+	u.featureMutex.Lock()
+	entry, cached := u.featureCache[index][featureID]
+	u.featureMutex.Unlock()
+
+	if !cached {
+		res, eReq := u.featureRequest(index, HIDPP20_FEATURE_ROOT_INDEX, HIDPP20_ROOT_FUNCTION_GET_FEATURE, []byte{byte(featureID >> 8), byte(featureID)})
+		if hppErr, isHidPP10Err := eReq.(*HidPPError); isHidPP10Err && byte(hppErr.Code) == hidpp10ErrorInvalidSubID {
+			// HID++ 1.0 device, no features at all
+			return 0, 0, &FeatureUnsupportedError{DeviceIndex: index, FeatureID: featureID}
+		}
+		if eReq != nil {
+			return 0, 0, eReq
+		}
+		if len(res) < 2 {
+			return 0, 0, errors.New("invalid response to getFeature")
+		}
+		entry = featureEntry{index: res[0], featureType: res[1]}
+		u.cacheFeature(index, featureID, entry)
+	}
+
+	// index 0 is reserved for the root feature, for all other features it means 'not supported'
+	if entry.index == 0 && featureID != 0x0000 {
+		return 0, 0, &FeatureUnsupportedError{DeviceIndex: index, FeatureID: featureID}
+	}
+	return entry.index, entry.featureType, nil
+}
+
+func (u *LocalUSBDongle) cacheFeature(index byte, featureID uint16, entry featureEntry) {
+	u.featureMutex.Lock()
+	defer u.featureMutex.Unlock()
+	if u.featureCache == nil {
+		u.featureCache = make(map[byte]map[uint16]featureEntry)
+	}
+	if u.featureCache[index] == nil {
+		u.featureCache[index] = make(map[uint16]featureEntry)
+	}
+	u.featureCache[index][featureID] = entry
+}
+
+// FeatureEntry describes a HID++ 2.0 feature of a device, as reported by the feature set feature (0x0001)
+type FeatureEntry struct {
+	Index   byte   // runtime index, used to address the feature
+	ID      uint16 // feature ID
+	Type    byte   // feature type flags (HIDPP20_FEATURE_TYPE_...)
+	Version byte   // feature version, 0 if not reported by the device
+}
+
+func (e FeatureEntry) Obsolete() bool {
+	return e.Type&HIDPP20_FEATURE_TYPE_OBSOLETE > 0
+}
+
+func (e FeatureEntry) Hidden() bool {
+	return e.Type&HIDPP20_FEATURE_TYPE_HIDDEN > 0
+}
+
+func (e FeatureEntry) Engineering() bool {
+	return e.Type&HIDPP20_FEATURE_TYPE_ENGINEERING > 0
+}
+
+func (e FeatureEntry) String() string {
+	res := fmt.Sprintf("%#02x: feature %#04x v%d", e.Index, e.ID, e.Version)
+	if e.Obsolete() {
+		res += " obsolete"
+	}
+	if e.Hidden() {
+		res += " hidden"
+	}
+	if e.Engineering() {
+		res += " engineering"
+	}
+	return res
+}
+
+// EnumerateFeatures walks the feature table of the HID++ 2.0 device with the given index (1..6), using the feature
+// set feature (0x0001). The result starts with the root feature at index 0x00. The feature indices are cached, so
+// successive GetFeatureIndex calls for the enumerated features aren't sent to the device.
+func (u *LocalUSBDongle) EnumerateFeatures(index byte) (features []FeatureEntry, err error) {
+	featureSetIndex, _, err := u.GetFeatureIndex(index, HIDPP20_FEATURE_FEATURE_SET)
+	if err != nil {
+		return
+	}
+	res, err := u.featureRequest(index, featureSetIndex, HIDPP20_FEATURE_SET_FUNCTION_GET_COUNT, nil)
+	if err != nil {
+		return
+	}
+	if len(res) < 1 {
+		return nil, errors.New("invalid response to getCount")
+	}
+	count := res[0] // not including the root feature
+
+	for featureIndex := 0; featureIndex <= int(count); featureIndex++ {
+		res, err = u.featureRequest(index, featureSetIndex, HIDPP20_FEATURE_SET_FUNCTION_GET_FEATURE_ID, []byte{byte(featureIndex)})
+		if err != nil {
+			return nil, err
+		}
+		if len(res) < 3 {
+			return nil, errors.New("invalid response to getFeatureID")
+		}
+		feature := FeatureEntry{
+			Index: byte(featureIndex),
+			ID:    uint16(res[0])<<8 | uint16(res[1]),
+			Type:  res[2],
+		}
+		if len(res) > 3 {
+			feature.Version = res[3]
+		}
+		features = append(features, feature)
+		u.cacheFeature(index, feature.ID, featureEntry{index: feature.Index, featureType: feature.Type})
+	}
+	return
+}
+
+// GetFeatureCount returns the number of features of the HID++ 2.0 device with the given index (1..6), including the
+// root feature (thus equal to the length of the EnumerateFeatures result), without enumerating them
+func (u *LocalUSBDongle) GetFeatureCount(index byte) (count int, err error) {
+	featureSetIndex, _, err := u.GetFeatureIndex(index, HIDPP20_FEATURE_FEATURE_SET)
+	if err != nil {
+		return
+	}
+	res, err := u.featureRequest(index, featureSetIndex, HIDPP20_FEATURE_SET_FUNCTION_GET_COUNT, nil)
+	if err != nil {
+		return
+	}
+	if len(res) < 1 {
+		return 0, errors.New("invalid response to getCount")
+	}
+	return int(res[0]) + 1, nil
+}
+
+// ForgetFeatures drops the cached feature indices of the device with the given index (f.e. if another device has
+// been paired to the slot)
+func (u *LocalUSBDongle) ForgetFeatures(index byte) {
+	u.featureMutex.Lock()
+	delete(u.featureCache, index)
+	u.featureMutex.Unlock()
+}
+
+// GetDeviceProtocol determines the HID++ protocol version of the device with the given index (1..6), by pinging the
+// HID++ 2.0 root feature. Devices only speaking HID++ 1.0 are reported as 1.0.
+func (u *LocalUSBDongle) GetDeviceProtocol(index byte) (major, minor byte, err error) {
+	pingData := byte(0x5a)
+	res, err := u.featureRequest(index, HIDPP20_FEATURE_ROOT_INDEX, HIDPP20_ROOT_FUNCTION_PING, []byte{0x00, 0x00, pingData})
+	if hppErr, isHidPP10Err := err.(*HidPPError); isHidPP10Err {
+		if byte(hppErr.Code) == hidpp10ErrorInvalidSubID {
+			return 1, 0, nil
+		}
+		return 0, 0, errors.New(fmt.Sprintf("device %d not reachable: %v", index, err))
+	}
+	if err != nil {
+		return
+	}
+	if len(res) < 3 || res[2] != pingData {
+		return 0, 0, errors.New("invalid response to root feature ping")
+	}
+	return res[0], res[1], nil
+}
+
+// IsDeviceConnected reports if the device paired to the given index (1..6) currently has a link to the receiver. The
+// connection state register only holds the number of paired devices, thus the device is pinged like by
+// GetDeviceProtocol. For devices without link, the receiver answers itself, so the check is quick compared to an
+// enumeration of all devices. An empty pairing slot is reported as error.
+func (u *LocalUSBDongle) IsDeviceConnected(index byte) (connected bool, err error) {
+	if index < 1 || index > 6 {
+		return false, errors.New(fmt.Sprintf("invalid device index %d", index))
+	}
+	_, err = u.featureRequest(index, HIDPP20_FEATURE_ROOT_INDEX, HIDPP20_ROOT_FUNCTION_PING, []byte{0x00, 0x00, 0x5a})
+	if hppErr, isHidPP10Err := err.(*HidPPError); isHidPP10Err {
+		switch byte(hppErr.Code) {
+		case hidpp10ErrorInvalidSubID:
+			// answered by a HID++ 1.0 device
+			return true, nil
+		case hidpp10ErrorResourceError:
+			return false, nil
+		case hidpp10ErrorUnknownDevice:
+			return false, errors.New(fmt.Sprintf("no device paired to index %d", index))
+		}
+		return false, err
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetDeviceNameFromDevice reads the marketing name of the HID++ 2.0 device with the given index (1..6) from the
+// device itself, using the device name feature (0x0005). The name is read in chunks (up to 16 characters per
+// request), it may differ from the name stored in the receiver's pairing information.
+func (u *LocalUSBDongle) GetDeviceNameFromDevice(index byte) (name string, err error) {
+	featureIndex, _, err := u.GetFeatureIndex(index, HIDPP20_FEATURE_DEVICE_NAME)
+	if err != nil {
+		return
+	}
+
+	res, err := u.featureRequest(index, featureIndex, HIDPP20_DEVICE_NAME_FUNCTION_GET_COUNT, nil)
+	if err != nil {
+		return
+	}
+	if len(res) < 1 {
+		return "", errors.New("invalid response to getDeviceNameCount")
+	}
+
+	raw, err := u.readChunked(func(offset byte) ([]byte, error) {
+		return u.featureRequest(index, featureIndex, HIDPP20_DEVICE_NAME_FUNCTION_GET_NAME, []byte{offset})
+	}, int(res[0]))
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("reading device name failed: %v", err))
+	}
+	// short names are padded with zero bytes
+	return strings.TrimRight(string(raw), "\x00"), nil
+}
+
+// GetMouseDPI reads the supported DPI values and the current DPI of the first sensor of a HID++ 2.0 mouse, using the
+// adjustable DPI feature (0x2201). Devices reporting a DPI range (min, step, max) get the range expanded into a list.
+func (u *LocalUSBDongle) GetMouseDPI(index byte) (supported []uint16, current uint16, err error) {
+	featureIndex, _, err := u.GetFeatureIndex(index, HIDPP20_FEATURE_ADJUSTABLE_DPI)
+	if err != nil {
+		return
+	}
+
+	sensor := byte(0x00)
+	list, err := u.featureRequest(index, featureIndex, HIDPP20_ADJUSTABLE_DPI_FUNCTION_GET_SENSOR_DPI_LIST, []byte{sensor})
+	if err != nil {
+		return
+	}
+	// sensor index, followed by big endian DPI values (terminated by 0x0000), a value with the upper 3 bits set
+	// encodes the step of a range between the surrounding values (min, step, max), ranges and discrete values can
+	// be mixed
+	value := func(pos int) uint16 { return uint16(list[pos])<<8 | uint16(list[pos+1]) }
+	isStep := func(val uint16) bool { return val>>13 == 0x7 }
+	for pos := 1; pos+1 < len(list); pos += 2 {
+		val := value(pos)
+		if val == 0 {
+			break
+		}
+		if !isStep(val) {
+			supported = append(supported, val)
+			continue
+		}
+		step := val & 0x1fff
+		if step == 0 || len(supported) == 0 || pos+3 >= len(list) {
+			return nil, 0, errors.New("invalid DPI range reported by device")
+		}
+		min, max := supported[len(supported)-1], value(pos+2)
+		if max == 0 || isStep(max) || max < min {
+			return nil, 0, errors.New("invalid DPI range reported by device")
+		}
+		for dpi := int(min) + int(step); dpi <= int(max); dpi += int(step) {
+			supported = append(supported, uint16(dpi))
+		}
+		pos += 2 // max is covered by the range
+	}
+
+	res, err := u.featureRequest(index, featureIndex, HIDPP20_ADJUSTABLE_DPI_FUNCTION_GET_SENSOR_DPI, []byte{sensor})
+	if err != nil {
+		return
+	}
+	if len(res) < 3 {
+		return nil, 0, errors.New("invalid response to getSensorDpi")
+	}
+	current = uint16(res[1])<<8 | uint16(res[2])
+	return
+}
+
+// RebootDevice resets the HID++ 2.0 device with the given index (1..6), using the device reset feature (0x1802).
+// As the device may reset before answering, a missing response isn't treated as error if the receiver reports the
+// link to the device as lost (device connection notification) within a few seconds. The cached feature indices of
+// the device are dropped.
+func (u *LocalUSBDongle) RebootDevice(index byte) (err error) {
+	featureIndex, _, err := u.GetFeatureIndex(index, HIDPP20_FEATURE_DEVICE_RESET)
+	if err != nil {
+		return
+	}
+	return u.resetRequest(index, featureIndex, HIDPP20_DEVICE_RESET_FUNCTION_FORCE_RESET)
+}
+
+// ResetDeviceSettings restores the factory settings of the HID++ 2.0 device with the given index (1..6), using the
+// out-of-box state feature (0x1805). The device reconnects afterwards, like for RebootDevice a missing response is
+// accepted if the receiver reports the link to the device as lost. The cached feature indices of the device are
+// dropped. The device stays paired.
+func (u *LocalUSBDongle) ResetDeviceSettings(index byte) (err error) {
+	featureIndex, _, err := u.GetFeatureIndex(index, HIDPP20_FEATURE_OOB_STATE)
+	if err != nil {
+		return
+	}
+	return u.resetRequest(index, featureIndex, HIDPP20_OOB_STATE_FUNCTION_SET_OOB_STATE)
+}
+
+// resetRequest sends a request which resets the device (possibly before it is answered), see RebootDevice
+func (u *LocalUSBDongle) resetRequest(index byte, featureIndex byte, function byte) (err error) {
+	defer u.ForgetFeatures(index)
+
+	linkLost := func(r USBReport) bool {
+		if !r.IsHIDPP() {
+			return false
+		}
+		dc, eDc := ParseDeviceConnection(r.(*HidPPMsg))
+		return eDc == nil && dc.DeviceIndex == index && !dc.Link
+	}
+
+	// the lock is held till the link loss has been seen, so that the notification isn't consumed by someone else
+	u.reqMutex.Lock()
+	defer u.reqMutex.Unlock()
+	_, err = u.sendHIDPPToDevice(index, featureIndex, function, nil, time.Duration(u.responseTimeoutMillis())*time.Millisecond, linkLost)
+	if err == nil || err == errRequestStopped {
+		return nil
+	}
+	if err != ErrReceiveTimeout {
+		return err
+	}
+
+	// no response, wait for the link loss caused by the reset
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		r, eRcv := u.ReceiveUSBReport(int(time.Until(deadline) / time.Millisecond))
+		if eRcv != nil {
+			break
+		}
+		if linkLost(r) {
+			return nil
+		}
+	}
+	return errors.New(fmt.Sprintf("device %d neither answered the reset request, nor lost its link", index))
+}
+
+// BatteryStatus is the charging state reported by the battery status feature (0x1000)
+type BatteryStatus byte
+
+const (
+	BATTERY_STATUS_DISCHARGING    BatteryStatus = 0x00
+	BATTERY_STATUS_RECHARGING     BatteryStatus = 0x01
+	BATTERY_STATUS_ALMOST_FULL    BatteryStatus = 0x02
+	BATTERY_STATUS_FULL           BatteryStatus = 0x03
+	BATTERY_STATUS_SLOW_RECHARGE  BatteryStatus = 0x04
+	BATTERY_STATUS_INVALID        BatteryStatus = 0x05
+	BATTERY_STATUS_THERMAL_ERROR  BatteryStatus = 0x06
+	BATTERY_STATUS_CHARGING_ERROR BatteryStatus = 0x07
+)
+
+func (s BatteryStatus) String() string {
+	switch s {
+	case BATTERY_STATUS_DISCHARGING:
+		return "discharging"
+	case BATTERY_STATUS_RECHARGING:
+		return "recharging"
+	case BATTERY_STATUS_ALMOST_FULL:
+		return "almost full"
+	case BATTERY_STATUS_FULL:
+		return "full"
+	case BATTERY_STATUS_SLOW_RECHARGE:
+		return "slow recharge"
+	case BATTERY_STATUS_INVALID:
+		return "invalid battery"
+	case BATTERY_STATUS_THERMAL_ERROR:
+		return "thermal error"
+	case BATTERY_STATUS_CHARGING_ERROR:
+		return "charging error"
+	default:
+		return fmt.Sprintf("unknown (%#02x)", byte(s))
+	}
+}
+
+// BatteryInfo holds the battery state of a HID++ 2.0 device
+type BatteryInfo struct {
+	Level     byte // remaining capacity in percent
+	NextLevel byte // next level reported by the device in percent, 0 if unknown
+	Status    BatteryStatus
+}
+
+func (b BatteryInfo) String() string {
+	return fmt.Sprintf("%d%% (%s)", b.Level, b.Status)
+}
+
+// GetBatteryStatus reads the battery level and charging state of the HID++ 2.0 device with the given index (1..6).
+// The battery status feature (0x1000) is used, devices without it are queried with the unified battery feature
+// (0x1004).
+func (u *LocalUSBDongle) GetBatteryStatus(index byte) (battery BatteryInfo, err error) {
+	featureIndex, _, err := u.GetFeatureIndex(index, HIDPP20_FEATURE_BATTERY_STATUS)
+	if err == nil {
+		res, eReq := u.featureRequest(index, featureIndex, HIDPP20_BATTERY_STATUS_FUNCTION_GET_LEVEL_STATUS, nil)
+		if eReq != nil {
+			return battery, eReq
+		}
+		if len(res) < 3 {
+			return battery, errors.New("invalid response to getBatteryLevelStatus")
+		}
+		return BatteryInfo{Level: res[0], NextLevel: res[1], Status: BatteryStatus(res[2])}, nil
+	}
+	if !errors.Is(err, ErrFeatureUnsupported) {
+		return
+	}
+
+	featureIndex, _, err = u.GetFeatureIndex(index, HIDPP20_FEATURE_UNIFIED_BATTERY)
+	if err != nil {
+		return
+	}
+	res, err := u.featureRequest(index, featureIndex, HIDPP20_UNIFIED_BATTERY_FUNCTION_GET_STATUS, nil)
+	if err != nil {
+		return
+	}
+	if len(res) < 3 {
+		return battery, errors.New("invalid response to get_status")
+	}
+	// state of charge, level flags, charging status (discharging, charging, slow charging, complete, error)
+	battery.Level = res[0]
+	switch res[2] {
+	case 0x00:
+		battery.Status = BATTERY_STATUS_DISCHARGING
+	case 0x01:
+		battery.Status = BATTERY_STATUS_RECHARGING
+	case 0x02:
+		battery.Status = BATTERY_STATUS_SLOW_RECHARGE
+	case 0x03:
+		battery.Status = BATTERY_STATUS_FULL
+	default:
+		battery.Status = BATTERY_STATUS_CHARGING_ERROR
+	}
+	return
+}
+
+// ControlFlags describe the capabilities of a reprogrammable control (reprogrammable controls feature 0x1b04). The
+// flags of the additional flags byte (v4) are shifted into the upper byte.
+type ControlFlags uint16
+
+const (
+	CONTROL_FLAG_MOUSE_BUTTON       ControlFlags = 1 << 0
+	CONTROL_FLAG_F_KEY              ControlFlags = 1 << 1
+	CONTROL_FLAG_HOT_KEY            ControlFlags = 1 << 2
+	CONTROL_FLAG_FN_TOGGLE          ControlFlags = 1 << 3
+	CONTROL_FLAG_REPROG_HINT        ControlFlags = 1 << 4
+	CONTROL_FLAG_TEMP_DIVERTABLE    ControlFlags = 1 << 5
+	CONTROL_FLAG_PERSIST_DIVERTABLE ControlFlags = 1 << 6
+	CONTROL_FLAG_VIRTUAL            ControlFlags = 1 << 7
+	CONTROL_FLAG_RAW_XY             ControlFlags = 1 << 8
+	CONTROL_FLAG_FORCE_RAW_XY       ControlFlags = 1 << 9
+	CONTROL_FLAG_ANALYTICS_EVENTS   ControlFlags = 1 << 10
+	CONTROL_FLAG_RAW_WHEEL          ControlFlags = 1 << 11
+)
+
+var controlFlagNames = []struct {
+	flag ControlFlags
+	name string
+}{
+	{CONTROL_FLAG_MOUSE_BUTTON, "mouse button"},
+	{CONTROL_FLAG_F_KEY, "F key"},
+	{CONTROL_FLAG_HOT_KEY, "hot key"},
+	{CONTROL_FLAG_FN_TOGGLE, "Fn toggle"},
+	{CONTROL_FLAG_REPROG_HINT, "reprogrammable"},
+	{CONTROL_FLAG_TEMP_DIVERTABLE, "divertable"},
+	{CONTROL_FLAG_PERSIST_DIVERTABLE, "persistently divertable"},
+	{CONTROL_FLAG_VIRTUAL, "virtual"},
+	{CONTROL_FLAG_RAW_XY, "raw XY"},
+	{CONTROL_FLAG_FORCE_RAW_XY, "force raw XY"},
+	{CONTROL_FLAG_ANALYTICS_EVENTS, "analytics key events"},
+	{CONTROL_FLAG_RAW_WHEEL, "raw wheel"},
+}
+
+func (f ControlFlags) String() string {
+	var names []string
+	for _, fn := range controlFlagNames {
+		if f&fn.flag != 0 {
+			names = append(names, fn.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// ControlInfo describes a reprogrammable control (button or key) of a HID++ 2.0 device
+type ControlInfo struct {
+	ControlID uint16 // CID, identifies the control
+	TaskID    uint16 // TID, the task (action) assigned to the control by default
+	Flags     ControlFlags
+	Position  byte // position of F keys (1..), 0 for other controls
+	Group     byte // remapping group, 0 if the control can't be remapped
+	GroupMask byte // groups the control could be remapped to
+}
+
+func (c ControlInfo) String() string {
+	return fmt.Sprintf("CID %#04x TID %#04x group %d (mask %#02x) flags: %s", c.ControlID, c.TaskID, c.Group, c.GroupMask, c.Flags)
+}
+
+// GetReprogrammableControls lists the reprogrammable controls (buttons and keys) of the HID++ 2.0 device with the
+// given index (1..6), using the reprogrammable controls feature (0x1b04), one request per control.
+func (u *LocalUSBDongle) GetReprogrammableControls(index byte) (controls []ControlInfo, err error) {
+	featureIndex, _, err := u.GetFeatureIndex(index, HIDPP20_FEATURE_REPROG_CONTROLS_V4)
+	if err != nil {
+		return
+	}
+
+	res, err := u.featureRequest(index, featureIndex, HIDPP20_REPROG_CONTROLS_FUNCTION_GET_COUNT, nil)
+	if err != nil {
+		return
+	}
+	if len(res) < 1 {
+		return nil, errors.New("invalid response to getCount")
+	}
+	count := res[0]
+
+	for i := byte(0); i < count; i++ {
+		res, err = u.featureRequest(index, featureIndex, HIDPP20_REPROG_CONTROLS_FUNCTION_GET_CID_INFO, []byte{i})
+		if err != nil {
+			return nil, err
+		}
+		if len(res) < 8 {
+			return nil, errors.New(fmt.Sprintf("invalid response to getCidInfo for control %d", i))
+		}
+		c := ControlInfo{
+			ControlID: uint16(res[0])<<8 | uint16(res[1]),
+			TaskID:    uint16(res[2])<<8 | uint16(res[3]),
+			Flags:     ControlFlags(res[4]),
+			Position:  res[5],
+			Group:     res[6],
+			GroupMask: res[7],
+		}
+		if len(res) > 8 {
+			c.Flags |= ControlFlags(res[8]) << 8
+		}
+		controls = append(controls, c)
+	}
+	return
+}
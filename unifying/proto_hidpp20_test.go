@@ -0,0 +1,210 @@
+package unifying
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeFeature is a HID++ 2.0 feature of a fake device, functions maps function IDs to handlers returning the response
+// parameters
+type fakeFeature struct {
+	id        uint16
+	functions map[byte]func(params []byte) []byte
+}
+
+// deviceResponder answers HID++ 2.0 requests to the devices in devices (by device index), the runtime index of a
+// feature is its position in the list plus one (index 0 is the root feature). Requests to unknown functions are
+// answered with a HID++ 2.0 error.
+func deviceResponder(devices map[byte][]fakeFeature) func(report []byte) [][]byte {
+	return func(report []byte) [][]byte {
+		features, known := devices[report[1]]
+		if !known || len(report) < 4 {
+			return nil
+		}
+		featureIndex, funcSwID := report[2], report[3]
+		params := report[4:]
+		rsp := make([]byte, USB_REPORT_TYPE_HIDPP_LONG_LEN)
+		copy(rsp, []byte{byte(USB_REPORT_TYPE_HIDPP_LONG), report[1], featureIndex, funcSwID})
+
+		var handler func(params []byte) []byte
+		switch {
+		case featureIndex == HIDPP20_FEATURE_ROOT_INDEX && funcSwID>>4 == HIDPP20_ROOT_FUNCTION_GET_FEATURE:
+			handler = func(params []byte) []byte {
+				id := uint16(params[0])<<8 | uint16(params[1])
+				for i, f := range features {
+					if f.id == id {
+						return []byte{byte(i + 1), 0x00, 0x00}
+					}
+				}
+				return []byte{0x00, 0x00, 0x00}
+			}
+		case int(featureIndex) >= 1 && int(featureIndex) <= len(features):
+			handler = features[featureIndex-1].functions[funcSwID>>4]
+		}
+		if handler == nil {
+			return [][]byte{{byte(USB_REPORT_TYPE_HIDPP_SHORT), report[1], HIDPP20_ERROR_MSG, featureIndex, funcSwID, 0x07, 0x00}} // invalid function ID
+		}
+		copy(rsp[4:], handler(params))
+		return [][]byte{rsp}
+	}
+}
+
+func TestGetDeviceNameFromDevice(t *testing.T) {
+	const name = "Wireless Keyboard K270 Pro"
+	u, transport := newFakeDongle(t, deviceResponder(map[byte][]fakeFeature{
+		0x01: {{id: HIDPP20_FEATURE_DEVICE_NAME, functions: map[byte]func([]byte) []byte{
+			HIDPP20_DEVICE_NAME_FUNCTION_GET_COUNT: func([]byte) []byte { return []byte{byte(len(name))} },
+			HIDPP20_DEVICE_NAME_FUNCTION_GET_NAME: func(params []byte) []byte {
+				return []byte(name[params[0]:])
+			},
+		}}},
+	}))
+
+	got, err := u.GetDeviceNameFromDevice(0x01)
+	if err != nil || got != name {
+		t.Errorf("device name %q (%v), want %q", got, err, name)
+	}
+	// getFeature, getDeviceNameCount and two getDeviceName requests
+	if written := transport.writtenReports(); len(written) != 4 || written[2][4] != 0x00 || written[3][4] != 0x10 {
+		t.Errorf("unexpected requests % 02x", written)
+	}
+}
+
+func TestGetBatteryStatus(t *testing.T) {
+	u, _ := newFakeDongle(t, deviceResponder(map[byte][]fakeFeature{
+		0x01: {{id: HIDPP20_FEATURE_BATTERY_STATUS, functions: map[byte]func([]byte) []byte{
+			HIDPP20_BATTERY_STATUS_FUNCTION_GET_LEVEL_STATUS: func([]byte) []byte { return []byte{0x50, 0x32, byte(BATTERY_STATUS_RECHARGING)} },
+		}}},
+		0x02: {
+			{id: HIDPP20_FEATURE_DEVICE_NAME},
+			{id: HIDPP20_FEATURE_UNIFIED_BATTERY, functions: map[byte]func([]byte) []byte{
+				HIDPP20_UNIFIED_BATTERY_FUNCTION_GET_STATUS: func([]byte) []byte { return []byte{0x40, 0x08, 0x03} },
+			}},
+		},
+		0x03: {{id: HIDPP20_FEATURE_DEVICE_NAME}},
+	}))
+
+	tests := []struct {
+		index byte
+		want  BatteryInfo
+	}{
+		{0x01, BatteryInfo{Level: 0x50, NextLevel: 0x32, Status: BATTERY_STATUS_RECHARGING}},
+		{0x02, BatteryInfo{Level: 0x40, Status: BATTERY_STATUS_FULL}},
+	}
+	for _, tt := range tests {
+		if got, err := u.GetBatteryStatus(tt.index); err != nil || got != tt.want {
+			t.Errorf("battery of device %d: %+v (%v), want %+v", tt.index, got, err, tt.want)
+		}
+	}
+
+	if _, err := u.GetBatteryStatus(0x03); !errors.Is(err, ErrFeatureUnsupported) {
+		t.Errorf("battery of device without battery feature returned %v, want ErrFeatureUnsupported", err)
+	}
+}
+
+func TestGetMouseDPI(t *testing.T) {
+	dpiFeature := func(list ...byte) []fakeFeature {
+		return []fakeFeature{{id: HIDPP20_FEATURE_ADJUSTABLE_DPI, functions: map[byte]func([]byte) []byte{
+			HIDPP20_ADJUSTABLE_DPI_FUNCTION_GET_SENSOR_DPI_LIST: func([]byte) []byte { return append([]byte{0x00}, list...) },
+			HIDPP20_ADJUSTABLE_DPI_FUNCTION_GET_SENSOR_DPI:      func([]byte) []byte { return []byte{0x00, 0x0b, 0xb8} },
+		}}}
+	}
+	u, _ := newFakeDongle(t, deviceResponder(map[byte][]fakeFeature{
+		// discrete values
+		0x01: dpiFeature(0x01, 0x90, 0x03, 0x20, 0x06, 0x40, 0x00, 0x00),
+		// range 400..1200 step 400, 1600, range 2000..4000 step 1000 (no terminator, the list fills the report)
+		0x02: dpiFeature(0x01, 0x90, 0xe1, 0x90, 0x04, 0xb0, 0x06, 0x40, 0x07, 0xd0, 0xe3, 0xe8, 0x0f, 0xa0),
+		// range without min
+		0x03: dpiFeature(0xe1, 0x90, 0x04, 0xb0, 0x00, 0x00),
+		// range without max
+		0x04: dpiFeature(0x01, 0x90, 0xe1, 0x90, 0x00, 0x00),
+	}))
+
+	tests := []struct {
+		index byte
+		want  []uint16
+	}{
+		{0x01, []uint16{400, 800, 1600}},
+		{0x02, []uint16{400, 800, 1200, 1600, 2000, 3000, 4000}},
+	}
+	for _, tt := range tests {
+		got, current, err := u.GetMouseDPI(tt.index)
+		if err != nil || current != 3000 || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("DPI of device %d: %v current %d (%v), want %v current 3000", tt.index, got, current, err, tt.want)
+		}
+	}
+
+	for _, index := range []byte{0x03, 0x04} {
+		if _, _, err := u.GetMouseDPI(index); err == nil {
+			t.Errorf("invalid DPI range of device %d accepted", index)
+		}
+	}
+}
+
+func TestFeatureRequest(t *testing.T) {
+	hidpp20 := deviceResponder(map[byte][]fakeFeature{
+		0x01: {{id: HIDPP20_FEATURE_DEVICE_NAME, functions: map[byte]func([]byte) []byte{
+			HIDPP20_DEVICE_NAME_FUNCTION_GET_COUNT: func([]byte) []byte { return []byte{0x05} },
+		}}},
+	})
+	u, transport := newFakeDongle(t, func(report []byte) [][]byte {
+		if report[1] == 0x02 {
+			// HID++ 1.0 device
+			return [][]byte{{byte(USB_REPORT_TYPE_HIDPP_SHORT), 0x02, byte(HIDPP_MSG_ID_ERROR_MSG), report[2], report[3], hidpp10ErrorInvalidSubID, 0x00}}
+		}
+		// a notification received before the response has to be skipped
+		notification := []byte{byte(USB_REPORT_TYPE_HIDPP_SHORT), report[1], 0x41, 0x04, 0x61, 0x10, 0x20}
+		return append([][]byte{notification}, hidpp20(report)...)
+	})
+
+	res, err := u.featureRequest(0x01, 0x01, HIDPP20_DEVICE_NAME_FUNCTION_GET_COUNT, nil)
+	if err != nil || len(res) == 0 || res[0] != 0x05 {
+		t.Errorf("getDeviceNameCount returned % 02x (%v)", res, err)
+	}
+	written := transport.writtenReports()
+	if len(written) != 1 || written[0][0] != byte(USB_REPORT_TYPE_HIDPP_LONG) {
+		t.Errorf("unexpected requests % 02x, want a single long report", written)
+	}
+
+	var hidpp20Err *HidPP20Error
+	if _, err := u.featureRequest(0x01, 0x01, 0x0e, nil); !errors.As(err, &hidpp20Err) || hidpp20Err.FeatureIndex != 0x01 || hidpp20Err.Function != 0x0e {
+		t.Errorf("request to unknown function returned %v, want HidPP20Error", err)
+	}
+
+	if _, _, err := u.GetFeatureIndex(0x02, HIDPP20_FEATURE_DEVICE_NAME); !errors.Is(err, ErrFeatureUnsupported) {
+		t.Errorf("feature lookup on HID++ 1.0 device returned %v, want ErrFeatureUnsupported", err)
+	}
+}
+
+func TestRebootDevice(t *testing.T) {
+	resetFeature := []fakeFeature{{id: HIDPP20_FEATURE_DEVICE_RESET, functions: map[byte]func([]byte) []byte{
+		HIDPP20_DEVICE_RESET_FUNCTION_FORCE_RESET: func([]byte) []byte { return nil },
+	}}}
+	devices := deviceResponder(map[byte][]fakeFeature{0x01: resetFeature, 0x02: resetFeature, 0x03: resetFeature})
+	u, _ := newFakeDongle(t, func(report []byte) [][]byte {
+		dev, featureIndex, funcSwID := report[1], report[2], report[3]
+		if dev == 0x01 || featureIndex != 0x01 {
+			return devices(report)
+		}
+		// a late response of another function of the same feature mustn't be taken as acknowledgement
+		stray := make([]byte, USB_REPORT_TYPE_HIDPP_LONG_LEN)
+		copy(stray, []byte{byte(USB_REPORT_TYPE_HIDPP_LONG), dev, featureIndex, 0x00 | HIDPP20_SOFTWARE_ID})
+		if dev == 0x02 {
+			return [][]byte{stray, {byte(USB_REPORT_TYPE_HIDPP_SHORT), dev, HIDPP20_ERROR_MSG, featureIndex, funcSwID, 0x05, 0x00}}
+		}
+		// link loss notification, the device resets before answering
+		return [][]byte{stray, {byte(USB_REPORT_TYPE_HIDPP_SHORT), dev, byte(HIDPP_MSG_ID_DEVICE_CONNECTION), 0x04, 0x41, 0x24, 0x40}}
+	})
+
+	if err := u.RebootDevice(0x01); err != nil {
+		t.Errorf("acknowledged reset returned %v", err)
+	}
+	var hidpp20Err *HidPP20Error
+	if err := u.RebootDevice(0x02); !errors.As(err, &hidpp20Err) {
+		t.Errorf("reset answered with an error returned %v, want HidPP20Error", err)
+	}
+	if err := u.RebootDevice(0x03); err != nil {
+		t.Errorf("reset followed by link loss returned %v", err)
+	}
+}
@@ -43,7 +43,29 @@ func (t USBReportType) String() string {
 	case USB_REPORT_TYPE_DJ_LONG:
 		return "DJ Report long"
 	}
-	return fmt.Sprintf("Unknown USB report type %02x", t)
+	return fmt.Sprintf("Unknown USB report type %02x", byte(t))
+}
+
+// traceReport formats a raw report for the in/out trace enabled with SetShowInOut, the report type and device index
+// are annotated in front of the hex payload (f.e. "OUT [LONG idx=0x01] 11 01 83 b5 ...")
+func traceReport(direction string, data []byte) string {
+	if len(data) < 2 {
+		return fmt.Sprintf("%s [?] % 02x", direction, data)
+	}
+	var kind string
+	switch USBReportType(data[0]) {
+	case USB_REPORT_TYPE_HIDPP_SHORT:
+		kind = "SHORT"
+	case USB_REPORT_TYPE_HIDPP_LONG:
+		kind = "LONG"
+	case USB_REPORT_TYPE_DJ_SHORT:
+		kind = "DJ SHORT"
+	case USB_REPORT_TYPE_DJ_LONG:
+		kind = "DJ LONG"
+	default:
+		kind = fmt.Sprintf("ID %#02x", data[0])
+	}
+	return fmt.Sprintf("%s [%s idx=%#02x] % 02x", direction, kind, data[1], data)
 }
 
 type USBReport interface {
@@ -139,6 +161,17 @@ func (t HidPPErrorCode) String() string {
 	return fmt.Sprintf("Undocumented error code %02x", byte(t))
 }
 
+// HidPPError is returned if a request is answered with a HID++ 1.0 error message (sub ID 0x8f)
+type HidPPError struct {
+	SubID    HidPPMsgSubID // sub ID of the failed request
+	Register byte          // register (or first parameter) of the failed request
+	Code     HidPPErrorCode
+}
+
+func (e *HidPPError) Error() string {
+	return fmt.Sprintf("HID++ error response: %s for request %s (register %#02x)", e.Code.String(), e.SubID.String(), e.Register)
+}
+
 type DJReportType byte
 
 const (
@@ -189,7 +222,7 @@ func (t DJReportType) String() string {
 		return "COMMAND GET PAIRED DEVICES"
 
 	}
-	return fmt.Sprintf("Unknown DJ Report type %02x", t)
+	return fmt.Sprintf("Unknown DJ Report type %02x", byte(t))
 }
 
 const (
@@ -242,6 +275,18 @@ const (
 	UNIYING_WIRELESS_NOTIFICATIONS_P1_SOFTWARE_PRESENT_MASK       = (1 << 3)
 )
 
+// for read parameters of short read from connection state register (0x02)
+const (
+	UNIFYING_CONNECTION_STATE_P0_PAIRING_LOCK_OPEN_MASK = (1 << 0)
+)
+
+// for write parameters of short write to pairing register (0xb2)
+const (
+	UNIFYING_PAIRING_P0_OPEN_LOCK  = 0x01
+	UNIFYING_PAIRING_P0_CLOSE_LOCK = 0x02
+	UNIFYING_PAIRING_P0_UNPAIR     = 0x03
+)
+
 type DJReport struct {
 	ReportID   USBReportType
 	DeviceID   byte
@@ -393,6 +438,50 @@ func (r *DJReport) ToWire() (payload []byte, err error) {
 	return
 }
 
+// DeviceConnection holds the content of a device connection notification (HID++ sub ID 0x41)
+type DeviceConnection struct {
+	DeviceIndex     byte // HID++ device index (pairing slot + 1)
+	ProtocolType    byte
+	DeviceType      DeviceType
+	SoftwarePresent bool
+	Encrypted       bool
+	Link            bool // false if the device is paired, but currently not connected
+	WPID            uint16
+	ProtocolMajor   byte // HID++ protocol version, 0 if unknown (f.e. device offline)
+	ProtocolMinor   byte
+	UnitID          [4]byte // unit ID (serial) of the device, zero if unknown
+}
+
+// ParseDeviceConnection extracts the device connection information from a device connection notification
+func ParseDeviceConnection(msg *HidPPMsg) (res DeviceConnection, err error) {
+	if msg.MsgSubID != HIDPP_MSG_ID_DEVICE_CONNECTION || len(msg.Parameters) < 4 {
+		return res, errors.New("no device connection notification")
+	}
+	res.DeviceIndex = msg.DeviceID
+	res.ProtocolType = msg.Parameters[0]
+	res.DeviceType = DeviceType(msg.Parameters[1] & 0x0F)
+	res.SoftwarePresent = msg.Parameters[1]&0x10 > 0
+	res.Encrypted = msg.Parameters[1]&0x20 > 0
+	res.Link = msg.Parameters[1]&0x40 == 0
+	res.WPID = uint16(msg.Parameters[3])<<8 + uint16(msg.Parameters[2])
+	return
+}
+
+func (dc DeviceConnection) String() string {
+	res := fmt.Sprintf("DEVICE CONNECTION ON INDEX: %02x TYPE: %s WPID: %#04x", dc.DeviceIndex, dc.DeviceType, dc.WPID)
+	if name, _, known := DeviceModelFromWPID(dc.WPID); known {
+		res += fmt.Sprintf(" (%s)", name)
+	}
+	res += fmt.Sprintf(" ENCRYPTED: %v CONNECTED: %v", dc.Encrypted, dc.Link)
+	if dc.ProtocolMajor > 0 {
+		res += fmt.Sprintf(" HID++: %d.%d", dc.ProtocolMajor, dc.ProtocolMinor)
+	}
+	if dc.UnitID != [4]byte{} {
+		res += fmt.Sprintf(" UNIT ID: %02x:%02x:%02x:%02x", dc.UnitID[0], dc.UnitID[1], dc.UnitID[2], dc.UnitID[3])
+	}
+	return res
+}
+
 type HidPPMsg struct {
 	ReportID   USBReportType
 	DeviceID   byte
@@ -517,3 +606,45 @@ func (r *HidPPMsg) IsHIDPP() bool {
 func (r *HidPPMsg) IsDJ() bool {
 	return r.ReportID == USB_REPORT_TYPE_DJ_LONG || r.ReportID == USB_REPORT_TYPE_DJ_SHORT
 }
+
+// DecodeHIDPP interprets a raw HID++/DJ report (as captured from USB, starting with the report ID) and returns
+// a human readable description. Trailing bytes beyond the length of the respective report type are ignored.
+func DecodeHIDPP(report []byte) (res string, err error) {
+	if len(report) == 0 {
+		return "", errors.New("empty report")
+	}
+
+	var msg USBReport
+	expectedLen := 0
+	switch USBReportType(report[0]) {
+	case USB_REPORT_TYPE_HIDPP_SHORT:
+		msg, expectedLen = &HidPPMsg{}, USB_REPORT_TYPE_HIDPP_SHORT_LEN
+	case USB_REPORT_TYPE_HIDPP_LONG:
+		msg, expectedLen = &HidPPMsg{}, USB_REPORT_TYPE_HIDPP_LONG_LEN
+	case USB_REPORT_TYPE_DJ_SHORT:
+		msg, expectedLen = &DJReport{}, USB_REPORT_TYPE_DJ_SHORT_LEN
+	case USB_REPORT_TYPE_DJ_LONG:
+		msg, expectedLen = &DJReport{}, USB_REPORT_TYPE_DJ_LONG_LEN
+	default:
+		return "", errors.New(fmt.Sprintf("unknown report ID %#02x", report[0]))
+	}
+
+	if len(report) < expectedLen {
+		return "", errors.New(fmt.Sprintf("report too short for %s (%d bytes, expected %d)", USBReportType(report[0]), len(report), expectedLen))
+	}
+	if err = msg.FromWire(report[:expectedLen]); err != nil {
+		return "", err
+	}
+	res = msg.String()
+
+	if hidpp, ok := msg.(*HidPPMsg); ok && (hidpp.MsgSubID < 0x40 || hidpp.MsgSubID == 0xff) {
+		// no HID++ 1.0 sub ID, interpret as HID++ 2.0 feature call
+		if hidpp.MsgSubID == 0xff {
+			res += fmt.Sprintf("\n\tHID++ 2.0 error for feature index %#02x, function %d, software ID %d: %s", hidpp.Parameters[0], hidpp.Parameters[1]>>4, hidpp.Parameters[1]&0x0f, HidPPErrorCode(hidpp.Parameters[2]))
+		} else {
+			res += fmt.Sprintf("\n\tHID++ 2.0 feature index %#02x, function %d, software ID %d, params: % #x", byte(hidpp.MsgSubID), hidpp.Parameters[0]>>4, hidpp.Parameters[0]&0x0f, hidpp.Parameters[1:])
+		}
+	}
+
+	return res, nil
+}
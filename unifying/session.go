@@ -0,0 +1,163 @@
+package unifying
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PacketDirection tells if a traced report was sent to or received from the receiver
+type PacketDirection byte
+
+const (
+	PACKET_DIRECTION_OUT PacketDirection = iota // sent to the receiver
+	PACKET_DIRECTION_IN                         // received from the receiver
+)
+
+func (d PacketDirection) String() string {
+	switch d {
+	case PACKET_DIRECTION_OUT:
+		return "OUT"
+	case PACKET_DIRECTION_IN:
+		return "IN"
+	default:
+		return fmt.Sprintf("unknown direction %d", byte(d))
+	}
+}
+
+// PacketTracer is called for each report exchanged with the receiver, see LocalUSBDongle.SetPacketTracer
+type PacketTracer func(direction PacketDirection, report []byte)
+
+// RecordSession writes every report exchanged with the receiver from now on to w, one line per report:
+//
+//	<OUT|IN> <timestamp (RFC3339, nanoseconds)> <report as hex>
+//
+// The recording could be replayed with ReplaySession. It replaces the packet tracer (see SetPacketTracer) and ends,
+// when another tracer is set. Write errors end the recording, too.
+func (u *LocalUSBDongle) RecordSession(w io.Writer) {
+	var mutex sync.Mutex // the tracer is called from the send and the receive goroutine
+	failed := false
+	u.SetPacketTracer(func(direction PacketDirection, report []byte) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if failed {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "%s %s %x\n", direction, time.Now().UTC().Format(time.RFC3339Nano), report); err != nil {
+			logf("Session recording stopped: %v\n", err)
+			failed = true
+		}
+	})
+}
+
+type sessionRecord struct {
+	direction PacketDirection
+	report    []byte
+}
+
+// replayTransport is the Transport returned by ReplaySession
+type replayTransport struct {
+	mutex   sync.Mutex // guards records
+	records []sessionRecord
+	inQueue chan []byte
+	closed  chan struct{}
+	close   sync.Once
+}
+
+// ReplaySession returns a Transport replaying a session recorded with RecordSession, allowing to test the logic of
+// LocalUSBDongle (see NewDongleWithTransport) without hardware. Each report written to the transport has to match the
+// next recorded outbound report, otherwise Write fails. After a match, the inbound reports recorded up to the next
+// outbound report get readable (reports recorded in front of the first outbound report are readable right away). The
+// timestamps are ignored. Empty lines and lines starting with '#' are skipped. A malformed recording is reported
+// by the returned error right away, instead of failing reads of the transport later on.
+func ReplaySession(r io.Reader) (t Transport, err error) {
+	res := &replayTransport{closed: make(chan struct{})}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	numIn := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, errors.New(fmt.Sprintf("invalid session line %d: %s", lineNo, line))
+		}
+		rec := sessionRecord{}
+		switch fields[0] {
+		case "OUT":
+			rec.direction = PACKET_DIRECTION_OUT
+		case "IN":
+			rec.direction = PACKET_DIRECTION_IN
+			numIn++
+		default:
+			return nil, errors.New(fmt.Sprintf("invalid direction '%s' in session line %d", fields[0], lineNo))
+		}
+		if _, eTime := time.Parse(time.RFC3339Nano, fields[1]); eTime != nil {
+			return nil, errors.New(fmt.Sprintf("invalid timestamp in session line %d: %v", lineNo, eTime))
+		}
+		if rec.report, err = hex.DecodeString(fields[2]); err != nil || len(rec.report) == 0 {
+			return nil, errors.New(fmt.Sprintf("invalid report in session line %d: %s", lineNo, fields[2]))
+		}
+		res.records = append(res.records, rec)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	res.inQueue = make(chan []byte, numIn)
+	res.releaseInbound()
+	return res, nil
+}
+
+// releaseInbound queues the inbound reports in front of the next outbound report, records has to be locked or unshared
+func (t *replayTransport) releaseInbound() {
+	for len(t.records) > 0 && t.records[0].direction == PACKET_DIRECTION_IN {
+		t.inQueue <- t.records[0].report
+		t.records = t.records[1:]
+	}
+}
+
+func (t *replayTransport) Write(report []byte) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.records) == 0 {
+		return errors.New(fmt.Sprintf("replayed session has ended, unexpected report % 02x", report))
+	}
+	if expected := t.records[0].report; !bytes.Equal(expected, report) {
+		return errors.New(fmt.Sprintf("report % 02x doesn't match recorded report % 02x", report, expected))
+	}
+	t.records = t.records[1:]
+	t.releaseInbound()
+	return nil
+}
+
+func (t *replayTransport) Read(buf []byte, timeout time.Duration) (n int, err error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case report := <-t.inQueue:
+		return copy(buf, report), nil
+	case <-expired:
+		return 0, ErrTransportTimeout
+	case <-t.closed:
+		return 0, ErrDongleClosed
+	}
+}
+
+func (t *replayTransport) Close() error {
+	t.close.Do(func() { close(t.closed) })
+	return nil
+}
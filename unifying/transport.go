@@ -0,0 +1,182 @@
+package unifying
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/gousb"
+	"time"
+)
+
+var (
+	ErrTransportTimeout = errors.New("transport read timeout")
+)
+
+// Transport abstracts the exchange of raw HID reports with a receiver. The real implementation talks to the HID++
+// interface of a USB receiver, other implementations allow using LocalUSBDongle without hardware.
+type Transport interface {
+	// Write sends a single output report, the first byte is the report ID
+	Write(report []byte) error
+	// Read receives a single input report into buf and returns its length. If no report arrives before the timeout
+	// expires, ErrTransportTimeout is returned. A timeout <= 0 blocks till a report arrives.
+	Read(buf []byte, timeout time.Duration) (n int, err error)
+	Close() error
+}
+
+// usbTransport is the Transport used for receivers accessed with gousb
+type usbTransport struct {
+	ctx    *gousb.Context
+	dev    *gousb.Device
+	config *gousb.Config
+	iface  *gousb.Interface
+	epIn   *gousb.InEndpoint
+
+	outputSizes map[byte]int // output report sizes (including report ID) from the HID report descriptor, nil if unknown
+}
+
+func (t *usbTransport) Write(report []byte) (err error) {
+	if len(report) == 0 {
+		return errors.New("empty report")
+	}
+	if size, known := t.outputSizes[report[0]]; known {
+		// the receiver expects reports of exactly the size given by the report descriptor
+		if len(report) > size {
+			return errors.New(fmt.Sprintf("report of %d bytes exceeds size of output report %#02x (%d bytes)", len(report), report[0], size))
+		}
+		if len(report) < size {
+			report = append(report, make([]byte, size-len(report))...)
+		}
+	}
+	_, err = t.dev.Control(
+		0x21,                           //bit7: Host to device, bit6..5: Class: 0x1, bit4..0: Interface: 0x01
+		0x09,                           //request: 0x09 SET_REPORT
+		0x0200|uint16(report[0]),       //Output: 0x02, Report ID: 0x10
+		uint16(t.iface.Setting.Number), //interface index 0x02
+		report,                         //payload
+	)
+	return
+}
+
+func (t *usbTransport) Read(buf []byte, timeout time.Duration) (n int, err error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		ctxNew, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		ctx = ctxNew
+	}
+
+	n, err = t.epIn.ReadContext(ctx, buf)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = ErrTransportTimeout
+	}
+	return
+}
+
+func (t *usbTransport) Close() error {
+	if t.iface != nil {
+		t.iface.Close()
+	}
+
+	if t.config != nil {
+		t.config.Close()
+	}
+
+	if t.dev != nil {
+		t.dev.SetAutoDetach(false)
+		//t.dev.Reset()
+		t.dev.Close()
+	}
+
+	if t.ctx != nil {
+		t.ctx.Close()
+	}
+	return nil
+}
+
+// readReportDescriptor fetches the HID report descriptor of the given interface (GET_DESCRIPTOR request for
+// descriptor type 0x22)
+func readReportDescriptor(dev *gousb.Device, ifaceNumber int) (desc []byte, err error) {
+	buf := make([]byte, 4096)
+	n, err := dev.Control(
+		0x81,                //bit7: Device to host, bit6..5: Standard: 0x0, bit4..0: Interface: 0x01
+		0x06,                //request: 0x06 GET_DESCRIPTOR
+		0x2200,              //descriptor type: 0x22 HID report, index: 0x00
+		uint16(ifaceNumber), //interface index
+		buf,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// parseReportSizes determines the sizes of input and output reports (in bytes, including the report ID) defined by
+// a HID report descriptor. Only short items are evaluated, the global item state is tracked across Push/Pop.
+func parseReportSizes(desc []byte) (input map[byte]int, output map[byte]int, err error) {
+	type globals struct {
+		reportID    byte
+		reportSize  uint32
+		reportCount uint32
+	}
+	var g globals
+	var stack []globals
+	inBits := make(map[byte]uint32)
+	outBits := make(map[byte]uint32)
+
+	for pos := 0; pos < len(desc); {
+		prefix := desc[pos]
+		if prefix == 0xfe {
+			// long item, data size follows
+			if pos+1 >= len(desc) {
+				return nil, nil, errors.New("truncated long item in report descriptor")
+			}
+			pos += 3 + int(desc[pos+1])
+			continue
+		}
+		size := int(prefix & 0x03)
+		if size == 3 {
+			size = 4
+		}
+		if pos+1+size > len(desc) {
+			return nil, nil, errors.New(fmt.Sprintf("truncated item at offset %d of report descriptor", pos))
+		}
+		value := uint32(0)
+		for i := size - 1; i >= 0; i-- {
+			value = value<<8 | uint32(desc[pos+1+i])
+		}
+		pos += 1 + size
+
+		switch prefix & 0xfc {
+		case 0x74: // Report Size
+			g.reportSize = value
+		case 0x94: // Report Count
+			g.reportCount = value
+		case 0x84: // Report ID
+			g.reportID = byte(value)
+		case 0xa4: // Push
+			stack = append(stack, g)
+		case 0xb4: // Pop
+			if len(stack) == 0 {
+				return nil, nil, errors.New("pop without push in report descriptor")
+			}
+			g = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		case 0x80: // Input
+			inBits[g.reportID] += g.reportSize * g.reportCount
+		case 0x90: // Output
+			outBits[g.reportID] += g.reportSize * g.reportCount
+		}
+	}
+
+	toBytes := func(bits map[byte]uint32) map[byte]int {
+		sizes := make(map[byte]int)
+		for id, b := range bits {
+			sizes[id] = int((b + 7) / 8)
+			if id != 0 {
+				sizes[id]++ // report ID prefix
+			}
+		}
+		return sizes
+	}
+	return toBytes(inBits), toBytes(outBits), nil
+}
@@ -0,0 +1,59 @@
+package unifying
+
+import (
+	"testing"
+)
+
+// testHIDPPReportDescriptor is the report descriptor of the HID++ interface of a Unifying receiver (C52B)
+var testHIDPPReportDescriptor = []byte{
+	0x06, 0x00, 0xff, 0x09, 0x01, 0xa1, 0x01, // vendor page, application collection
+	0x85, 0x10, 0x75, 0x08, 0x95, 0x06, 0x15, 0x00, 0x26, 0xff, 0x00, 0x09, 0x01, 0x81, 0x00, 0x09, 0x01, 0x91, 0x00, // short HID++
+	0xc0,
+	0x06, 0x00, 0xff, 0x09, 0x02, 0xa1, 0x01,
+	0x85, 0x11, 0x75, 0x08, 0x95, 0x13, 0x15, 0x00, 0x26, 0xff, 0x00, 0x09, 0x02, 0x81, 0x00, 0x09, 0x02, 0x91, 0x00, // long HID++
+	0xc0,
+	0x06, 0x00, 0xff, 0x09, 0x04, 0xa1, 0x01,
+	0x85, 0x20, 0x75, 0x08, 0x95, 0x0e, 0x15, 0x00, 0x26, 0xff, 0x00, 0x09, 0x41, 0x81, 0x00, 0x09, 0x41, 0x91, 0x00, // short DJ
+	0x85, 0x21, 0x95, 0x1f, 0x15, 0x00, 0x26, 0xff, 0x00, 0x09, 0x42, 0x81, 0x00, 0x09, 0x42, 0x91, 0x00, // long DJ
+	0xc0,
+}
+
+func TestParseReportSizes(t *testing.T) {
+	input, output, err := parseReportSizes(testHIDPPReportDescriptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[byte]int{0x10: 7, 0x11: 20, 0x20: 15, 0x21: 32}
+	for _, sizes := range []map[byte]int{input, output} {
+		if len(sizes) != len(want) {
+			t.Errorf("report sizes %v, want %v", sizes, want)
+			continue
+		}
+		for id, size := range want {
+			if sizes[id] != size {
+				t.Errorf("report %#02x has %d bytes, want %d", id, sizes[id], size)
+			}
+		}
+	}
+}
+
+func TestParseReportSizesPushPop(t *testing.T) {
+	desc := []byte{
+		0x85, 0x10, 0x75, 0x08, 0x95, 0x06,
+		0xa4,       // Push
+		0x95, 0x02, // Report Count 2
+		0x81, 0x00, // Input (2 bytes)
+		0xb4,       // Pop
+		0x81, 0x00, // Input (6 bytes)
+	}
+	input, _, err := parseReportSizes(desc)
+	if err != nil || input[0x10] != 1+2+6 {
+		t.Errorf("input report size %d (%v), want 9", input[0x10], err)
+	}
+
+	for _, desc := range [][]byte{{0xb4}, {0x85}, {0xfe}} {
+		if _, _, err := parseReportSizes(desc); err == nil {
+			t.Errorf("invalid descriptor % 02x accepted", desc)
+		}
+	}
+}
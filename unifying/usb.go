@@ -5,15 +5,39 @@ import (
 	"errors"
 	"fmt"
 	"github.com/google/gousb"
-	log "github.com/sirupsen/logrus"
+	"sync"
 	"time"
 )
 
 var (
 	eNoDongle                   = errors.New("no Logitech Receiver dongle found")
 	ErrReceiverInBootloaderMode = errors.New("detected Logitech receiver seems to run in bootloader mode")
+	ErrDongleClosed             = errors.New("receiver has already been closed")
+	ErrReceiveTimeout           = errors.New("timeout reached")
 )
 
+// USBTransportError is returned by bootloader requests, which got no response from the receiver (timeout or the
+// receiver vanished from the bus). Contrary to errors reported by the bootloader, the request could succeed if
+// repeated after re-opening the receiver (see USBBootloaderDongle.Reopen).
+type USBTransportError struct {
+	Op  string
+	Err error
+}
+
+func (e *USBTransportError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *USBTransportError) Unwrap() error {
+	return e.Err
+}
+
+// IsRecoverableUSBError reports if err is (or wraps) an USBTransportError
+func IsRecoverableUSBError(err error) bool {
+	var transportErr *USBTransportError
+	return errors.As(err, &transportErr)
+}
+
 const (
 	VID                  gousb.ID = 0x046d
 	PID_UNIFYING         gousb.ID = 0xc52b //cu0007, cu0008, cu0012
@@ -22,6 +46,7 @@ const (
 	PID_CU0016_SPOTLIGHT gousb.ID = 0xc53e //R-R0011
 	PID_CU0014_R400      gousb.ID = 0xc538 //R-R0011
 	PID_CU0007_G700      gousb.ID = 0xc531 //G700/G700s
+	PID_BOLT             gousb.ID = 0xc548 //Logi Bolt, different pairing information layout (see ReceiverGeneration)
 
 	PID_BOOT_LOADER_NORDIC          gousb.ID = 0xaaaa //CU0007, tested BOT01.02_B0014 / RQR12.01_B0019 and BOT01.02_B0015 / RQR12.01_B0019; HW_PLATFORM_ID: nRF24LU1+
 	PID_BOOT_LOADER_NORDIC2          gousb.ID = 0x0003 //CU0007, tested BOT01.02_B0014 / RQR12.01_B0019 and BOT01.02_B0015 / RQR12.01_B0019; HW_PLATFORM_ID: nRF24LU1+
@@ -39,23 +64,58 @@ type LocalUSBDongle struct {
 	IfaceHIDPP *gousb.Interface
 	EpInHidPP  *gousb.InEndpoint
 
+	transport Transport
+
 	sndQueue chan USBReport
 	rcvQueue chan USBReport
 	cancel   context.CancelFunc
 	ctx      context.Context
 
 	showInOut bool
-	wasClosed bool
+	logger    Logger // package Logger (see SetLogger) if nil
+
+	tracerMutex sync.Mutex // guards tracer
+	tracer      PacketTracer
+
+	closeMutex sync.Mutex // guards closed
+	closed     bool
 
 	epHIDppPacketSize int //32 byte for most receivers, 20 for older ones (G700/G700s)
+
+	reqMutex        sync.Mutex // serializes request/response exchanges with the receiver
+	lastRequest     time.Time
+	keepAliveCancel context.CancelFunc
+
+	featureMutex sync.Mutex
+	featureCache map[byte]map[uint16]featureEntry // HID++ 2.0 feature indices per device index
+
+	inputReportSizes  map[byte]int // report sizes per report ID from the HID report descriptor, nil if unknown
+	outputReportSizes map[byte]int
+
+	notificationMutex      sync.Mutex // guards the notification settings and the drop counter
+	notificationBufferSize int
+	notificationBlock      bool
+	droppedNotifications   uint64
+
+	responseTimeout time.Duration // RESPONSE_TIMEOUT if zero
 }
 
 func (u *LocalUSBDongle) SendUSBReport(msg USBReport) (err error) {
-	u.sndQueue <- msg
-	return nil
+	if u.isClosed() {
+		return ErrDongleClosed
+	}
+	select {
+	case u.sndQueue <- msg:
+		return nil
+	case <-u.ctx.Done():
+		return ErrDongleClosed
+	}
 }
 
 func (u *LocalUSBDongle) ReceiveUSBReport(timeoutMillis int) (msg USBReport, err error) {
+	if u.isClosed() {
+		return nil, ErrDongleClosed
+	}
 	ctx := context.Background()
 	if timeoutMillis > 0 {
 		ctxNew, cancel := context.WithTimeout(ctx, time.Duration(timeoutMillis)*time.Millisecond)
@@ -64,10 +124,13 @@ func (u *LocalUSBDongle) ReceiveUSBReport(timeoutMillis int) (msg USBReport, err
 	}
 
 	select {
-	case rcv := <-u.rcvQueue:
+	case rcv, ok := <-u.rcvQueue:
+		if !ok {
+			return msg, ErrDongleClosed
+		}
 		msg = rcv
 	case <-ctx.Done():
-		err = errors.New("timeout reached")
+		err = ErrReceiveTimeout
 	}
 
 	return
@@ -77,13 +140,22 @@ func (u *LocalUSBDongle) rcvLoop() {
 	buf := make([]byte, u.epHIDppPacketSize)
 
 	for {
-		n, err := u.EpInHidPP.ReadContext(u.ctx, buf)
-		if err != nil {
+		n, err := u.transport.Read(buf, 200*time.Millisecond)
+		if err == ErrTransportTimeout {
+			if u.ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if err != nil || u.ctx.Err() != nil {
 			break
 		}
 
 		if u.showInOut {
-			fmt.Printf("\nIn: % #x\n", buf[:n])
+			u.logf("\n%s\n", traceReport("IN ", buf[:n]))
+		}
+		if tracer := u.packetTracer(); tracer != nil {
+			tracer(PACKET_DIRECTION_IN, buf[:n])
 		}
 		switch USBReportType(buf[0]) {
 		case USB_REPORT_TYPE_HIDPP_SHORT:
@@ -95,7 +167,7 @@ func (u *LocalUSBDongle) rcvLoop() {
 				//fmt.Println("HID++ message")
 				u.rcvQueue <- &inMsg
 			} else {
-				fmt.Printf("Invalid HID++ message: % x\n", buf[:n])
+				u.logf("Invalid HID++ message: % x\n", buf[:n])
 			}
 		case USB_REPORT_TYPE_DJ_SHORT:
 			fallthrough
@@ -106,10 +178,10 @@ func (u *LocalUSBDongle) rcvLoop() {
 				//fmt.Println("DJ Report")
 				u.rcvQueue <- &inMsg
 			} else {
-				fmt.Printf("Invalid DJ Report: % x\n", buf[:n])
+				u.logf("Invalid DJ Report: % x\n", buf[:n])
 			}
 		default:
-			fmt.Printf("Unknown USB input report: % x\n", buf[:n])
+			u.logf("Unknown USB input report: % x\n", buf[:n])
 		}
 	}
 
@@ -125,61 +197,143 @@ Outer:
 		case outMsg := <-u.sndQueue:
 			outdata, err := outMsg.ToWire()
 			if err != nil {
-				fmt.Println("Error processing outbound HID++ message", err)
+				u.logln("Error processing outbound HID++ message", err)
+				continue
 			}
 
 			if u.showInOut {
-				fmt.Printf("Out: % #x\n", outdata)
+				u.logln(traceReport("OUT", outdata))
+			}
+			if tracer := u.packetTracer(); tracer != nil {
+				tracer(PACKET_DIRECTION_OUT, outdata)
+			}
+			if err = u.transport.Write(outdata); err != nil {
+				u.logln("Error sending outbound report", err)
 			}
-			u.Dev.Control(
-				0x21,                                //bit7: Host to device, bit6..5: Class: 0x1, bit4..0: Interface: 0x01
-				0x09,                                //request: 0x09 SET_REPORT
-				0x0200|uint16(outdata[0]),           //Output: 0x02, Report ID: 0x10
-				uint16(u.IfaceHIDPP.Setting.Number), //interface index 0x02
-				outdata,                             //payload
-			)
 		}
 	}
-
-	close(u.sndQueue)
 }
 
+// SetShowInOut enables tracing of the reports exchanged with the receiver. Enabling it installs StdoutLogger for the
+// dongle, unless a Logger has been set with SetLogger.
 func (u *LocalUSBDongle) SetShowInOut(show bool) {
 	u.showInOut = show
+	if show && u.logger == nil {
+		u.logger = StdoutLogger
+	}
 	return
 }
 
-func (u *LocalUSBDongle) Close() {
-	if u.wasClosed {
+// SetPacketTracer installs a function, which is called with every report sent to (before it is written) and received
+// from the receiver. It is called from the goroutines exchanging the reports, the report is only valid during the
+// call. A nil tracer removes the current one.
+func (u *LocalUSBDongle) SetPacketTracer(tracer PacketTracer) {
+	u.tracerMutex.Lock()
+	u.tracer = tracer
+	u.tracerMutex.Unlock()
+}
+
+func (u *LocalUSBDongle) packetTracer() PacketTracer {
+	u.tracerMutex.Lock()
+	defer u.tracerMutex.Unlock()
+	return u.tracer
+}
+
+// SetLogger sets the Logger for the output of this dongle, a nil Logger uses the Logger of the package again
+func (u *LocalUSBDongle) SetLogger(l Logger) {
+	u.logger = l
+}
+
+func (u *LocalUSBDongle) logf(format string, v ...interface{}) {
+	if u.logger == nil {
+		logf(format, v...)
 		return
 	}
-	u.wasClosed = true
+	u.logger.Printf(format, v...)
+}
 
-	fmt.Println("Closing Logitech receiver in Firmware mode (not bootloader)...")
-	if u.cancel != nil {
-		u.cancel()
+func (u *LocalUSBDongle) logln(v ...interface{}) {
+	u.logf("%s", fmt.Sprintln(v...))
+}
+
+// SetKeepAlive starts polling the (harmless) connection state register, whenever no other request has been sent to
+// the receiver for the given interval. This prevents the receiver from dropping the USB connection during long
+// operations. As the poll is serialized with other requests, it never interleaves with a request in flight.
+// Reports received while the poll waits for its response are consumed, thus the keep-alive shouldn't be combined
+// with loops reading notifications via ReceiveUSBReport (f.e. pairing). An interval <= 0 disables the keep-alive.
+func (u *LocalUSBDongle) SetKeepAlive(interval time.Duration) {
+	if u.keepAliveCancel != nil {
+		u.keepAliveCancel()
+		u.keepAliveCancel = nil
+	}
+	if interval <= 0 || u.ctx == nil {
+		return
 	}
 
-	if u.IfaceHIDPP != nil {
-		u.IfaceHIDPP.Close()
+	ctx, cancel := context.WithCancel(u.ctx)
+	u.keepAliveCancel = cancel
+	go u.keepAliveLoop(ctx, interval)
+}
+
+func (u *LocalUSBDongle) keepAliveLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.reqMutex.Lock()
+			idle := time.Since(u.lastRequest) >= interval
+			u.reqMutex.Unlock()
+			if idle {
+				u.HIDPP_SendAndCollectResponses(0xff, HIDPP_MSG_ID_GET_REGISTER_REQ, []byte{byte(DONGLE_HIDPP_REGISTER_CONNECTION_STATE)})
+			}
+		}
 	}
+}
 
-	if u.Config != nil {
-		u.Config.Close()
+// isClosed reports if Close has been called
+func (u *LocalUSBDongle) isClosed() bool {
+	u.closeMutex.Lock()
+	defer u.closeMutex.Unlock()
+	return u.closed
+}
+
+// Close releases the receiver. Calling Close more than once is safe, methods communicating with the receiver return
+// ErrDongleClosed afterwards.
+func (u *LocalUSBDongle) Close() {
+	u.closeMutex.Lock()
+	defer u.closeMutex.Unlock()
+	if u.closed {
+		return
 	}
+	u.closed = true
 
-	if u.Dev != nil {
-		u.Dev.SetAutoDetach(false)
-		//u.Dev.Reset()
-		u.Dev.Close()
+	u.logln("Closing Logitech receiver in Firmware mode (not bootloader)...")
+	if u.cancel != nil {
+		u.cancel()
 	}
 
-	if u.UsbCtx != nil {
-		u.UsbCtx.Close()
+	if u.transport != nil {
+		u.transport.Close()
+	} else {
+		// opening the receiver failed before the transport has been created, release what has been acquired so far
+		(&usbTransport{ctx: u.UsbCtx, dev: u.Dev, config: u.Config, iface: u.IfaceHIDPP}).Close()
 	}
 }
 
 func (u *LocalUSBDongle) HIDPP_SendAndCollectResponses(deviceID byte, id HidPPMsgSubID, parameters []byte) (responseReports []USBReport, err error) {
+	u.reqMutex.Lock()
+	defer u.reqMutex.Unlock()
+	return u.hidppSendAndCollectResponses(deviceID, id, parameters)
+}
+
+// hidppSendAndCollectResponses implements HIDPP_SendAndCollectResponses, the caller has to hold reqMutex
+func (u *LocalUSBDongle) hidppSendAndCollectResponses(deviceID byte, id HidPPMsgSubID, parameters []byte) (responseReports []USBReport, err error) {
+	u.lastRequest = time.Now()
+
 	params := make([]byte, USB_REPORT_TYPE_HIDPP_SHORT_PAYLOAD_LEN)
 	reportType := USB_REPORT_TYPE_HIDPP_SHORT
 
@@ -196,7 +350,9 @@ func (u *LocalUSBDongle) HIDPP_SendAndCollectResponses(deviceID byte, id HidPPMs
 		MsgSubID:   id,
 		Parameters: params,
 	}
-	u.SendUSBReport(hidppReq)
+	if err = u.SendUSBReport(hidppReq); err != nil {
+		return
+	}
 
 	//We collect all response reports (DJ and HID++), till ...
 	//  1) we receive the response matching the request
@@ -205,7 +361,10 @@ func (u *LocalUSBDongle) HIDPP_SendAndCollectResponses(deviceID byte, id HidPPMs
 	// We send back an error, if USB response timeout is reached, along with reports collected so far
 
 	for {
-		rspUSB, err := u.ReceiveUSBReport(500)
+		rspUSB, err := u.ReceiveUSBReport(u.responseTimeoutMillis())
+		if err == ErrDongleClosed {
+			return responseReports, err
+		}
 		if err != nil {
 			return responseReports, errors.New("USB response timeout")
 		} else {
@@ -228,7 +387,20 @@ func (u *LocalUSBDongle) HIDPP_SendAndCollectResponses(deviceID byte, id HidPPMs
 
 				if rspHIDpp.DeviceID == deviceID && rspHIDpp.MsgSubID == HIDPP_MSG_ID_ERROR_MSG && rspHIDpp.Parameters[0] == byte(id) {
 					// likely final response, return
-					return responseReports, errors.New("HID++ error response")
+					return responseReports, &HidPPError{
+						SubID:    id,
+						Register: rspHIDpp.Parameters[1],
+						Code:     HidPPErrorCode(rspHIDpp.Parameters[2]),
+					}
+				}
+
+				if rspHIDpp.DeviceID == deviceID && byte(rspHIDpp.MsgSubID) == HIDPP20_ERROR_MSG && rspHIDpp.Parameters[0] == byte(id) {
+					// HID++ 2.0 error for the feature index used as sub ID
+					return responseReports, &HidPP20Error{
+						FeatureIndex: byte(id),
+						Function:     rspHIDpp.Parameters[1] >> 4,
+						Code:         HidPPErrorCode(rspHIDpp.Parameters[2]),
+					}
 				}
 			}
 		}
@@ -256,12 +428,105 @@ func (u *LocalUSBDongle) HIDPP_Send(deviceID byte, id HidPPMsgSubID, parameters
 	return u.SendUSBReport(hidppReq)
 }
 
+// registerRequest sends a register request to the receiver and returns the parameters of the matching response,
+// following the register address
+func (u *LocalUSBDongle) registerRequest(id HidPPMsgSubID, reg byte, params []byte) (res []byte, err error) {
+	responses, err := u.HIDPP_SendAndCollectResponses(0xff, id, append([]byte{reg}, params...))
+	if err != nil {
+		return
+	}
+	for _, r := range responses {
+		if r.IsHIDPP() {
+			hppmsg := r.(*HidPPMsg)
+			if hppmsg.DeviceID == 0xff && hppmsg.MsgSubID == id && len(hppmsg.Parameters) > 0 && hppmsg.Parameters[0] == reg {
+				return hppmsg.Parameters[1:], nil
+			}
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("no response for register %#02x", reg))
+}
+
+// readChunked collects total bytes with repeated calls of reqFn, which returns the chunk starting at the given offset.
+// The read stops early on a failed request or an empty chunk (short read), in this case the data read so far is
+// returned together with an error. A last chunk exceeding total is truncated.
+func (u *LocalUSBDongle) readChunked(reqFn func(offset byte) ([]byte, error), total int) (res []byte, err error) {
+	if total > 0x100 {
+		return nil, errors.New(fmt.Sprintf("chunked read of %d bytes exceeds the 8 bit offset range", total))
+	}
+	res = make([]byte, 0, total)
+	for len(res) < total {
+		chunk, eChunk := reqFn(byte(len(res)))
+		if eChunk != nil {
+			return res, errors.New(fmt.Sprintf("partial read (%d of %d bytes): %v", len(res), total, eChunk))
+		}
+		if len(chunk) == 0 {
+			return res, errors.New(fmt.Sprintf("short read (%d of %d bytes)", len(res), total))
+		}
+		if rest := total - len(res); len(chunk) > rest {
+			chunk = chunk[:rest]
+		}
+		res = append(res, chunk...)
+	}
+	return
+}
+
+// GetRegister reads the given receiver register, params are the additional request parameters (f.e. the
+// sub-register). The register is read with a short request first, if the receiver rejects this, the read is repeated
+// as long register request. The returned data starts with the first byte following the register address.
+func (u *LocalUSBDongle) GetRegister(reg byte, params []byte) (res []byte, err error) {
+	if len(params) > USB_REPORT_TYPE_HIDPP_SHORT_PAYLOAD_LEN-1 {
+		return nil, errors.New("too many parameters for register read request")
+	}
+	res, err = u.registerRequest(HIDPP_MSG_ID_GET_REGISTER_REQ, reg, params)
+	if _, isHidPPErr := err.(*HidPPError); isHidPPErr {
+		res, err = u.GetLongRegister(reg, params)
+	}
+	return
+}
+
+// GetLongRegister reads the given receiver register using a long register request
+func (u *LocalUSBDongle) GetLongRegister(reg byte, params []byte) (res []byte, err error) {
+	if len(params) > USB_REPORT_TYPE_HIDPP_SHORT_PAYLOAD_LEN-1 {
+		return nil, errors.New("too many parameters for register read request")
+	}
+	return u.registerRequest(HIDPP_MSG_ID_GET_LONG_REGISTER_REQ, reg, params)
+}
+
+// SetRegister writes value to the given receiver register. Values fitting into a short report (up to 3 bytes) are
+// written with a short request, longer ones (up to 16 bytes) with a long register request.
+func (u *LocalUSBDongle) SetRegister(reg byte, value []byte) (err error) {
+	id := HIDPP_MSG_ID_SET_REGISTER_REQ
+	switch {
+	case len(value) <= USB_REPORT_TYPE_HIDPP_SHORT_PAYLOAD_LEN-1:
+	case len(value) <= USB_REPORT_TYPE_HIDPP_LONG_PAYLOAD_LEN-1:
+		id = HIDPP_MSG_ID_SET_LONG_REGISTER_REQ
+	default:
+		return errors.New(fmt.Sprintf("value for register %#02x exceeds %d bytes", reg, USB_REPORT_TYPE_HIDPP_LONG_PAYLOAD_LEN-1))
+	}
+	_, err = u.registerRequest(id, reg, value)
+	return
+}
+
+// ProbeRegister checks if the receiver implements the given register, by reading it (short read, long read as
+// fallback). Registers answered with an invalid address error are reported as missing, other HID++ errors (f.e. an
+// invalid value, because the register expects parameters) as present. Nothing is written to the receiver.
+func (u *LocalUSBDongle) ProbeRegister(reg byte) (present bool, err error) {
+	_, err = u.GetRegister(reg, nil)
+	if hppErr, isHidPPErr := err.(*HidPPError); isHidPPErr {
+		return byte(hppErr.Code) != hidpp10ErrorInvalidAddress, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (u *LocalUSBDongle) EnablePairing(timeOutSeconds byte, devNumber byte, blockTillOff bool) (err error) {
 	//Enable pairing
-	connectDevices := byte(0x01) //open lock
+	connectDevices := byte(UNIFYING_PAIRING_P0_OPEN_LOCK)
 	deviceNumber := devNumber    //According to specs: Same value as device index transmitted in 0x41 notification, but we haven't tx'ed anything
 	openLockTimeout := timeOutSeconds
-	fmt.Printf("Enable pairing for %d seconds\n", openLockTimeout)
+	u.logf("Enable pairing for %d seconds\n", openLockTimeout)
 
 	/*
 		if !blockTillOff {
@@ -270,44 +535,31 @@ func (u *LocalUSBDongle) EnablePairing(timeOutSeconds byte, devNumber byte, bloc
 	*/
 	responses, err := u.HIDPP_SendAndCollectResponses(0xff, HIDPP_MSG_ID_SET_REGISTER_REQ, []byte{byte(DONGLE_HIDPP_REGISTER_PAIRING), connectDevices, deviceNumber, openLockTimeout})
 	for _, r := range responses {
-		fmt.Println(r.String())
+		u.logln(r.String())
 	}
 	if err != nil {
 		return
 	}
 
-	fmt.Println("... Enable pairing response (should be enabled)\n")
+	u.logln("... Enable pairing response (should be enabled)")
 
 	if !blockTillOff {
 		return nil
 	}
 
 	//Parse successive input reports till new "receiver lock information" with lock closed occurs
-	fmt.Println("Printing follow up reports ...")
+	u.logln("Printing follow up reports ...")
 	for {
 		rspUSB, err := u.ReceiveUSBReport(500)
 		if err == nil {
 
-			fmt.Println(rspUSB.String())
+			u.logln(rspUSB.String())
 			if rspUSB.IsHIDPP() {
 				hidppRsp := rspUSB.(*HidPPMsg)
 				if hidppRsp.MsgSubID == HIDPP_MSG_ID_RECEIVER_LOCKING_INFORMATION && (hidppRsp.Parameters[0]&0x01) == 0 {
-					switch hidppRsp.Parameters[1] {
-					case 0x00:
-						return nil //"no error"
-					case 0x01:
-						return errors.New("pairing timeout or interrupted")
-					case 0x02:
-						return errors.New("unsupported device")
-					case 0x03:
-						return errors.New("too many devices")
-					case 0x06:
-						return errors.New("connection sequence timeout")
-					default:
-						return errors.New("pairing aborted with unknown reason")
-					}
+					return pairingLockError(hidppRsp.Parameters[1])
 
-					fmt.Println("Pairing lock closed")
+					u.logln("Pairing lock closed")
 					return err
 				}
 
@@ -315,7 +567,7 @@ func (u *LocalUSBDongle) EnablePairing(timeOutSeconds byte, devNumber byte, bloc
 				if hidppRsp.MsgSubID == HIDPP_MSG_ID_DEVICE_CONNECTION {
 					devIdx := hidppRsp.DeviceID
 					wpid := uint16(hidppRsp.Parameters[3])<<8 + uint16(hidppRsp.Parameters[2])
-					fmt.Printf("DEVICE CONNECTION ON INDEX: %02x TYPE: %s WPID: %#04x\n", devIdx, DeviceType(hidppRsp.Parameters[1]&0x0F), wpid)
+					u.logf("DEVICE CONNECTION ON INDEX: %02x TYPE: %s WPID: %#04x\n", devIdx, DeviceType(hidppRsp.Parameters[1]&0x0F), wpid)
 
 					//request additional information
 				}
@@ -326,21 +578,196 @@ func (u *LocalUSBDongle) EnablePairing(timeOutSeconds byte, devNumber byte, bloc
 
 }
 
+// pairingLockError translates the error code of a "receiver locking information" notification, reporting a closed
+// pairing lock, to an error (nil if a device has been paired)
+func pairingLockError(code byte) error {
+	switch code {
+	case 0x00:
+		return nil //"no error"
+	case 0x01:
+		return errors.New("pairing timeout or interrupted")
+	case 0x02:
+		return errors.New("unsupported device")
+	case 0x03:
+		return errors.New("too many devices")
+	case 0x06:
+		return errors.New("connection sequence timeout")
+	default:
+		return errors.New("pairing aborted with unknown reason")
+	}
+}
+
+type PairingStage byte
+
+const (
+	PAIRING_STAGE_LOCK_OPEN       PairingStage = 0x00 // pairing window opened, receiver accepts new devices
+	PAIRING_STAGE_DEVICE_DETECTED PairingStage = 0x01 // a device connected while the pairing window is open
+	PAIRING_STAGE_COMPLETE        PairingStage = 0x02 // pairing window closed, device paired
+	PAIRING_STAGE_FAILED          PairingStage = 0x03 // pairing window closed without success (or aborted)
+)
+
+func (s PairingStage) String() string {
+	switch s {
+	case PAIRING_STAGE_LOCK_OPEN:
+		return "PAIRING WINDOW OPEN"
+	case PAIRING_STAGE_DEVICE_DETECTED:
+		return "DEVICE DETECTED"
+	case PAIRING_STAGE_COMPLETE:
+		return "PAIRING COMPLETE"
+	case PAIRING_STAGE_FAILED:
+		return "PAIRING FAILED"
+	}
+	return fmt.Sprintf("Unknown pairing stage %02x", byte(s))
+}
+
+// PairingEvent reports the progress of StartPairingWithEvents. Device is set for PAIRING_STAGE_DEVICE_DETECTED and
+// for PAIRING_STAGE_COMPLETE (if a device connection has been seen), Err for PAIRING_STAGE_FAILED.
+type PairingEvent struct {
+	Stage  PairingStage
+	Device *DeviceConnection
+	Err    error
+}
+
+func (e PairingEvent) String() string {
+	res := e.Stage.String()
+	if e.Device != nil {
+		res += ": " + e.Device.String()
+	}
+	if e.Err != nil {
+		res += fmt.Sprintf(": %v", e.Err)
+	}
+	return res
+}
+
+// StartPairingWithEvents works like StartPairing (using the default pairing timeout of the receiver), but reports the
+// progress to events. Pairing is aborted (pairing lock closed) if ctx is done. Events are delivered blocking, thus
+// events has to be read till the call returns (or ctx is done); the channel isn't closed.
+func (u *LocalUSBDongle) StartPairingWithEvents(ctx context.Context, events chan<- PairingEvent) (err error) {
+	emit := func(e PairingEvent) {
+		select {
+		case events <- e:
+		case <-ctx.Done():
+		}
+	}
+
+	wasLocked, err := u.GetPairingLock()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if locked, eLock := u.GetPairingLock(); eLock == nil && locked != wasLocked {
+			if eLock = u.SetPairingLock(wasLocked); err == nil {
+				err = eLock
+			}
+		}
+	}()
+
+	if err = u.SetPairingLock(false); err != nil {
+		return
+	}
+	emit(PairingEvent{Stage: PAIRING_STAGE_LOCK_OPEN})
+
+	var device *DeviceConnection
+	for {
+		if ctx.Err() != nil {
+			u.SetPairingLock(true)
+			emit(PairingEvent{Stage: PAIRING_STAGE_FAILED, Err: ctx.Err()})
+			return ctx.Err()
+		}
+		r, eRcv := u.ReceiveUSBReport(100)
+		if eRcv == ErrDongleClosed {
+			return eRcv
+		}
+		if eRcv != nil || !r.IsHIDPP() {
+			continue
+		}
+		msg := r.(*HidPPMsg)
+		switch {
+		case msg.MsgSubID == HIDPP_MSG_ID_DEVICE_CONNECTION:
+			if dc, eDc := ParseDeviceConnection(msg); eDc == nil {
+				device = &dc
+				emit(PairingEvent{Stage: PAIRING_STAGE_DEVICE_DETECTED, Device: device})
+			}
+		case msg.MsgSubID == HIDPP_MSG_ID_RECEIVER_LOCKING_INFORMATION && len(msg.Parameters) >= 2 && msg.Parameters[0]&0x01 == 0:
+			if err = pairingLockError(msg.Parameters[1]); err != nil {
+				emit(PairingEvent{Stage: PAIRING_STAGE_FAILED, Err: err})
+				return err
+			}
+			emit(PairingEvent{Stage: PAIRING_STAGE_COMPLETE, Device: device})
+			return nil
+		}
+	}
+}
+
 func (u *LocalUSBDongle) DisablePairing() (err error) {
 	//Enable pairing
-	connectDevices := byte(0x02) //close lock
+	connectDevices := byte(UNIFYING_PAIRING_P0_CLOSE_LOCK)
 
 	_, err = u.HIDPP_SendAndCollectResponses(0xff, HIDPP_MSG_ID_SET_REGISTER_REQ, []byte{byte(DONGLE_HIDPP_REGISTER_PAIRING), connectDevices, 0, 0})
 	return err
 }
 
+// GetPairingLock reads the connection state register of the receiver and returns true if the pairing lock is closed
+// (no new devices are accepted), false if the receiver is in pairing mode.
+func (u *LocalUSBDongle) GetPairingLock() (locked bool, err error) {
+	connState, err := u.GetRegister(byte(DONGLE_HIDPP_REGISTER_CONNECTION_STATE), nil)
+	if err != nil {
+		return
+	}
+	if len(connState) < 1 {
+		return false, errors.New("connection state response too short")
+	}
+	return connState[0]&UNIFYING_CONNECTION_STATE_P0_PAIRING_LOCK_OPEN_MASK == 0, nil
+}
+
+// SetPairingLock closes (locked == true) or opens the pairing lock of the receiver. An opened lock uses the default
+// timeout of the receiver, use EnablePairing for a custom timeout.
+func (u *LocalUSBDongle) SetPairingLock(locked bool) (err error) {
+	action := byte(UNIFYING_PAIRING_P0_OPEN_LOCK)
+	if locked {
+		action = UNIFYING_PAIRING_P0_CLOSE_LOCK
+	}
+	return u.SetRegister(byte(DONGLE_HIDPP_REGISTER_PAIRING), []byte{action, 0x00, 0x00})
+}
+
+// CancelPairing closes an open pairing lock right away, instead of waiting for the pairing timeout of the receiver.
+// If the lock is closed already, nothing is written and nil is returned.
+func (u *LocalUSBDongle) CancelPairing() (err error) {
+	locked, err := u.GetPairingLock()
+	if err != nil {
+		return
+	}
+	if locked {
+		return nil
+	}
+	return u.SetPairingLock(true)
+}
+
+// StartPairing opens the pairing lock for timeOutSeconds and blocks till it is closed again (a device was paired,
+// the timeout was hit or pairing failed). Afterwards the lock state from before the call is restored.
+func (u *LocalUSBDongle) StartPairing(timeOutSeconds byte, devNumber byte) (err error) {
+	wasLocked, err := u.GetPairingLock()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if locked, eLock := u.GetPairingLock(); eLock == nil && locked != wasLocked {
+			if eLock = u.SetPairingLock(wasLocked); err == nil {
+				err = eLock
+			}
+		}
+	}()
+	return u.EnablePairing(timeOutSeconds, devNumber, true)
+}
+
 func (u *LocalUSBDongle) Unpair(deviceIndex byte) (err error) {
 	//Enable pairing
-	connectDevices := byte(0x03) //unpair
+	connectDevices := byte(UNIFYING_PAIRING_P0_UNPAIR)
 	deviceNumber := deviceIndex  //According to specs: Same value as device index transmitted in 0x41 notification, but we haven't tx'ed anything
+	u.ForgetFeatures(deviceIndex)
 	responses, err := u.HIDPP_SendAndCollectResponses(0xff, HIDPP_MSG_ID_SET_REGISTER_REQ, []byte{byte(DONGLE_HIDPP_REGISTER_PAIRING), connectDevices, deviceNumber})
 	for _, r := range responses {
-		fmt.Println(r.String())
+		u.logln(r.String())
 	}
 	return
 }
@@ -359,7 +786,7 @@ func (u *LocalUSBDongle) GetNumPairedDevices() (numPairedDevices byte, err error
 				break
 			}
 		}
-		fmt.Println(r.String())
+		u.logln(r.String())
 	}
 	if connStateResp == nil {
 		err = errors.New("couldn't determine count of paired devices")
@@ -371,6 +798,257 @@ func (u *LocalUSBDongle) GetNumPairedDevices() (numPairedDevices byte, err error
 	return
 }
 
+// GetConnectedDeviceCount reads only the connection state register of the receiver and returns the device count
+// reported there. Contrary to GetSetInfo or GetPairedDevices, no further registers are read and no device arrival
+// notifications are triggered, which makes it cheap enough to be polled frequently.
+func (u *LocalUSBDongle) GetConnectedDeviceCount() (count int, err error) {
+	connState, err := u.GetRegister(byte(DONGLE_HIDPP_REGISTER_CONNECTION_STATE), nil)
+	if err != nil {
+		return
+	}
+	if len(connState) < 2 {
+		return 0, errors.New("connection state response too short")
+	}
+	return int(connState[1]), nil
+}
+
+// EnableNotifications enables wireless (device connection) and software present notifications, as well as battery
+// status notifications of HID++ 1.0 devices
+func (u *LocalUSBDongle) EnableNotifications() (err error) {
+	return u.SetRegister(byte(DONGLE_HIDPP_REGISTER_WIRELESS_NOTIFICATIONS), []byte{
+		UNIYING_WIRELESS_NOTIFICATIONS_P0_BATTERY_STATUS_MASK,
+		UNIYING_WIRELESS_NOTIFICATIONS_P1_WIRELESS_NOTIFICATIONS_MASK | UNIYING_WIRELESS_NOTIFICATIONS_P1_SOFTWARE_PRESENT_MASK,
+		0x00,
+	})
+}
+
+// ReportSizes returns the sizes (in bytes, including the report ID) of the output reports of the HID++ interface,
+// per report ID. The sizes are read from the HID report descriptor when the receiver is opened and enforced when
+// writing (shorter reports are padded). If the descriptor couldn't be read (or a custom Transport is used), the sizes
+// of the HID++ reports defined by the protocol are returned.
+func (u *LocalUSBDongle) ReportSizes() map[byte]int {
+	res := make(map[byte]int)
+	if u.outputReportSizes == nil {
+		res[byte(USB_REPORT_TYPE_HIDPP_SHORT)] = USB_REPORT_TYPE_HIDPP_SHORT_LEN
+		res[byte(USB_REPORT_TYPE_HIDPP_LONG)] = USB_REPORT_TYPE_HIDPP_LONG_LEN
+		return res
+	}
+	for id, size := range u.outputReportSizes {
+		res[id] = size
+	}
+	return res
+}
+
+// InputReportSizes returns the sizes of the input reports of the HID++ interface read from the HID report
+// descriptor (see ReportSizes), nil if unknown
+func (u *LocalUSBDongle) InputReportSizes() map[byte]int {
+	if u.inputReportSizes == nil {
+		return nil
+	}
+	res := make(map[byte]int)
+	for id, size := range u.inputReportSizes {
+		res[id] = size
+	}
+	return res
+}
+
+// NOTIFICATION_BUFFER_SIZE is the default number of reports buffered by the channel returned from Notifications
+const NOTIFICATION_BUFFER_SIZE = 64
+
+// RESPONSE_TIMEOUT is the default time to wait for a report answering a request to the receiver
+const RESPONSE_TIMEOUT = 500 * time.Millisecond
+
+// SetTimeout sets the time to wait for a report answering a request to the receiver or a paired device (register
+// access, HID++ requests). For requests answered by multiple reports, it applies to each report. A timeout <= 0
+// restores RESPONSE_TIMEOUT. Requests with an explicit timeout (f.e. SendHIDPPToDevice) aren't affected.
+func (u *LocalUSBDongle) SetTimeout(timeout time.Duration) {
+	if timeout < 0 {
+		timeout = 0
+	}
+	u.responseTimeout = timeout
+}
+
+func (u *LocalUSBDongle) responseTimeoutMillis() int {
+	if u.responseTimeout <= 0 {
+		return int(RESPONSE_TIMEOUT / time.Millisecond)
+	}
+	if ms := int(u.responseTimeout / time.Millisecond); ms > 0 {
+		return ms
+	}
+	return 1
+}
+
+// SetNotificationBuffer configures the channels returned by subsequent calls of Notifications. size is the number of
+// buffered reports (NOTIFICATION_BUFFER_SIZE if <= 0). If the buffer is full, the oldest buffered report is dropped
+// in favour of the new one and counted (see DroppedNotifications), unless block is set. With block set, reading from
+// the receiver pauses till the consumer catches up, which could overflow the receiver's buffers instead.
+func (u *LocalUSBDongle) SetNotificationBuffer(size int, block bool) {
+	u.notificationMutex.Lock()
+	defer u.notificationMutex.Unlock()
+	u.notificationBufferSize = size
+	u.notificationBlock = block
+}
+
+// DroppedNotifications returns the number of reports dropped by all Notifications channels, because the consumer
+// didn't keep up
+func (u *LocalUSBDongle) DroppedNotifications() uint64 {
+	u.notificationMutex.Lock()
+	defer u.notificationMutex.Unlock()
+	return u.droppedNotifications
+}
+
+// Notifications forwards the reports received from the receiver (notifications of the receiver and paired devices)
+// to the returned channel, till ctx is done. The channel is closed afterwards. The channel is buffered, a slow
+// consumer loses the oldest reports (see SetNotificationBuffer).
+// Reports are only read while no request is in flight, so requests still receive their responses. Notifications
+// arriving while a request is in flight are consumed by the request, though.
+func (u *LocalUSBDongle) Notifications(ctx context.Context) <-chan USBReport {
+	u.notificationMutex.Lock()
+	size, block := u.notificationBufferSize, u.notificationBlock
+	u.notificationMutex.Unlock()
+	if size <= 0 {
+		size = NOTIFICATION_BUFFER_SIZE
+	}
+
+	notifications := make(chan USBReport, size)
+	go func() {
+		defer close(notifications)
+		for ctx.Err() == nil {
+			u.reqMutex.Lock()
+			r, err := u.ReceiveUSBReport(100)
+			u.reqMutex.Unlock()
+			if err == ErrDongleClosed {
+				return
+			}
+			if err != nil {
+				continue
+			}
+
+			if block {
+				select {
+				case notifications <- r:
+				case <-ctx.Done():
+				}
+				continue
+			}
+			for delivered := false; !delivered; {
+				select {
+				case notifications <- r:
+					delivered = true
+				default:
+					// buffer full, make room by dropping the oldest report (unless the consumer just took it)
+					select {
+					case <-notifications:
+						u.notificationMutex.Lock()
+						u.droppedNotifications++
+						u.notificationMutex.Unlock()
+					default:
+					}
+				}
+			}
+		}
+	}()
+	return notifications
+}
+
+// TriggerDeviceArrival asks the receiver to send a (fake) device connection notification for every paired device,
+// including devices which are currently offline. The notifications have to be collected with ReceiveUSBReport, use
+// GetPairedDevices to trigger and collect them in one go.
+func (u *LocalUSBDongle) TriggerDeviceArrival() (err error) {
+	return u.SetRegister(byte(DONGLE_HIDPP_REGISTER_CONNECTION_STATE), []byte{0x02})
+}
+
+// GetDeviceUnitID reads the unit ID (serial) of the device paired to the given index (1..6) from the extended pairing
+// information of the receiver. The device doesn't need to be connected.
+func (u *LocalUSBDongle) GetDeviceUnitID(index byte) (unitID [4]byte, err error) {
+	if index < 1 || index > 6 {
+		return unitID, errors.New(fmt.Sprintf("invalid device index %d", index))
+	}
+	if err = u.checkPairingLayout(); err != nil {
+		return
+	}
+	subReg := byte(0x30) + index - 1 //extended pairing info
+	res, err := u.GetLongRegister(byte(DONGLE_HIDPP_REGISTER_PAIRING_INFORMATION), []byte{subReg})
+	if err != nil {
+		return
+	}
+	if len(res) < 1 || res[0] != subReg {
+		return unitID, errors.New("invalid extended pairing info response")
+	}
+	info, err := ParseExtendedPairingInfo(res[1:])
+	if err != nil {
+		return
+	}
+	return info.Serial, nil
+}
+
+// GetPairedDevices enumerates the paired devices by triggering device arrival notifications and collecting them.
+// The whole exchange is serialized with other requests, so no other request consumes the notifications. The unit ID
+// of each device is read from the receiver, for devices with an established link the HID++ protocol version is
+// queried, too.
+func (u *LocalUSBDongle) GetPairedDevices() (devices []DeviceConnection, err error) {
+	numPaired, err := u.GetNumPairedDevices()
+	if err != nil {
+		return
+	}
+
+	devices, err = u.collectDeviceArrivals(numPaired)
+	for i, d := range devices {
+		if unitID, eUnitID := u.GetDeviceUnitID(d.DeviceIndex); eUnitID == nil {
+			devices[i].UnitID = unitID
+		}
+		if !d.Link {
+			continue
+		}
+		if maj, min, eProto := u.GetDeviceProtocol(d.DeviceIndex); eProto == nil {
+			devices[i].ProtocolMajor = maj
+			devices[i].ProtocolMinor = min
+		}
+	}
+	return
+}
+
+// collectDeviceArrivals triggers device arrival notifications and collects them, till numPaired devices are reported
+func (u *LocalUSBDongle) collectDeviceArrivals(numPaired byte) (devices []DeviceConnection, err error) {
+	u.reqMutex.Lock()
+	defer u.reqMutex.Unlock()
+
+	devices = make([]DeviceConnection, 0)
+	seen := make(map[byte]bool)
+	collect := func(r USBReport) {
+		if !r.IsHIDPP() {
+			return
+		}
+		if dc, eDc := ParseDeviceConnection(r.(*HidPPMsg)); eDc == nil && !seen[dc.DeviceIndex] {
+			seen[dc.DeviceIndex] = true
+			devices = append(devices, dc)
+		}
+	}
+
+	// notifications could arrive before the response to the register write, thus they are collected from the
+	// responses, too
+	responses, err := u.hidppSendAndCollectResponses(0xff, HIDPP_MSG_ID_SET_REGISTER_REQ, []byte{byte(DONGLE_HIDPP_REGISTER_CONNECTION_STATE), 0x02})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range responses {
+		collect(r)
+	}
+
+	for byte(len(devices)) < numPaired {
+		r, eR := u.ReceiveUSBReport(u.responseTimeoutMillis())
+		if eR != nil {
+			break
+		}
+		collect(r)
+	}
+
+	if byte(len(devices)) < numPaired {
+		err = errors.New(fmt.Sprintf("only %d of %d paired devices reported", len(devices), numPaired))
+	}
+	return
+}
+
 func (u *LocalUSBDongle) GetDeviceActivityCounters() (activityCounters []byte, err error) {
 	//fmt.Println("GetDeviceActivityCounters")
 	responses, err := u.HIDPP_SendAndCollectResponses(0xff, HIDPP_MSG_ID_GET_LONG_REGISTER_REQ, []byte{byte(DONGLE_HIDPP_REGISTER_DEVICE_ACTIVITY)})
@@ -385,7 +1063,7 @@ func (u *LocalUSBDongle) GetDeviceActivityCounters() (activityCounters []byte, e
 				break
 			}
 		}
-		fmt.Println(r.String())
+		u.logln(r.String())
 	}
 	if devActivityResp == nil {
 		err = errors.New("couldn't read device activity register")
@@ -396,6 +1074,38 @@ func (u *LocalUSBDongle) GetDeviceActivityCounters() (activityCounters []byte, e
 	return
 }
 
+// LinkStatus holds the link diagnostics available for a paired device
+type LinkStatus struct {
+	DeviceIndex     byte // HID++ device index (1..6)
+	Reachable       bool // device answered a ping over the RF link
+	ActivityCounter byte // reports received by the receiver from the device (wraps), see GetDeviceActivityCounters
+}
+
+func (ls LinkStatus) String() string {
+	return fmt.Sprintf("device %d reachable: %v activity counter: %d", ls.DeviceIndex, ls.Reachable, ls.ActivityCounter)
+}
+
+// GetLinkQuality collects link diagnostics for the device with the given index (1..6): if the device answers a
+// ping and the activity counter of the receiver for the device. Comparing the activity counter of successive calls
+// shows if reports of the device get through. Neither the receiver registers, nor the HID++ 2.0 features known to
+// this package expose RF channel or signal strength.
+func (u *LocalUSBDongle) GetLinkQuality(index byte) (status LinkStatus, err error) {
+	if index < 1 || index > 6 {
+		return status, errors.New(fmt.Sprintf("invalid device index %d", index))
+	}
+	status.DeviceIndex = index
+
+	counters, err := u.GetDeviceActivityCounters()
+	if err != nil {
+		return
+	}
+	status.ActivityCounter = counters[index-1]
+
+	_, _, errPing := u.GetDeviceProtocol(index)
+	status.Reachable = errPing == nil
+	return
+}
+
 func (u *LocalUSBDongle) GetReceiverFirmwareMajorMinorVersion() (maj FirmwareMajor, min byte, err error) {
 	responses, err := u.HIDPP_SendAndCollectResponses(0xff, HIDPP_MSG_ID_GET_REGISTER_REQ, []byte{byte(DONGLE_HIDPP_REGISTER_FIRMWARE_INFO), 0x01})
 
@@ -409,7 +1119,7 @@ func (u *LocalUSBDongle) GetReceiverFirmwareMajorMinorVersion() (maj FirmwareMaj
 				break
 			}
 		}
-		fmt.Println(r.String())
+		u.logln(r.String())
 	}
 	if receiverFirmwareMajMin == nil {
 		err = errors.New("could not determine receiver firmware version")
@@ -418,7 +1128,92 @@ func (u *LocalUSBDongle) GetReceiverFirmwareMajorMinorVersion() (maj FirmwareMaj
 
 	maj = FirmwareMajor(receiverFirmwareMajMin.Parameters[2])
 	min = receiverFirmwareMajMin.Parameters[3]
-	fmt.Printf("Receiver dongle firmware: %02x.%02x - %s\n", byte(maj), min, maj.String())
+	u.logf("Receiver dongle firmware: %02x.%02x - %s\n", byte(maj), min, maj.String())
+	return
+}
+
+// IsCompatibleWith checks if the firmware f could be flashed to the receiver, by comparing the MCU and the receiver
+// family of the running firmware with the ones of f. If the firmware blob has a bootloader, its USB VID has to match
+// the receiver, too. If the receiver isn't compatible, reason describes the mismatch. A firmware of unknown family
+// is accepted, if the MCU matches (reason notes this).
+func (u *LocalUSBDongle) IsCompatibleWith(f *Firmware) (compatible bool, reason string, err error) {
+	maj, _, err := u.GetReceiverFirmwareMajorMinorVersion()
+	if err != nil {
+		return false, "", err
+	}
+
+	if target := maj.TargetType(); target == FIRMWARE_TARGET_TYPE_UNKNOWN {
+		return false, fmt.Sprintf("receiver runs unknown firmware RQR%02x", byte(maj)), nil
+	} else if target != f.TargetType {
+		return false, fmt.Sprintf("firmware targets %s, receiver is %s based", f.TargetType, target), nil
+	}
+
+	if f.HasBL && u.Dev != nil && f.BootloaderVID != u.Dev.Desc.Vendor {
+		return false, fmt.Sprintf("firmware bootloader has VID %s, receiver has VID %s", f.BootloaderVID, u.Dev.Desc.Vendor), nil
+	}
+
+	family, err := f.Family()
+	if err != nil {
+		return false, "", err
+	}
+	if family == FAMILY_UNKNOWN {
+		return true, "firmware family unknown, only the MCU could be checked", nil
+	}
+	if family != maj.Family() {
+		return false, fmt.Sprintf("firmware is built for %s receivers, receiver runs %s firmware", family, maj.Family()), nil
+	}
+	return true, "", nil
+}
+
+// GetRunningFirmwareVersion reads the version of the running firmware from the firmware info register (0xf1). The
+// version in DongleInfo is the copy stored in the device data flash page (pairing information register 0xb5), both
+// could differ, f.e. after an incomplete firmware update.
+func (u *LocalUSBDongle) GetRunningFirmwareVersion() (v FirmwareVersionInfo, err error) {
+	majMin, err := u.GetRegister(byte(DONGLE_HIDPP_REGISTER_FIRMWARE_INFO), []byte{0x01, 0x00})
+	if err != nil {
+		return
+	}
+	if len(majMin) < 3 || majMin[0] != 0x01 {
+		return v, errors.New("invalid firmware version response")
+	}
+	build, err := u.GetRegister(byte(DONGLE_HIDPP_REGISTER_FIRMWARE_INFO), []byte{0x02, 0x00})
+	if err != nil {
+		return
+	}
+	if len(build) < 3 || build[0] != 0x02 {
+		return v, errors.New("invalid firmware build response")
+	}
+	v.Major = FirmwareMajor(majMin[1])
+	v.Minor = majMin[2]
+	v.Build = uint16(build[1])<<8 | uint16(build[2])
+	return
+}
+
+// GetEntityVersions reads the versions of the firmware entities from the firmware info register (0xf1) of the running
+// firmware: the receiver firmware (sub-registers 0x01, 0x02), the bootloader (0x04) and, if the receiver reports it, a
+// further entity of unknown kind (0x03). Only a missing receiver firmware version is an error.
+func (u *LocalUSBDongle) GetEntityVersions() (entities []EntityVersion, err error) {
+	entities, err = u.readEntityVersions()
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// readEntityVersions works like GetEntityVersions, but returns the other entities if the receiver firmware version is
+// missing, too. err only reports the missing receiver firmware entity.
+func (u *LocalUSBDongle) readEntityVersions() (entities []EntityVersion, err error) {
+	fw, err := u.GetRunningFirmwareVersion()
+	if err == nil {
+		entities = append(entities, EntityVersion{Type: ENTITY_TYPE_MAIN_APPLICATION, Name: "RQR", Major: byte(fw.Major), Minor: fw.Minor, Build: fw.Build, HasBuild: true})
+	}
+
+	if bl, eBl := u.GetRegister(byte(DONGLE_HIDPP_REGISTER_FIRMWARE_INFO), []byte{0x04, 0x00}); eBl == nil && len(bl) >= 3 && bl[0] == 0x04 {
+		entities = append(entities, EntityVersion{Type: ENTITY_TYPE_BOOTLOADER, Name: "BOT", Major: bl[1], Minor: bl[2]})
+	}
+	if other, eOther := u.GetRegister(byte(DONGLE_HIDPP_REGISTER_FIRMWARE_INFO), []byte{0x03, 0x00}); eOther == nil && len(other) >= 3 && other[0] == 0x03 {
+		entities = append(entities, EntityVersion{Type: ENTITY_TYPE_OTHER, Major: other[1], Minor: other[2]})
+	}
 	return
 }
 
@@ -435,7 +1230,7 @@ func (u *LocalUSBDongle) GetReceiverBLMajorMinorVersion() (maj byte, min byte, e
 				break
 			}
 		}
-		fmt.Println(r.String())
+		u.logln(r.String())
 	}
 	if receiverFirmwareMajMin == nil {
 		err = errors.New("could not determine receiver BOOTLOADER version")
@@ -444,7 +1239,7 @@ func (u *LocalUSBDongle) GetReceiverBLMajorMinorVersion() (maj byte, min byte, e
 
 	maj = receiverFirmwareMajMin.Parameters[2]
 	min = receiverFirmwareMajMin.Parameters[3]
-	fmt.Printf("Receiver BOOTLOADER: %02x.%02x\n", maj, min)
+	u.logf("Receiver BOOTLOADER: %02x.%02x\n", maj, min)
 	return
 }
 
@@ -461,7 +1256,7 @@ func (u *LocalUSBDongle) GetReceiverFirmwareBuildVersion() (build uint16, err er
 				break
 			}
 		}
-		fmt.Println(r.String())
+		u.logln(r.String())
 	}
 	if receiverFirmwareMajMin == nil {
 		err = errors.New("could not determine receiver firmware version")
@@ -470,7 +1265,7 @@ func (u *LocalUSBDongle) GetReceiverFirmwareBuildVersion() (build uint16, err er
 
 	build = uint16(receiverFirmwareMajMin.Parameters[2]) << 8
 	build += uint16(receiverFirmwareMajMin.Parameters[3])
-	fmt.Printf("Receiver dongle firmware build: %04x\n", build)
+	u.logf("Receiver dongle firmware build: %04x\n", build)
 	return
 }
 
@@ -485,11 +1280,40 @@ func (u *LocalUSBDongle) SwitchToBootloader() (build uint16, err error) {
 	return
 }
 
+// SupportsFirmwareUpdate checks if the receiver could be switched to bootloader mode for a firmware update, which is
+// the case if it implements the firmware update register (used by SwitchToBootloader). Note: The HID++ 2.0 DFU
+// features (0x00c2, 0x00d0) are only implemented by devices, HID++ 1.0 receivers expose the update entry as register,
+// thus only the register is probed.
+func (u *LocalUSBDongle) SupportsFirmwareUpdate() (supported bool, err error) {
+	return u.ProbeRegister(byte(DONGLE_HIDPP_REGISTER_FIRMWARE_UPDATE))
+}
+
+// ReceiverGeneration reports if the receiver is a Bolt receiver, which stores pairing information in a different
+// layout, or uses the Unifying layout. It is derived from the USB PID, receivers without USB device (see
+// NewDongleWithTransport) are assumed to use the Unifying layout.
+func (u *LocalUSBDongle) ReceiverGeneration() ReceiverGeneration {
+	if u.Dev != nil && u.Dev.Desc.Product == PID_BOLT {
+		return RECEIVER_GENERATION_BOLT
+	}
+	return RECEIVER_GENERATION_UNIFYING
+}
+
+// checkPairingLayout returns ErrBoltReceiver for Bolt receivers, it guards methods decoding pairing information records
+func (u *LocalUSBDongle) checkPairingLayout() error {
+	if u.ReceiverGeneration() == RECEIVER_GENERATION_BOLT {
+		return ErrBoltReceiver
+	}
+	return nil
+}
+
 func (u *LocalUSBDongle) GetDevicePairingInfo(deviceID byte) (res DeviceInfo, err error) {
 	if deviceID < 0 || deviceID > 6 {
 		err = errors.New("invalid device ID")
 		return
 	}
+	if err = u.checkPairingLayout(); err != nil {
+		return
+	}
 
 	infoType := byte(0x20) //Pairing Info
 	//fmt.Printf("GetDevicePairingInfo devIdx %d, infoType %02x\n", deviceID, infoType)
@@ -505,20 +1329,24 @@ func (u *LocalUSBDongle) GetDevicePairingInfo(deviceID byte) (res DeviceInfo, er
 				break
 			}
 		}
-		fmt.Println(r.String())
+		u.logln(r.String())
 	}
 	if devPairingInfo == nil {
 		err = errors.New("couldn't read device pairing info")
 		return
 	}
 
+	rec, err := ParsePairingRecord(devPairingInfo.Parameters[2:])
+	if err != nil {
+		return
+	}
 	res.DeviceIndex = deviceID
-	res.DestinationID = devPairingInfo.Parameters[2]
-	res.DefaultReportInterval = time.Duration(devPairingInfo.Parameters[3]) * time.Millisecond;
-	res.WPID = devPairingInfo.Parameters[4:6]
-	res.DeviceType = DeviceType(devPairingInfo.Parameters[8])
+	res.DestinationID = rec.DestinationID
+	res.DefaultReportInterval = rec.DefaultReportInterval
+	res.WPID = rec.WPID
+	res.DeviceType = rec.DeviceType
 
-	res.Caps = LogitechDeviceCapabilities(devPairingInfo.Parameters[9])
+	res.Caps = rec.Caps
 
 	infoType = byte(0x30) //extended pairing Info
 	//fmt.Printf("GetDevicePairingInfo devIdx %d, infoType %02x\n", deviceID, infoType)
@@ -534,16 +1362,19 @@ func (u *LocalUSBDongle) GetDevicePairingInfo(deviceID byte) (res DeviceInfo, er
 				break
 			}
 		}
-		fmt.Println(r.String())
+		u.logln(r.String())
 	}
 	if devExtPairingInfo == nil {
 		err = errors.New("couldn't read device extended pairing info")
 		return
 	}
-	res.Serial = devExtPairingInfo.Parameters[2:6]
-	res.ReportTypes = ReportTypes(0)
-	res.ReportTypes.FromSlice(devExtPairingInfo.Parameters[6:10])
-	res.UsabilityInfo = UsabilityInfo(devExtPairingInfo.Parameters[10])
+	extInfo, err := ParseExtendedPairingInfo(devExtPairingInfo.Parameters[2:])
+	if err != nil {
+		return
+	}
+	res.Serial = extInfo.Serial[:]
+	res.ReportTypes = extInfo.ReportTypes
+	res.UsabilityInfo = extInfo.UsabilityInfo
 
 	infoType = byte(0x40) //device name
 	//fmt.Printf("GetDevicePairingInfo devIdx %d, infoType %02x\n", deviceID, infoType)
@@ -578,6 +1409,48 @@ func (u *LocalUSBDongle) GetDevicePairingInfo(deviceID byte) (res DeviceInfo, er
 	return
 }
 
+// GetDeviceInfo collects what is known about the device with the given index (1..6). The pairing information is read
+// from the receiver (see GetDevicePairingInfo, DeviceIndex is the zero based pairing slot like there), the RF address
+// is completed with the receiver serial. If the device is reachable, its HID++ protocol version is added and, for
+// HID++ 2.0 devices, the name reported by the device, the battery state and the feature count, as far as the device
+// supports the respective features. An unreachable device is no error, HasProtocol is false in this case.
+func (u *LocalUSBDongle) GetDeviceInfo(index byte) (info DeviceInfo, err error) {
+	if index < 1 || index > 6 {
+		return info, errors.New(fmt.Sprintf("invalid device index %d", index))
+	}
+	info, err = u.GetDevicePairingInfo(index - 1)
+	if err != nil {
+		return
+	}
+	if dongleInfo, eDi := u.GetLongRegister(byte(DONGLE_HIDPP_REGISTER_PAIRING_INFORMATION), []byte{0x03}); eDi == nil && len(dongleInfo) >= 5 {
+		copy(info.RFAddr, dongleInfo[1:5])
+		info.RFAddr[4] = info.DestinationID
+	}
+
+	maj, min, eProto := u.GetDeviceProtocol(index)
+	if eProto != nil {
+		u.logf("Device %d not reachable: %v\n", index, eProto)
+		return info, nil
+	}
+	info.HasProtocol = true
+	info.ProtocolMajor = maj
+	info.ProtocolMinor = min
+	if maj < 2 {
+		return
+	}
+
+	if name, eName := u.GetDeviceNameFromDevice(index); eName == nil {
+		info.DeviceName = name
+	}
+	if battery, eBattery := u.GetBatteryStatus(index); eBattery == nil {
+		info.Battery = &battery
+	}
+	if count, eCount := u.GetFeatureCount(index); eCount == nil {
+		info.FeatureCount = count
+	}
+	return
+}
+
 /*
 func (u *LocalUSBDongle) PrintInfoForAllConnectedDevices() (err error) {
 	numPaired, err := u.GetNumPairedDevices()
@@ -588,10 +1461,10 @@ func (u *LocalUSBDongle) PrintInfoForAllConnectedDevices() (err error) {
 	for devIdx := byte(0); devIdx < numPaired; devIdx++ {
 		pi, ePi := u.GetDevicePairingInfo(devIdx)
 		if ePi == nil {
-			fmt.Println(pi.String())
+			u.logln(pi.String())
 
 		} else {
-			fmt.Printf("Error for device index %d: %v\n", devIdx, ePi)
+			u.logf("Error for device index %d: %v\n", devIdx, ePi)
 		}
 
 	}
@@ -600,6 +1473,9 @@ func (u *LocalUSBDongle) PrintInfoForAllConnectedDevices() (err error) {
 */
 
 func (u *LocalUSBDongle) GetAllConnectedDevices() (devices []DeviceInfo, err error) {
+	if err = u.checkPairingLayout(); err != nil {
+		return
+	}
 	numPaired, err := u.GetNumPairedDevices()
 	if err != nil {
 		return
@@ -613,7 +1489,7 @@ func (u *LocalUSBDongle) GetAllConnectedDevices() (devices []DeviceInfo, err err
 			devices = append(devices, pi)
 			numPaired--
 		} else {
-			fmt.Printf("Error for device index %d: %v\n", devIdx, ePi)
+			u.logf("Error for device index %d: %v\n", devIdx, ePi)
 		}
 
 	}
@@ -621,76 +1497,58 @@ func (u *LocalUSBDongle) GetAllConnectedDevices() (devices []DeviceInfo, err err
 }
 
 func (u *LocalUSBDongle) GetDongleInfo() (res DongleInfo, err error) {
-	//fmt.Printf("GetDevicePairingInfo devIdx %d, infoType %02x\n", deviceID, infoType)
-	responses, err := u.HIDPP_SendAndCollectResponses(0xff, HIDPP_MSG_ID_GET_LONG_REGISTER_REQ, []byte{byte(DONGLE_HIDPP_REGISTER_PAIRING_INFORMATION), 0x02})
-
-	var dongleInfo1 *HidPPMsg = nil
-	for _, r := range responses {
-		if r.IsHIDPP() {
-			hppmsg := r.(*HidPPMsg)
-			if hppmsg.MsgSubID == HIDPP_MSG_ID_GET_LONG_REGISTER_RSP && len(hppmsg.Parameters) == USB_REPORT_TYPE_HIDPP_LONG_PAYLOAD_LEN && hppmsg.Parameters[0] == byte(DONGLE_HIDPP_REGISTER_PAIRING_INFORMATION) && hppmsg.Parameters[1] == 0x02 {
-				//Connection state response
-				dongleInfo1 = hppmsg
-				break
-			}
-		}
-		fmt.Println(r.String())
-	}
-	if dongleInfo1 == nil {
+	res.Generation = u.ReceiverGeneration()
+	dongleInfo1, err := u.GetLongRegister(byte(DONGLE_HIDPP_REGISTER_PAIRING_INFORMATION), []byte{0x02})
+	if err != nil || len(dongleInfo1) < 8 {
 		err = errors.New("couldn't read dongle info")
 		return
 	}
 
-	res.FwMajor = dongleInfo1.Parameters[2]
-	res.FwMinor = dongleInfo1.Parameters[3]
-	res.FwBuild = uint16(dongleInfo1.Parameters[4])<<8 + uint16(dongleInfo1.Parameters[5])
-	res.WPID = dongleInfo1.Parameters[6:8]
-	res.LikelyProto = dongleInfo1.Parameters[8]
+	res.FwMajor = dongleInfo1[1]
+	res.FwMinor = dongleInfo1[2]
+	res.FwBuild = uint16(dongleInfo1[3])<<8 + uint16(dongleInfo1[4])
+	res.WPID = dongleInfo1[5:7]
+	res.LikelyProto = dongleInfo1[7]
 
-	responses, err = u.HIDPP_SendAndCollectResponses(0xff, HIDPP_MSG_ID_GET_LONG_REGISTER_REQ, []byte{byte(DONGLE_HIDPP_REGISTER_PAIRING_INFORMATION), 0x03}) //Note 0x03 flash table entry exists per device, we only grab the first one
-	var dongleInfo2 *HidPPMsg = nil
-	for _, r := range responses {
-		if r.IsHIDPP() {
-			hppmsg := r.(*HidPPMsg)
-			if hppmsg.MsgSubID == HIDPP_MSG_ID_GET_LONG_REGISTER_RSP && len(hppmsg.Parameters) == USB_REPORT_TYPE_HIDPP_LONG_PAYLOAD_LEN && hppmsg.Parameters[0] == byte(DONGLE_HIDPP_REGISTER_PAIRING_INFORMATION) && hppmsg.Parameters[1] == 0x03 {
-				//Connection state response
-				dongleInfo2 = hppmsg
-				break
-			}
+	dongleInfo2, err := u.GetLongRegister(byte(DONGLE_HIDPP_REGISTER_PAIRING_INFORMATION), []byte{0x03}) //Note 0x03 flash table entry exists per device, we only grab the first one
+	if err == nil && len(dongleInfo2) >= 7 {
+		res.Serial = dongleInfo2[1:5]
+		// number of device slots (pairing table size), Unifying receivers report 6, nano receivers 1
+		if maxDevices := dongleInfo2[6]; maxDevices > 0 && maxDevices <= 6 {
+			res.MaxDevices = maxDevices
+			res.SupportsPairing = true
 		}
-		fmt.Println(r.String())
-	}
-	if dongleInfo1 == nil {
-		err = errors.New("couldn't read dongle info")
-		return
-	}
-
-	if err == nil && dongleInfo2 != nil {
-		res.Serial = dongleInfo2.Parameters[2:6]
 	} else {
-		fmt.Println("Couldn't read dongle serial")
-	}
-
-
-	responses, err = u.HIDPP_SendAndCollectResponses(0xff, HIDPP_MSG_ID_GET_REGISTER_REQ, []byte{byte(DONGLE_HIDPP_REGISTER_FIRMWARE_INFO), 0x04, 0x00})
-	for _, r := range responses {
-		if r.IsHIDPP() {
-			hppmsg := r.(*HidPPMsg)
-			if hppmsg.MsgSubID == HIDPP_MSG_ID_GET_REGISTER_RSP && len(hppmsg.Parameters) == USB_REPORT_TYPE_HIDPP_SHORT_PAYLOAD_LEN && hppmsg.Parameters[0] == byte(DONGLE_HIDPP_REGISTER_FIRMWARE_INFO) && hppmsg.Parameters[1] == 0x04 {
-				//Connection state response
-				res.BootloaderMajor = hppmsg.Parameters[2]
-				res.BootloaderMinor = hppmsg.Parameters[3]
-				break
-			}
+		u.logln("Couldn't read dongle serial")
+	}
+
+	// running firmware and bootloader version
+	entities, eFw := u.readEntityVersions()
+	res.EntityVersions = entities
+	hasBL := false
+	for _, e := range entities {
+		switch e.Type {
+		case ENTITY_TYPE_MAIN_APPLICATION:
+			res.RunningFirmware = FirmwareVersionInfo{Major: FirmwareMajor(e.Major), Minor: e.Minor, Build: e.Build}
+			res.HasRunningFirmware = true
+		case ENTITY_TYPE_BOOTLOADER:
+			res.BootloaderMajor, res.BootloaderMinor = e.Major, e.Minor
+			hasBL = true
 		}
 	}
-	if err != nil {
-		fmt.Println("Couldn't read bootloader version info")
+	if eFw != nil {
+		u.logln("Couldn't read running firmware version")
+	}
+	if !hasBL {
+		u.logln("Couldn't read bootloader version info")
 	}
 
-	//Bootloader version
-
-	return res,nil
+	if supported, eProbe := u.SupportsFirmwareUpdate(); eProbe == nil {
+		res.SupportsFwUpdate = supported
+	} else {
+		u.logln("Couldn't probe firmware update support")
+	}
+	return res, nil
 }
 
 func (u *LocalUSBDongle) GetSetInfo() (set SetInfo, err error) {
@@ -705,11 +1563,13 @@ func (u *LocalUSBDongle) GetSetInfo() (set SetInfo, err error) {
 			for _, d := range devs {
 				set.AddDevice(d)
 			}
+		} else {
+			u.logf("Error reading connected devices: %v\n", eDevs)
 		}
 
 		set.Dongle.NumConnectedDevices = byte(len(set.ConnectedDevices))
 	} else {
-		fmt.Printf("Error reading dongle info %v\n", eDi)
+		u.logf("Error reading dongle info %v\n", eDi)
 		return set, eDi
 	}
 	return
@@ -766,9 +1626,48 @@ func (u *LocalUSBDongle) DumpFlashByte(addr uint16) (res byte, err error) {
 	return
 }
 
+// DeviceDataPagesTI returns the XDATA addresses of the two device data flash pages of TI receivers with the given
+// bootloader version. The pages directly follow the firmware image (see Firmware.DeviceDataBase), which has a size of
+// DOWNGRADE_TARGET_SIZE_TI for BOT03.01 (and older) and DOWNGRADE_SOURCE_SIZE_TI for newer bootloaders. This results
+// in 0xec00/0xf000 and 0xe400/0xe800, respectively.
+func DeviceDataPagesTI(blMajor, blMinor byte) (pages [2]uint16) {
+	imageSize := DOWNGRADE_SOURCE_SIZE_TI
+	if blMajor < 3 || (blMajor == 3 && blMinor <= 1) {
+		imageSize = DOWNGRADE_TARGET_SIZE_TI
+	}
+	page0 := FLASH_XDATA_OFFSET_TI + FLASH_IMAGE_START_TI + imageSize
+	return [2]uint16{page0, page0 + FLASH_PAGE_SIZE_TI}
+}
+
+// DumpDeviceData reads both device data flash pages (pairing info, names and key material of paired devices) of a
+// TI receiver, using the secret memory dump register. The page addresses are chosen according to the bootloader
+// version (see DeviceDataPagesTI) and returned along with the data of both pages (2 * FLASH_PAGE_SIZE_TI bytes).
+func (u *LocalUSBDongle) DumpDeviceData() (data []byte, pages [2]uint16, err error) {
+	blMaj, blMin, err := u.GetReceiverBLMajorMinorVersion()
+	if err != nil {
+		return
+	}
+	if blMaj != 3 {
+		return nil, pages, errors.New(fmt.Sprintf("device data dump only supported for TI receivers (BOT03.xx), receiver has BOT%02x.%02x", blMaj, blMin))
+	}
+
+	pages = DeviceDataPagesTI(blMaj, blMin)
+	data = make([]byte, 0, 2*int(FLASH_PAGE_SIZE_TI))
+	for _, page := range pages {
+		for off := uint16(0); off < FLASH_PAGE_SIZE_TI; off++ {
+			b, eDump := u.DumpFlashByte(page + off)
+			if eDump != nil {
+				return nil, pages, errors.New(fmt.Sprintf("reading device data at %#04x failed: %v", page+off, eDump))
+			}
+			data = append(data, b)
+		}
+	}
+	return
+}
+
 func (u *LocalUSBDongle) DumpRawKeyData(devID byte) (res []byte, err error) {
 	//find flash page with device data
-	flashPagesToConsider := []uint16{0xe400, 0xe800, 0xec00, 0xf000} //0xe400, 0xe800 for <=BOT3.01; 0xec00, 0xf000 for >=BOT3.02;
+	flashPagesToConsider := []uint16{0xe400, 0xe800, 0xec00, 0xf000} //0xe400, 0xe800 for >=BOT3.02; 0xec00, 0xf000 for <=BOT3.01 (see DeviceDataPagesTI)
 
 	activePageAddr := uint16(0)
 	for _, pageAddr := range flashPagesToConsider {
@@ -827,100 +1726,255 @@ func (u *LocalUSBDongle) OpenDeviceWithVID(vid gousb.ID) (*gousb.Device, error)
 	return devs[0], nil
 }
 
+// NewLocalUSBDongle opens the first Logitech receiver in firmware mode (not bootloader), see OpenLocalUSBDongle
 func NewLocalUSBDongle() (res *LocalUSBDongle, err error) {
-	res = &LocalUSBDongle{}
-	res.showInOut = true
+	return OpenLocalUSBDongle("", "")
+}
 
-	res.epHIDppPacketSize = 32 //default
-	res.UsbCtx = gousb.NewContext()
+// setup claims the HID++ interface of the opened receiver (res.Dev) and starts report processing. On error, the
+// receiver is closed.
+func (res *LocalUSBDongle) setup() (err error) {
+	//Get device config 1
+	res.Config, err = res.Dev.Config(1)
+	if err != nil {
+		res.Close()
+		return errors.New("Couldn't retrieve config 1 of LocalUSBDongle dongle")
+	}
 
-	if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_UNIFYING); err == nil && res.Dev != nil {
-		fmt.Println("Logitech Unifying dongle found")
-	} else if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_CU0016_SPOTLIGHT); err == nil && res.Dev != nil {
-		fmt.Println("Found CU0016 Dongle for Logitech SPOTLIGHT presentation clicker")
-	} else if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_CU0016_R500); err == nil && res.Dev != nil {
-		fmt.Println("Found CU0016 Dongle for R500 presentation clicker")
-	} else if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_CU0007_G700); err == nil && res.Dev != nil {
-		fmt.Println("Found CU0007 Dongle for G700/G700s mouse")
-		res.epHIDppPacketSize = 20 // endpoint for HID++ uses 20 bytes, instead of 32
-//	} else if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_CU0010); err == nil && res.Dev != nil {
-//		fmt.Println("Found CU0010 dongle")
-//		res.epHIDppPacketSize = 20 // endpoint for HID++ uses 20 bytes, instead of 32
-	} else if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_CU0014_R400); err == nil && res.Dev != nil {
-		fmt.Println("Found CU0010 Dongle for R400 clicker")
-		res.epHIDppPacketSize = 20 // endpoint for HID++ uses 20 bytes, instead of 32
-	} else if res.Dev, err = res.OpenDeviceWithVID(VID); err == nil && res.Dev != nil {
-		fmt.Println("Found unknown Logitech dongle in Firmware Mode (not bootloader)")
-		if (res.Dev.Desc.Product&0xff00 == 0xaa00) {
-			res.Close()
-			return nil, ErrReceiverInBootloaderMode
+	res.logln("Using dongle USB config:", res.Config.Desc.String())
+
+	res.logln("Resetting dongle in order to release it from kernel (connected devices won't be usable)")
+	//res.Dev.Reset()
+	res.Dev.SetAutoDetach(true)
+
+Outer:
+	for _, ifaceDesc := range res.Config.Desc.Interfaces {
+		for _, ifaceSettings := range ifaceDesc.AltSettings {
+			//fmt.Printf("%+v\n", ifaceSettings.Endpoints)
+			for _, epDesc := range ifaceSettings.Endpoints {
+				res.logf("EP descr: %+v\n", epDesc.String())
+				if epDesc.MaxPacketSize == res.epHIDppPacketSize && epDesc.Direction == gousb.EndpointDirectionIn {
+					// This is the HID++ EP
+					//fmt.Printf("EP %+v\n", epDesc.Number)
+					res.IfaceHIDPP, err = res.Config.Interface(ifaceSettings.Number, ifaceSettings.Alternate)
+					if err != nil {
+						res.Close()
+						return errors.New("Couldn't access HID++ USB interface")
+					} else {
+						res.logln("HID++ interface:", res.IfaceHIDPP.String())
+					}
+
+					res.EpInHidPP, err = res.IfaceHIDPP.InEndpoint(epDesc.Number)
+					if err != nil {
+						res.Close()
+						return errors.New("Couldn't access HID++ USB interface IN endpoint")
+					} else {
+						res.logln("HID++ interface IN endpoint:", res.EpInHidPP.String())
+						break Outer
+					}
+				}
+			}
 		}
-	} else {
+	}
+
+	if res.EpInHidPP == nil {
 		res.Close()
-		log.Fatal("No known dongle found")
+		return errors.New("Couldn't find EP for HID++ input reports")
+	}
 
-		return nil, eNoDongle
+	// report sizes differ between receivers, the ones from the HID report descriptor are used for output reports
+	var outputSizes map[byte]int
+	if desc, eDesc := readReportDescriptor(res.Dev, res.IfaceHIDPP.Setting.Number); eDesc != nil {
+		res.logf("Couldn't read HID report descriptor, using default report sizes: %v\n", eDesc)
+	} else if res.inputReportSizes, outputSizes, eDesc = parseReportSizes(desc); eDesc != nil {
+		res.logf("Couldn't parse HID report descriptor, using default report sizes: %v\n", eDesc)
+	} else {
+		res.outputReportSizes = outputSizes
 	}
 
-	//Get device config 1
-	res.Config, err = res.Dev.Config(1)
-	if err != nil {
-		res.Close()
-		return nil, errors.New("Couldn't retrieve config 1 of LocalUSBDongle dongle")
+	res.transport = &usbTransport{
+		ctx:         res.UsbCtx,
+		dev:         res.Dev,
+		config:      res.Config,
+		iface:       res.IfaceHIDPP,
+		epIn:        res.EpInHidPP,
+		outputSizes: res.outputReportSizes,
+	}
+	res.start()
+
+	return nil
+}
+
+// USBDongleDesc describes a receiver in firmware mode found on USB, see ListLocalUSBDongles
+type USBDongleDesc struct {
+	Path    string // USB device path 'bus:address' (f.e. '1:5', like used by lsusb), changes on re-plug
+	Bus     int
+	Address int
+	PID     gousb.ID
+	Serial  string // USB serial number string, empty if it couldn't be read
+}
+
+func (d USBDongleDesc) String() string {
+	return fmt.Sprintf("%s (bus %03d address %03d) PID %s serial '%s'", d.Path, d.Bus, d.Address, d.PID, d.Serial)
+}
+
+// usbPath formats the device path of a device as 'bus:address'
+func usbPath(desc *gousb.DeviceDesc) string {
+	return fmt.Sprintf("%d:%d", desc.Bus, desc.Address)
+}
+
+// matchesUSBPath reports if the device is located at the given 'bus:address' path (leading zeros allowed, f.e.
+// '001:005')
+func matchesUSBPath(desc *gousb.DeviceDesc, path string) bool {
+	var bus, address int
+	if n, err := fmt.Sscanf(path, "%d:%d", &bus, &address); err != nil || n != 2 {
+		return false
+	}
+	return desc.Bus == bus && desc.Address == address
+}
+
+// openLocalUSBDongles opens all Logitech receivers in firmware mode (not bootloader), the caller has to close them
+func openLocalUSBDongles(ctx *gousb.Context) (devs []*gousb.Device, err error) {
+	return ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+		return desc.Vendor == VID && desc.Product&0xff00 != 0xaa00
+	})
+}
+
+// ListLocalUSBDongles lists all Logitech receivers in firmware mode (not bootloader) found on USB
+func ListLocalUSBDongles() (dongles []USBDongleDesc, err error) {
+	ctx := gousb.NewContext()
+	defer ctx.Close()
+
+	devs, err := openLocalUSBDongles(ctx)
+	for _, dev := range devs {
+		d := USBDongleDesc{
+			Path:    usbPath(dev.Desc),
+			Bus:     dev.Desc.Bus,
+			Address: dev.Desc.Address,
+			PID:     dev.Desc.Product,
+		}
+		d.Serial, _ = dev.SerialNumber()
+		dongles = append(dongles, d)
+		dev.Close()
 	}
+	return
+}
 
-	fmt.Println("Using dongle USB config:", res.Config.Desc.String())
+// localUSBDonglePIDs lists the known receiver PIDs (firmware mode) in the order they are preferred, if more than one
+// receiver matches the criteria of OpenLocalUSBDongle. Receivers with other PIDs come last.
+var localUSBDonglePIDs = []struct {
+	pid  gousb.ID
+	desc string
+}{
+	{PID_UNIFYING, "Logitech Unifying dongle"},
+	{PID_CU0016_SPOTLIGHT, "CU0016 Dongle for Logitech SPOTLIGHT presentation clicker"},
+	{PID_CU0016_R500, "CU0016 Dongle for R500 presentation clicker"},
+	{PID_CU0007_G700, "CU0007 Dongle for G700/G700s mouse"},
+	{PID_CU0014_R400, "CU0014 Dongle for R400 clicker"},
+}
 
-	fmt.Println("Resetting dongle in order to release it from kernel (connected devices won't be usable)")
-	//res.Dev.Reset()
-	res.Dev.SetAutoDetach(true)
+func localUSBDongleRank(pid gousb.ID) int {
+	for i, p := range localUSBDonglePIDs {
+		if p.pid == pid {
+			return i
+		}
+	}
+	return len(localUSBDonglePIDs)
+}
 
-Outer:
-	for _, ifaceDesc := range res.Config.Desc.Interfaces {
-		for _, ifaceSettings := range ifaceDesc.AltSettings {
-			//fmt.Printf("%+v\n", ifaceSettings.Endpoints)
-			for _, epDesc := range ifaceSettings.Endpoints {
-				fmt.Printf("EP descr: %+v\n", epDesc.String())
-				if epDesc.MaxPacketSize == res.epHIDppPacketSize && epDesc.Direction == gousb.EndpointDirectionIn {
-					// This is the HID++ EP
-					//fmt.Printf("EP %+v\n", epDesc.Number)
-					res.IfaceHIDPP, err = res.Config.Interface(ifaceSettings.Number, ifaceSettings.Alternate)
-					if err != nil {
-						res.Close()
-						return nil, errors.New("Couldn't access HID++ USB interface")
-					} else {
-						fmt.Println("HID++ interface:", res.IfaceHIDPP.String())
-					}
+// OpenLocalUSBDongle opens the Logitech receiver (firmware mode) with the given USB serial number and/or device
+// path (see USBDongleDesc), an empty criterion matches any receiver. If multiple receivers match, known receivers
+// are preferred (see localUSBDonglePIDs). If no receiver matches, but a receiver is in bootloader mode,
+// ErrReceiverInBootloaderMode is returned.
+func OpenLocalUSBDongle(serial string, path string) (res *LocalUSBDongle, err error) {
+	res = &LocalUSBDongle{}
+	res.showInOut = true
+	res.epHIDppPacketSize = 32 //default
+	res.UsbCtx = gousb.NewContext()
 
-					res.EpInHidPP, err = res.IfaceHIDPP.InEndpoint(epDesc.Number)
-					if err != nil {
-						res.Close()
-						return nil, errors.New("Couldn't access HID++ USB interface IN endpoint")
-					} else {
-						fmt.Println("HID++ interface IN endpoint:", res.EpInHidPP.String())
-						break Outer
-					}
+	devs, err := openLocalUSBDongles(res.UsbCtx)
+	for _, dev := range devs {
+		if path == "" || matchesUSBPath(dev.Desc, path) {
+			if devSerial, _ := dev.SerialNumber(); serial == "" || devSerial == serial {
+				if res.Dev == nil || localUSBDongleRank(dev.Desc.Product) < localUSBDongleRank(res.Dev.Desc.Product) {
+					dev, res.Dev = res.Dev, dev
 				}
 			}
 		}
+		if dev != nil {
+			dev.Close()
+		}
 	}
-
-	if res.EpInHidPP == nil {
+	if res.Dev == nil {
+		inBootloader := false
+		res.UsbCtx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+			inBootloader = inBootloader || desc.Vendor == VID && desc.Product&0xff00 == 0xaa00 && (path == "" || matchesUSBPath(desc, path))
+			return false
+		})
 		res.Close()
-		return nil, errors.New("Couldn't find EP for HID++ input reports")
+		switch {
+		case inBootloader && serial == "":
+			return nil, ErrReceiverInBootloaderMode
+		case err != nil:
+			return nil, err
+		case serial == "" && path == "":
+			return nil, eNoDongle
+		}
+		return nil, errors.New(fmt.Sprintf("no receiver found with serial '%s' and path '%s'", serial, path))
 	}
 
-	res.sndQueue = make(chan USBReport)
-	res.rcvQueue = make(chan USBReport)
+	if rank := localUSBDongleRank(res.Dev.Desc.Product); rank < len(localUSBDonglePIDs) {
+		logf("Found %s at %s\n", localUSBDonglePIDs[rank].desc, usbPath(res.Dev.Desc))
+	} else {
+		logf("Found unknown Logitech dongle in Firmware Mode (not bootloader) at %s (PID %s)\n", usbPath(res.Dev.Desc), res.Dev.Desc.Product)
+	}
+	switch res.Dev.Desc.Product {
+	case PID_CU0007_G700, PID_CU0014_R400:
+		res.epHIDppPacketSize = 20 // endpoint for HID++ uses 20 bytes, instead of 32
+	}
 
-	res.ctx, res.cancel = context.WithCancel(context.Background())
+	if err = res.setup(); err != nil {
+		return nil, err
+	}
+	return
+}
 
-	go res.rcvLoop()
-	go res.sndLoop()
+// NewDongleWithTransport creates a LocalUSBDongle which exchanges its reports using the given Transport, instead of
+// a receiver found on USB (f.e. to test protocol logic without hardware)
+func NewDongleWithTransport(t Transport) (res *LocalUSBDongle, err error) {
+	if t == nil {
+		return nil, errors.New("no transport given")
+	}
+	res = &LocalUSBDongle{}
+	res.showInOut = false
+	res.epHIDppPacketSize = 32
+	res.transport = t
+	res.start()
 
 	return
 }
 
+func (u *LocalUSBDongle) start() {
+	u.sndQueue = make(chan USBReport)
+	u.rcvQueue = make(chan USBReport)
+
+	u.ctx, u.cancel = context.WithCancel(context.Background())
+
+	go u.rcvLoop()
+	go u.sndLoop()
+}
+
+// BootloaderPIDFamily maps USB PIDs of receivers in bootloader mode to the firmware family they run
+var BootloaderPIDFamily = map[gousb.ID]FirmwareMajor{
+	PID_BOOT_LOADER_NORDIC:          FIRMWARE_MAJOR_UNIFYING_NORDIC,
+	PID_BOOT_LOADER_NORDIC2:         FIRMWARE_MAJOR_UNIFYING_NORDIC,
+	PID_BOOT_LOADER_TI:              FIRMWARE_MAJOR_UNIFYING_TI,
+	PID_BOOT_LOADER_TI_NANO:         FIRMWARE_MAJOR_UNIFYING_TI,
+	PID_BOOT_LOADER_LIGHTSPEED_G603: FIRMWARE_MAJOR_LIGHTSPEED_TI,
+	PID_BOOT_LOADER_TI_SPOTLIGHT:    FIRMWARE_MAJOR_SPOTLIGHT_CLICKER_TI,
+	PID_BOOT_LOADER_TI_R500:         FIRMWARE_MAJOR_R500_CLICKER_TI,
+}
+
 type USBBootloaderDongle struct {
 	UsbCtx   *gousb.Context
 	Dev      *gousb.Device
@@ -934,15 +1988,45 @@ type USBBootloaderDongle struct {
 	ctx      context.Context
 
 	showInOut bool
-	wasClosed bool
+	logger    Logger // package Logger (see SetLogger) if nil
+
+	closeMutex sync.Mutex // guards closed
+	closed     bool
+
+	forceDowngrade bool
+}
+
+// Family returns the firmware family of the receiver, derived from its bootloader PID
+func (u *USBBootloaderDongle) Family() (family FirmwareMajor, known bool) {
+	if u.Dev == nil || u.Dev.Desc == nil {
+		return 0, false
+	}
+	family, known = BootloaderPIDFamily[u.Dev.Desc.Product]
+	return
+}
+
+// SetForceDowngrade allows downgrading firmware for receiver families, for which the downgrade patch set isn't
+// validated (see DowngradeValidated)
+func (u *USBBootloaderDongle) SetForceDowngrade(force bool) {
+	u.forceDowngrade = force
 }
 
 func (u *USBBootloaderDongle) SendUSBReport(msg BootloaderReport) (err error) {
-	u.sndQueue <- msg
-	return nil
+	if u.isClosed() {
+		return ErrDongleClosed
+	}
+	select {
+	case u.sndQueue <- msg:
+		return nil
+	case <-u.ctx.Done():
+		return ErrDongleClosed
+	}
 }
 
 func (u *USBBootloaderDongle) ReceiveUSBReport(timeoutMillis int) (msg BootloaderReport, err error) {
+	if u.isClosed() {
+		return msg, ErrDongleClosed
+	}
 	ctx := context.Background()
 	if timeoutMillis > 0 {
 		ctxNew, cancel := context.WithTimeout(ctx, time.Duration(timeoutMillis)*time.Millisecond)
@@ -951,22 +2035,36 @@ func (u *USBBootloaderDongle) ReceiveUSBReport(timeoutMillis int) (msg Bootloade
 	}
 
 	select {
-	case rcv := <-u.rcvQueue:
+	case rcv, ok := <-u.rcvQueue:
+		if !ok {
+			return msg, ErrDongleClosed
+		}
 		msg = rcv
 	case <-ctx.Done():
-		err = errors.New("timeout reached")
+		err = ErrReceiveTimeout
 	}
 
 	return
 }
 
+// isClosed reports if Close has been called
+func (u *USBBootloaderDongle) isClosed() bool {
+	u.closeMutex.Lock()
+	defer u.closeMutex.Unlock()
+	return u.closed
+}
+
+// Close releases the receiver. Calling Close more than once is safe, methods communicating with the receiver return
+// ErrDongleClosed afterwards.
 func (u *USBBootloaderDongle) Close() {
-	if u.wasClosed {
+	u.closeMutex.Lock()
+	defer u.closeMutex.Unlock()
+	if u.closed {
 		return
 	}
-	u.wasClosed = true
+	u.closed = true
 
-	fmt.Println("Closing Logitech Receiver in bootloader mode...")
+	u.logln("Closing Logitech Receiver in bootloader mode...")
 	if u.cancel != nil {
 		u.cancel()
 	}
@@ -990,60 +2088,82 @@ func (u *USBBootloaderDongle) Close() {
 	}
 }
 
-func (u *USBBootloaderDongle) rcvLoop() {
+// rcvLoop and sndLoop get the state of the opened receiver passed in, so that loops of a receiver closed by Reopen
+// don't interfere with the loops of the re-opened one
+func (u *USBBootloaderDongle) rcvLoop(ctx context.Context, ep *gousb.InEndpoint, rcvQueue chan BootloaderReport) {
 	buf := make([]byte, 32)
 
 	for {
-		n, err := u.EpInHid.ReadContext(u.ctx, buf)
+		n, err := ep.ReadContext(ctx, buf)
 		if err != nil {
 			break
 		}
 
 		if u.showInOut {
-			fmt.Printf("\nIn : % x\n", buf[:n])
+			u.logf("\nIn : % x\n", buf[:n])
 		}
 
 		inMsg := BootloaderReport{}
 		inMsg.FromWire(buf[:n])
-		u.rcvQueue <- inMsg
+		rcvQueue <- inMsg
 	}
 
-	close(u.rcvQueue)
+	close(rcvQueue)
 }
 
-func (u *USBBootloaderDongle) sndLoop() {
+func (u *USBBootloaderDongle) sndLoop(ctx context.Context, dev *gousb.Device, iface *gousb.Interface, sndQueue chan BootloaderReport) {
 Outer:
 	for {
 		select {
-		case <-u.ctx.Done():
+		case <-ctx.Done():
 			break Outer
-		case outMsg := <-u.sndQueue:
+		case outMsg := <-sndQueue:
 			outdata, err := outMsg.ToWire()
 			if err != nil {
-				fmt.Println("Error processing outbound HID++ message", err)
+				u.logln("Error processing outbound HID++ message", err)
 			}
 
 			if u.showInOut {
-				fmt.Printf("Out: % 02x\n", outdata)
+				u.logf("Out: % 02x\n", outdata)
 			}
-			u.Dev.Control(
-				0x21,                              //bit7: Host to device, bit6..5: Class: 0x1, bit4..0: Interface: 0x01
-				0x09,                              //request: 0x09 SET_REPORT
-				0x0200|uint16(outdata[0]),         //Output: 0x02, Report ID: 0x10
-				uint16(u.IfaceHID.Setting.Number), //interface index 0x00
-				outdata,                           //payload
+			dev.Control(
+				0x21,                         //bit7: Host to device, bit6..5: Class: 0x1, bit4..0: Interface: 0x01
+				0x09,                         //request: 0x09 SET_REPORT
+				0x0200|uint16(outdata[0]),    //Output: 0x02, Report ID: 0x10
+				uint16(iface.Setting.Number), //interface index 0x00
+				outdata,                      //payload
 			)
 		}
 	}
-
-	close(u.sndQueue)
 }
 
+// SetShowInOut enables tracing of the reports exchanged with the receiver. Enabling it installs StdoutLogger for the
+// dongle, unless a Logger has been set with SetLogger.
 func (u *USBBootloaderDongle) SetShowInOut(show bool) {
 	u.showInOut = show
+	if show && u.logger == nil {
+		u.logger = StdoutLogger
+	}
 	return
 }
 
+// SetLogger sets the Logger for the output of this dongle, a nil Logger uses the Logger of the package again
+func (u *USBBootloaderDongle) SetLogger(l Logger) {
+	u.logger = l
+}
+
+func (u *USBBootloaderDongle) logf(format string, v ...interface{}) {
+	if u.logger == nil {
+		logf(format, v...)
+		return
+	}
+	u.logger.Printf(format, v...)
+}
+
+func (u *USBBootloaderDongle) logln(v ...interface{}) {
+	u.logf("%s", fmt.Sprintln(v...))
+}
+
 func (u *USBBootloaderDongle) GetFirmwareMemoryInfo() (fwStartAddr, fwEndAddr, fwFlashWriteBufferSize uint16, err error) {
 	/*
 	GET_MEM_INFO = cmd 0x80
@@ -1072,9 +2192,9 @@ func (u *USBBootloaderDongle) GetFirmwareMemoryInfo() (fwStartAddr, fwEndAddr, f
 		fwEndAddr = uint16(rsp.Data[2])<<8 + uint16(rsp.Data[3])
 		fwFlashWriteBufferSize = uint16(rsp.Data[4])<<8 + uint16(rsp.Data[5])
 		//fmt.Printf("GET_MEM_INFO result % 02x\n", rsp.Data[:rsp.Len])
-		fmt.Printf("\tFirmware start addr              : %#04x\n", fwStartAddr)
-		fmt.Printf("\tFirmware last addr                : %#04x\n", fwEndAddr)
-		fmt.Printf("\t(likely) Flash write buffer size : %#x\n", fwFlashWriteBufferSize)
+		u.logf("\tFirmware start addr              : %#04x\n", fwStartAddr)
+		u.logf("\tFirmware last addr                : %#04x\n", fwEndAddr)
+		u.logf("\t(likely) Flash write buffer size : %#x\n", fwFlashWriteBufferSize)
 		return
 	} else {
 		err = errors.New("can not fetch 'firmware memory info' from receiver")
@@ -1084,7 +2204,7 @@ func (u *USBBootloaderDongle) GetFirmwareMemoryInfo() (fwStartAddr, fwEndAddr, f
 }
 
 func (u *USBBootloaderDongle) Reboot() (err error) {
-	fmt.Println("Try to reboot receiver into runtime mode...")
+	u.logln("Try to reboot receiver into runtime mode...")
 	reqClearFlash := BootloaderReport{Cmd: BOOTLOADER_COMMAND_REBOOT, Addr: 0x0000, Len: 0}
 	u.SendUSBReport(reqClearFlash)
 	time.Sleep(20 * time.Millisecond)
@@ -1100,7 +2220,7 @@ func (u *USBBootloaderDongle) EraseFlashTI() (err error) {
 	if err == nil {
 		switch rspClearFlash.Cmd {
 		case BOOTLOADER_COMMAND_TI_FLASH:
-			fmt.Printf("Flash erase flash succeeded - %s\n", rspClearFlash.String())
+			u.logf("Flash erase flash succeeded - %s\n", rspClearFlash.String())
 			return
 		default:
 			return errors.New(fmt.Sprintf("error erasing dongle flash, unknown response command %02x", byte(rspClearFlash.Cmd)))
@@ -1118,7 +2238,7 @@ func (u *USBBootloaderDongle) ClearRAMBufferTI() (err error) {
 	if err == nil {
 		switch rsp.Cmd {
 		case BOOTLOADER_COMMAND_TI_FLASH:
-			fmt.Printf("Clearing RAM BUFFER succeeded - %s\n", rsp.String())
+			u.logf("Clearing RAM BUFFER succeeded - %s\n", rsp.String())
 			return
 		default:
 			return errors.New(fmt.Sprintf("Error clearing RAM buffer, unknown response command %02x", byte(rsp.Cmd)))
@@ -1152,7 +2272,7 @@ func (u *USBBootloaderDongle) WriteFirmwareSliceToRAMBufferTI(ramBufAddr uint16,
 			return errors.New(fmt.Sprintf("error writing RAM buffer: unknown response command %02x", byte(rspWriteToRamBuffer.Cmd)))
 		}
 	} else {
-		return errors.New("error writing RAM buffer")
+		return &USBTransportError{Op: "error writing RAM buffer", Err: err}
 	}
 }
 
@@ -1172,13 +2292,13 @@ func (u *USBBootloaderDongle) WriteFirmwareSliceToFlashNordic(ramBufAddr uint16,
 	if err == nil {
 		switch rspWrite.Cmd {
 		case BOOTLOADER_COMMAND_NORDIC_WRITE:
-			fmt.Printf("Flash write succeeded - %s\n", rspWrite.String())
+			u.logf("Flash write succeeded - %s\n", rspWrite.String())
 			return
 		default:
 			return errors.New(fmt.Sprintf("error writing to flash: unknown response command %02x", byte(rspWrite.Cmd)))
 		}
 	} else {
-		return errors.New("error writing to flash")
+		return &USBTransportError{Op: "error writing to flash", Err: err}
 	}
 }
 
@@ -1197,7 +2317,7 @@ func (u *USBBootloaderDongle) ReadFirmwareSliceFromFlashNordic(ramBufAddr uint16
 	if err == nil {
 		switch rspRead.Cmd {
 		case BOOTLOADER_COMMAND_NORDIC_READ:
-			fmt.Printf("Flash read succeeded - %s\n", rspRead.String())
+			u.logf("Flash read succeeded - %s\n", rspRead.String())
 			firmwareSlice = make([]byte, rspRead.Len)
 			copy(firmwareSlice, rspRead.Data[:])
 			return
@@ -1225,7 +2345,7 @@ func (u *USBBootloaderDongle) WriteSignatureSliceTI(signatureAddr uint16, signat
 	if err == nil {
 		switch rspWriteSignatureChunk.Cmd {
 		case BOOTLOADER_COMMAND_TI_FLASH_WRITE_SIGNATURE:
-			fmt.Printf("Write signature at %04x succeeded - %s\n", signatureAddr, rspWriteSignatureChunk.String())
+			u.logf("Write signature at %04x succeeded - %s\n", signatureAddr, rspWriteSignatureChunk.String())
 			return
 		default:
 			return errors.New(fmt.Sprintf("Error writing signature at %04x, error code %02x", signatureAddr, byte(rspWriteSignatureChunk.Cmd)))
@@ -1251,7 +2371,7 @@ func (u *USBBootloaderDongle) WriteSignatureSliceNordic(signatureAddr uint16, si
 	if err == nil {
 		switch rspWriteSignatureChunk.Cmd {
 		case BOOTLOADER_COMMAND_TI_WRITE_TO_RAM_BUFFER:
-			fmt.Printf("Write signature at %04x succeeded - %s\n", signatureAddr, rspWriteSignatureChunk.String())
+			u.logf("Write signature at %04x succeeded - %s\n", signatureAddr, rspWriteSignatureChunk.String())
 			return
 		default:
 			return errors.New(fmt.Sprintf("Error writing signature at %04x, error code %02x", signatureAddr, byte(rspWriteSignatureChunk.Cmd)))
@@ -1270,7 +2390,7 @@ func (u *USBBootloaderDongle) ReadSignatureSliceTI(signatureAddr uint16, len byt
 	if err == nil {
 		switch rsp.Cmd {
 		case BOOTLOADER_COMMAND_FLASH_READ_SIGNATURE:
-			fmt.Printf("read signature at %04x succeeded - %s\n", signatureAddr, rsp.String())
+			u.logf("read signature at %04x succeeded - %s\n", signatureAddr, rsp.String())
 			return
 		default:
 			return errors.New(fmt.Sprintf("error reading signature at %04x, error code %02x", signatureAddr, byte(rsp.Cmd)))
@@ -1293,8 +2413,8 @@ func (u *USBBootloaderDongle) GenericCommandTI(cmd BootloaderCommand, addr uint1
 	if err == nil {
 		switch {
 		case rsp.Cmd != 0x01:
-			fmt.Printf("request: %s\n", req.String())
-			fmt.Printf("command %02x succeeded - %s\n", byte(cmd), rsp.String())
+			u.logf("request: %s\n", req.String())
+			u.logf("command %02x succeeded - %s\n", byte(cmd), rsp.String())
 			return
 		default:
 			return errors.New(fmt.Sprintf("error command failed error code %02x", byte(rsp.Cmd)))
@@ -1311,7 +2431,7 @@ func (u *USBBootloaderDongle) EraseFlashNordic(FlashAddr uint16) (err error) {
 	if err == nil {
 		switch rspErasePage.Cmd {
 		case BOOTLOADER_COMMAND_NORDIC_ERASE_PAGE:
-			fmt.Printf("Erase flash page %#04x succeeded - %s\n", FlashAddr, rspErasePage.String())
+			u.logf("Erase flash page %#04x succeeded - %s\n", FlashAddr, rspErasePage.String())
 			return
 		default:
 			return errors.New(fmt.Sprintf("Error erase page at addr %04x, unknown response command %02x", FlashAddr, byte(rspErasePage.Cmd)))
@@ -1329,13 +2449,13 @@ func (u *USBBootloaderDongle) StoreRAMBufferToFlashAddrTI(FlashAddr uint16) (err
 	if err == nil {
 		switch rspStoreRamBufferToFlash.Cmd {
 		case BOOTLOADER_COMMAND_TI_FLASH:
-			fmt.Printf("Store RAM buffer to flash at %04x succeeded - %s\n", FlashAddr, rspStoreRamBufferToFlash.String())
+			u.logf("Store RAM buffer to flash at %04x succeeded - %s\n", FlashAddr, rspStoreRamBufferToFlash.String())
 			return
 		default:
 			return errors.New(fmt.Sprintf("Error storing RAM buffer to flash at addr %04x, unknown response command %02x", FlashAddr, byte(rspStoreRamBufferToFlash.Cmd)))
 		}
 	} else {
-		return errors.New(fmt.Sprintf("Error storing RAM buffer to flash at addr %04x", FlashAddr))
+		return &USBTransportError{Op: fmt.Sprintf("Error storing RAM buffer to flash at addr %04x", FlashAddr), Err: err}
 	}
 }
 
@@ -1347,7 +2467,7 @@ func (u *USBBootloaderDongle) CheckFirmwareCrcAndSignatureTI() (err error) {
 	if err == nil {
 		switch rspCheckFlashCRC.Cmd {
 		case BOOTLOADER_COMMAND_TI_FLASH:
-			fmt.Printf("Flash CRC check succeeded - %s\n", rspCheckFlashCRC.String())
+			u.logf("Flash CRC check succeeded - %s\n", rspCheckFlashCRC.String())
 			return
 		default:
 			return errors.New(fmt.Sprintf("flash CRC check failed %02x\n", byte(rspCheckFlashCRC.Cmd)))
@@ -1366,7 +2486,7 @@ func (u *USBBootloaderDongle) GetBLVersionString() (versionString string, maj, m
 
 	if rsp.Cmd == BOOTLOADER_COMMAND_GET_BOOTLOADER_VERSION_STRING {
 		versionString = string(rsp.Data[:rsp.Len])
-		fmt.Printf("Bootloader version string: %s\n", versionString)
+		u.logf("Bootloader version string: %s\n", versionString)
 		//parse to ints
 
 		_, err = fmt.Sscanf(versionString, "BOT%02x.%02x_B%04x", &maj, &min, &build)
@@ -1375,7 +2495,7 @@ func (u *USBBootloaderDongle) GetBLVersionString() (versionString string, maj, m
 			return
 		}
 
-		fmt.Printf("Bootloader version parsed: Major %02x Minor %02x Build %04x\n", maj, min, build)
+		u.logf("Bootloader version parsed: Major %02x Minor %02x Build %04x\n", maj, min, build)
 		return
 	} else {
 		err = errors.New("can not fetch 'version string' from receiver")
@@ -1384,104 +2504,197 @@ func (u *USBBootloaderDongle) GetBLVersionString() (versionString string, maj, m
 
 }
 
+// BootloaderInfo describes a receiver running in bootloader mode
+type BootloaderInfo struct {
+	VersionString string // f.e. 'BOT03.01_B0008'
+	Major         uint16
+	Minor         uint16
+	Build         uint16
+	VID           gousb.ID
+	PID           gousb.ID
+	FirmwareStart uint16 // first address of the firmware region accepted by the bootloader
+	FirmwareEnd   uint16 // last address of the firmware region accepted by the bootloader
+}
+
+func (bi BootloaderInfo) String() string {
+	res := fmt.Sprintf("Bootloader Info\n")
+	res += fmt.Sprintf("-------------------------------------\n")
+	res += fmt.Sprintf("\tVersion:                     %s\n", bi.VersionString)
+	res += fmt.Sprintf("\tVID/PID:                     %s:%s\n", bi.VID, bi.PID)
+	if family, known := BootloaderPIDFamily[bi.PID]; known {
+		res += fmt.Sprintf("\tFirmware family:             %s\n", family.String())
+	}
+	res += fmt.Sprintf("\tFirmware region:             %#04x-%#04x\n", bi.FirmwareStart, bi.FirmwareEnd)
+	return res
+}
+
+// GetBootloaderInfo reads version and firmware memory layout from the bootloader, the USB IDs are taken from the
+// device descriptor
+func (u *USBBootloaderDongle) GetBootloaderInfo() (info BootloaderInfo, err error) {
+	if u.Dev != nil && u.Dev.Desc != nil {
+		info.VID = u.Dev.Desc.Vendor
+		info.PID = u.Dev.Desc.Product
+	}
+	info.VersionString, info.Major, info.Minor, info.Build, err = u.GetBLVersionString()
+	if err != nil {
+		return
+	}
+	info.FirmwareStart, info.FirmwareEnd, _, err = u.GetFirmwareMemoryInfo()
+	return
+}
+
 func (u *USBBootloaderDongle) FlashReceiver(firmware *Firmware) (err error) {
+	return u.FlashFirmwareContext(context.Background(), firmware, nil)
+}
+
+// FlashFirmwareContext flashes the given firmware like FlashReceiver, but could be cancelled with ctx. progress (could
+// be nil) is called after each written chunk with the number of bytes written so far and the total length.
+//
+// Cancellation is checked between chunks. If ctx is cancelled after the flash has been erased, the firmware region
+// is left incomplete and the receiver stays in bootloader mode (it doesn't boot an image failing the CRC check). This
+// state is recoverable, by flashing a valid firmware again. The final CRC/signature check isn't interrupted.
+func (u *USBBootloaderDongle) FlashFirmwareContext(ctx context.Context, firmware *Firmware, progress func(written int, total int)) (err error) {
+	_, err = u.FlashFirmwareResume(ctx, firmware, 0, progress)
+	return
+}
+
+// FlashFirmwareResume works like FlashFirmwareContext, but starts writing at offset resume of the base image. For
+// resume > 0, the flash isn't erased and the bytes in front of resume are assumed to be written by an earlier,
+// interrupted call. written is the offset up to which the image has been written successfully, if err is a
+// recoverable USB error (IsRecoverableUSBError), flashing could be continued from there after Reopen.
+// Progress reports include the resumed part of the image.
+func (u *USBBootloaderDongle) FlashFirmwareResume(ctx context.Context, firmware *Firmware, resume int, progress func(written int, total int)) (written int, err error) {
+	if firmware.ParseReport.CRCMismatch && !firmware.CRCValid {
+		return 0, errors.New("firmware has an invalid CRC (parsed with SkipCRC), fix it with UpdateCRC before flashing")
+	}
 
 	_, BLmaj, _, _, err := u.GetBLVersionString()
 	if err != nil {
-		log.Fatal(err)
+		return resume, err
 	}
 	if BLmaj == 0x03 {
-		fmt.Println("bootloader major version hints that this is a Texas Instruments CC2544 based Logitech dongle")
-		fmt.Println("Trying to write firmware for CC2544..")
-		return u.FlashTIReceiverTI(firmware)
+		u.logln("bootloader major version hints that this is a Texas Instruments CC2544 based Logitech dongle")
+		u.logln("Trying to write firmware for CC2544..")
+		return u.flashTI(ctx, firmware, resume, progress)
 	} else if BLmaj == 0x01 {
-		fmt.Println("bootloader major version hints that this is a Nordic nRF24LU1+ based Logitech dongle")
-		fmt.Println("Trying to write firmware for nRF24LU1+..")
-		return u.FlashReceiverNordic(firmware)
+		u.logln("bootloader major version hints that this is a Nordic nRF24LU1+ based Logitech dongle")
+		u.logln("Trying to write firmware for nRF24LU1+..")
+		return u.flashNordic(ctx, firmware, resume, progress)
 	} else {
-		return errors.New(fmt.Sprintf("bootloader major version %02x hints that receiver is neither a TI CC2544 nor Nordic nRF24LU1+, aborting..."))
+		return resume, errors.New(fmt.Sprintf("bootloader major version %02x hints that receiver is neither a TI CC2544 nor Nordic nRF24LU1+, aborting...", BLmaj))
 	}
 
 }
 
 func (u *USBBootloaderDongle) FlashTIReceiverTI(firmware *Firmware) (err error) {
+	_, err = u.flashTI(context.Background(), firmware, 0, nil)
+	return
+}
+
+func (u *USBBootloaderDongle) flashTI(ctx context.Context, firmware *Firmware, resume int, progress func(written int, total int)) (written int, err error) {
+	written = resume
 	if firmware == nil || firmware.TargetType != FIRMWARE_TARGET_TYPE_TI {
-		return errors.New("Provided firmware is not build for CC2544 based receivers")
+		return written, errors.New("Provided firmware is not build for CC2544 based receivers")
 	}
-	fmt.Println("Trying to flash provided Texas Instruments firmware")
+	u.logln("Trying to flash provided Texas Instruments firmware")
 	signature_required := false
 
 	_, BLmaj, BLmin, _, err := u.GetBLVersionString()
 	if err != nil {
-		log.Fatal(err)
+		return written, err
 	}
 	if BLmaj != 0x03 {
-		return errors.New("bootloader major version hints that this is not a Texas Instruments CC2544 based Logitech dongle")
+		return written, errors.New("bootloader major version hints that this is not a Texas Instruments CC2544 based Logitech dongle")
 	}
 
 	if BLmaj >= 3 && BLmin >= 2 {
-		fmt.Println("CAUTION: According to bootloader version, only signed firmwares are accepted!")
+		u.logln("CAUTION: According to bootloader version, only signed firmwares are accepted!")
 		signature_required = true
-		fmt.Println("Firmware has to be signed for the bootloader used by this receiver")
+		u.logln("Firmware has to be signed for the bootloader used by this receiver")
 
 		if !firmware.HasSignature {
-			return errors.New("provided firmware has no signature, but the bootloader requires one.")
+			return written, errors.New("provided firmware has no signature, but the bootloader requires one.")
 		}
 	} else {
-		fmt.Println("Firmware does not have to be signed for the bootloader used by this receiver")
+		u.logln("Firmware does not have to be signed for the bootloader used by this receiver")
 	}
 
-	fmt.Println("Retrieving firmware memory info from bootloader...")
+	u.logln("Retrieving firmware memory info from bootloader...")
 	fwStartAddr, fwEndAddr, fwFlashWriteBufSize, err := u.GetFirmwareMemoryInfo()
 	if err != nil {
-		return err
+		return written, err
+	}
+	// the device data pages directly follow the firmware, so the image has to start and end on a flash page
+	// boundary and the bootloader's write chunks must not cross one
+	if fwFlashWriteBufSize == 0 || FLASH_PAGE_SIZE_TI%fwFlashWriteBufSize != 0 ||
+		fwStartAddr%FLASH_PAGE_SIZE_TI != 0 || (uint32(fwEndAddr)+1)%uint32(FLASH_PAGE_SIZE_TI) != 0 {
+		return written, errors.New(fmt.Sprintf("bootloader memory layout (%#04x-%#04x, write buffer %#x) doesn't match flash pages of %#x bytes, aborting...", fwStartAddr, fwEndAddr, fwFlashWriteBufSize, FLASH_PAGE_SIZE_TI))
 	}
 
 	fwbytes, err := firmware.BaseImage()
 	if err != nil {
-		return errors.New(fmt.Sprintf("error fetching firmware base image: %v", err))
+		return written, errors.New(fmt.Sprintf("error fetching firmware base image: %v", err))
 
 	}
 
 	intended_fw_size := fwEndAddr - fwStartAddr + 1
 	if intended_fw_size != firmware.Size {
-		if firmware.Size == 0x6000 && intended_fw_size == 0x6800 && BLmaj <= 3 && BLmin <= 1 {
-			fmt.Println("According to the size, the provided firmware seems to be build for a Bootloader version >= 03.02 (signed)")
-			fmt.Println("Target receiver's Bootloader version is <=03.01 (unsigned), try to create a downgraded firmware...")
+		if firmware.Size == DOWNGRADE_SOURCE_SIZE_TI && intended_fw_size == DOWNGRADE_TARGET_SIZE_TI && BLmaj <= 3 && BLmin <= 1 {
+			u.logln("According to the size, the provided firmware seems to be build for a Bootloader version >= 03.02 (signed)")
+			u.logln("Target receiver's Bootloader version is <=03.01 (unsigned), try to create a downgraded firmware...")
 
-			fmt.Println("provided firmware file has wrong size, trying to resize")
+			u.logln("provided firmware file has wrong size, trying to resize")
 
 			if (signature_required) {
-				return errors.New("can not resize the firmware without invalidating the signature, aborting...")
+				return written, errors.New("can not resize the firmware without invalidating the signature, aborting...")
+			}
+
+			family, knownFamily := u.Family()
+			if !knownFamily || !DowngradeValidated(family) {
+				if !u.forceDowngrade {
+					return written, fmt.Errorf("%w: %s", ErrDowngradeUnvalidated, family)
+				}
+				u.logf("WARNING: downgrade patch set isn't validated for %s, continuing as forced\n", family.String())
 			}
 
 			//grow firmware to needed size
 			fwbytes, err = firmware.BaseImageDowngradeFromBL0302ToBL0301()
 			if err != nil {
-				return errors.New(fmt.Sprintf("failed to resize firmware: %v\n", err))
+				return written, errors.New(fmt.Sprintf("failed to resize firmware: %v\n", err))
 			}
 		} else {
-			return errors.New("Firmware doesn't match target bootloader's memory layout and can not be patched")
+			return written, errors.New("Firmware doesn't match target bootloader's memory layout and can not be patched")
 		}
 
 	}
 
-	//erase flash
-	//ToDo: let user decide to continue
-	fmt.Println("Erasing dongle flash: CAUTION the dongle will not be usable, if successive operations fail")
-	err = u.EraseFlashTI()
-	if err != nil {
-		return err
+	if resume < 0 || resume > len(fwbytes) || resume%int(fwFlashWriteBufSize) != 0 {
+		return written, errors.New(fmt.Sprintf("can't resume flashing at offset %#x, has to be a multiple of the flash write buffer size %#x", resume, fwFlashWriteBufSize))
 	}
 
-	//clear RAM buffer
-	fmt.Println("Clearing RAM buffer for flash write...")
-	err = u.EraseFlashTI()
-	if err != nil {
-		return err
+	if resume == 0 {
+		//erase flash
+		//ToDo: let user decide to continue
+		u.logln("Erasing dongle flash: CAUTION the dongle will not be usable, if successive operations fail")
+		err = u.EraseFlashTI()
+		if err != nil {
+			return written, err
+		}
+
+		//clear RAM buffer
+		u.logln("Clearing RAM buffer for flash write...")
+		err = u.EraseFlashTI()
+		if err != nil {
+			return written, err
+		}
+	} else {
+		u.logf("Resuming flash write at %#04x\n", int(fwStartAddr)+resume)
 	}
 
-	for addr := fwStartAddr; addr <= fwEndAddr; addr += fwFlashWriteBufSize {
+	for addr := fwStartAddr + uint16(resume); addr <= fwEndAddr; addr += fwFlashWriteBufSize {
+		if ctx.Err() != nil {
+			return written, errors.New(fmt.Sprintf("flashing aborted at %#04x, receiver remains in bootloader mode: %v", addr, ctx.Err()))
+		}
 		chunk := fwbytes[addr-fwStartAddr : addr-fwStartAddr+fwFlashWriteBufSize]
 		//fmt.Printf("%04x: %x\n", addr, chunk)
 
@@ -1493,99 +2706,123 @@ func (u *USBBootloaderDongle) FlashTIReceiverTI(firmware *Firmware) (err error)
 			// Write to RAM buffer
 			err = u.WriteFirmwareSliceToRAMBufferTI(ramAddr, ram_chunk)
 			if err != nil {
-				return err
+				return written, err
 			}
 		}
 
 		// write RAM buffer to flash at proper address
 		err = u.StoreRAMBufferToFlashAddrTI(addr)
 		if err != nil {
-			return err
+			return written, err
+		}
+		written = int(addr-fwStartAddr) + len(chunk)
+		if progress != nil {
+			progress(written, len(fwbytes))
 		}
 	}
 
 	// Write signature
 	if signature_required {
-		fmt.Println("Trying to write signature for firmware")
+		u.logln("Trying to write signature for firmware")
 		for sig_addr := uint16(0x0000); sig_addr <= uint16(0x00ff); sig_addr += 0x10 {
 			sig_chunk := firmware.Signature[sig_addr : sig_addr+0x10]
 
 			// write signature slice
 			err = u.WriteSignatureSliceTI(sig_addr, sig_chunk)
 			if err != nil {
-				return err
+				return written, err
 			}
 		}
 	}
 
 	// Check CRC
-	fmt.Println("Initiate firmware CRC/signature check - don't unplug!!")
+	u.logln("Initiate firmware CRC/signature check - don't unplug!!")
 	err = u.CheckFirmwareCrcAndSignatureTI()
 	if err != nil {
-		return err
+		return written, err
 	}
 
-	fmt.Println("Firmware flashing SUCCEEDED")
-	return nil
+	u.logln("Firmware flashing SUCCEEDED")
+	return written, nil
 }
 
 func (u *USBBootloaderDongle) FlashReceiverNordic(firmware *Firmware) (err error) {
+	_, err = u.flashNordic(context.Background(), firmware, 0, nil)
+	return
+}
+
+func (u *USBBootloaderDongle) flashNordic(ctx context.Context, firmware *Firmware, resume int, progress func(written int, total int)) (written int, err error) {
+	written = resume
 	if firmware == nil || firmware.TargetType != FIRMWARE_TARGET_TYPE_NORDIC {
-		return errors.New("Provided firmware is not build for nRF24 based receivers")
+		return written, errors.New("Provided firmware is not build for nRF24 based receivers")
 	}
 
 	signature_required := false
 
 	_, BLmaj, BLmin, _, err := u.GetBLVersionString()
 	if err != nil {
-		log.Fatal(err)
+		return written, err
 	}
 	if BLmaj != 0x01 {
-		return errors.New("bootloader major version hints that this is not a Nordic nRF24LU1+ based Logitech dongle")
+		return written, errors.New("bootloader major version hints that this is not a Nordic nRF24LU1+ based Logitech dongle")
 	}
 
 	if BLmaj >= 1 && BLmin >= 4 {
-		fmt.Println("CAUTION: According to bootloader version, only signed firmwares are accepted!")
+		u.logln("CAUTION: According to bootloader version, only signed firmwares are accepted!")
 		signature_required = true
 
 		if !firmware.HasSignature {
-			return errors.New("provided firmware has no signature, but the bootloader requires one.")
+			return written, errors.New("provided firmware has no signature, but the bootloader requires one.")
 		}
 	}
 
-	fmt.Println("Retrieving firmware memory info from bootloader...")
+	u.logln("Retrieving firmware memory info from bootloader...")
 	fwStartAddr, fwEndAddr, fwFlashWriteBufSize, err := u.GetFirmwareMemoryInfo()
 	if err != nil {
-		return err
+		return written, err
 	}
 
 	fwbytes, err := firmware.BaseImage()
 	if err != nil {
-		return errors.New(fmt.Sprintf("error fetching firmware base image: %v", err))
+		return written, errors.New(fmt.Sprintf("error fetching firmware base image: %v", err))
 
 	}
 
 	intended_fw_size := fwEndAddr - fwStartAddr + 1
 	if intended_fw_size != firmware.Size {
-		return errors.New(fmt.Sprintf("Firmware doesn't match target's bootloader memory layout (firmware size %#x, intended %#x)", firmware.Size, intended_fw_size))
-	}
-
-	//erase flash
-	//ToDo: let user decide to continue
-	fmt.Println("Erasing dongle flash: CAUTION the dongle will not be usable, if successive operations fail")
-	for eraseAddr := fwStartAddr; eraseAddr < fwEndAddr; eraseAddr += fwFlashWriteBufSize {
-		err = u.EraseFlashNordic(eraseAddr)
-		if err != nil {
-			return err
-		}
+		return written, errors.New(fmt.Sprintf("Firmware doesn't match target's bootloader memory layout (firmware size %#x, intended %#x)", firmware.Size, intended_fw_size))
 	}
 
-	fmt.Println("Writing firmware")
 	writeSize := uint16(0x1C)
 	if BLmin < 0x04 {
 		writeSize = uint16(0x10) //16 byte per write on old bootloader, on newer ones 28 bytes
 	}
-	for addr := fwStartAddr + 0x01; addr <= fwEndAddr; addr += writeSize { //skip first chunk
+	// the first byte is written last (initiates the CRC check), thus writes are aligned to offset 1
+	if resume < 0 || resume > len(fwbytes) || (resume != 0 && resume != len(fwbytes) && (resume-1)%int(writeSize) != 0) {
+		return written, errors.New(fmt.Sprintf("can't resume flashing at offset %#x, doesn't match a write boundary", resume))
+	}
+
+	startAddr := fwStartAddr + 0x01 //skip first chunk
+	if resume == 0 {
+		//erase flash
+		//ToDo: let user decide to continue
+		u.logln("Erasing dongle flash: CAUTION the dongle will not be usable, if successive operations fail")
+		for eraseAddr := fwStartAddr; eraseAddr < fwEndAddr; eraseAddr += fwFlashWriteBufSize {
+			err = u.EraseFlashNordic(eraseAddr)
+			if err != nil {
+				return written, err
+			}
+		}
+	} else {
+		startAddr = fwStartAddr + uint16(resume)
+		u.logf("Resuming flash write at %#04x\n", startAddr)
+	}
+
+	u.logln("Writing firmware")
+	for addr := startAddr; addr <= fwEndAddr; addr += writeSize {
+		if ctx.Err() != nil {
+			return written, errors.New(fmt.Sprintf("flashing aborted at %#04x, receiver remains in bootloader mode: %v", addr, ctx.Err()))
+		}
 		chunkEndAddr := addr + writeSize
 		if chunkEndAddr > firmware.Size {
 			chunkEndAddr = firmware.Size
@@ -1598,13 +2835,17 @@ func (u *USBBootloaderDongle) FlashReceiverNordic(firmware *Firmware) (err error
 		// write RAM buffer to flash at proper address
 		err = u.WriteFirmwareSliceToFlashNordic(addr, chunk)
 		if err != nil {
-			return err
+			return written, err
+		}
+		written = int(chunkEndAddr - fwStartAddr)
+		if progress != nil {
+			progress(written, len(fwbytes))
 		}
 	}
 
 	// Write signature
 	if signature_required {
-		fmt.Println("Trying to write signature for firmware")
+		u.logln("Trying to write signature for firmware")
 		for sig_addr := uint16(0x0000); sig_addr <= uint16(0x00ff); sig_addr += 0x1c {
 			chunkEnd := sig_addr + 0x1c
 			if chunkEnd > uint16(len(firmware.Signature)) {
@@ -1615,27 +2856,193 @@ func (u *USBBootloaderDongle) FlashReceiverNordic(firmware *Firmware) (err error
 			// write signature slice
 			err = u.WriteSignatureSliceNordic(sig_addr, sig_chunk)
 			if err != nil {
-				return err
+				return written, err
 			}
 		}
 	}
 
 	/*
 	//write last chunk
-	fmt.Println("Writing last chunk...")
+	u.logln("Writing last chunk...")
 	err = u.WriteFirmwareSliceToFlashNordic(0x0001, fwbytes[1:0x0a])
 	if err != nil {
 		return err
 	}
 	*/
-	fmt.Println("Writing first byte, to init CRC check - don't unplug!! ...")
+	u.logln("Writing first byte, to init CRC check - don't unplug!! ...")
 	err = u.WriteFirmwareSliceToFlashNordic(0x0000, fwbytes[0:1])
+	if err != nil {
+		return written, err
+	}
+
+	u.logln("Firmware flashing SUCCEEDED")
+	return written, nil
+}
+
+// ErrFirmwareReadUnsupported is returned by ReadFirmware and CompareFirmware, if the bootloader of the receiver doesn't
+// support flash reads (TI CC2544 based receivers)
+var ErrFirmwareReadUnsupported = errors.New("reading firmware is only supported by bootloaders of Nordic nRF24LU1+ based receivers")
+
+// ReadFirmware reads back the firmware region of the receiver (Nordic bootloaders only, the TI bootloader doesn't
+// support flash reads). progress (could be nil) is called after each read slice with the number of bytes read so far
+// and the total length.
+func (u *USBBootloaderDongle) ReadFirmware(progress func(read int, total int)) (fw []byte, err error) {
+	return u.ReadFirmwareContext(context.Background(), progress)
+}
+
+// ReadFirmwareContext reads back the firmware like ReadFirmware, but could be cancelled with ctx (checked between
+// slices). Reading doesn't modify the flash, thus the receiver stays usable after cancellation.
+func (u *USBBootloaderDongle) ReadFirmwareContext(ctx context.Context, progress func(read int, total int)) (fw []byte, err error) {
+	_, BLmaj, _, _, err := u.GetBLVersionString()
+	if err != nil {
+		return nil, err
+	}
+	if BLmaj != 0x01 {
+		return nil, ErrFirmwareReadUnsupported
+	}
+
+	fwStart, fwEnd, _, err := u.GetFirmwareMemoryInfo()
+	if err != nil {
+		return nil, errors.New("Can't determin start/end offset of firmware to read")
+	}
+
+	total := int(fwEnd) - int(fwStart) + 1
+	fw = make([]byte, 0, total)
+	slen := uint16(0x1c)
+	for offset := int(fwStart); offset <= int(fwEnd); offset += int(slen) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if offset+int(slen) > int(fwEnd) {
+			slen = uint16(int(fwEnd) - offset + 1)
+		}
+
+		err, fwSlice := u.ReadFirmwareSliceFromFlashNordic(uint16(offset), byte(slen))
+		if err != nil {
+			return nil, err
+		}
+		fw = append(fw, fwSlice...)
+		if progress != nil {
+			progress(len(fw), total)
+		}
+	}
+	return
+}
+
+// CompareFirmware reads back the firmware of the receiver and compares it to the base image of the given firmware.
+// It returns true if both are identical, otherwise the differing regions are returned. Nordic nRF24LU1+ bootloaders
+// only, for other receivers ErrFirmwareReadUnsupported is returned (see ReadFirmware).
+func (u *USBBootloaderDongle) CompareFirmware(f *Firmware) (equal bool, diffs []FirmwareDiff, err error) {
+	_, BLmaj, _, _, err := u.GetBLVersionString()
+	if err != nil {
+		return false, nil, err
+	}
+	if BLmaj != 0x01 {
+		return false, nil, ErrFirmwareReadUnsupported
+	}
+
+	img, err := f.BaseImage()
+	if err != nil {
+		return false, nil, err
+	}
+
+	fwStart, _, _, err := u.GetFirmwareMemoryInfo()
+	if err != nil {
+		return false, nil, err
+	}
+
+	current, err := u.ReadFirmware(nil)
+	if err != nil {
+		return false, nil, err
+	}
+	if len(current) != len(img) {
+		return false, nil, errors.New(fmt.Sprintf("firmware size %#x doesn't match firmware region of the receiver (%#x)", len(img), len(current)))
+	}
+
+	diffs = DiffImages(fwStart, current, img)
+	return len(diffs) == 0, diffs, nil
+}
+
+// FlashFirmwareRawUnsafe DANGEROUS: writes data to the firmware region of the receiver, without any validation of
+// the image (no CRC, target or signature check). This is meant for testing bootloader behavior with deliberately
+// broken images and likely leaves the receiver stuck in bootloader mode. The length of data has to be a multiple of
+// the bootloader's flash page size and must not exceed the firmware region. progress (could be nil) is called after
+// each written page with the number of bytes written so far and the total length.
+// Use FlashReceiver for regular flashing.
+func (u *USBBootloaderDongle) FlashFirmwareRawUnsafe(data []byte, progress func(written int, total int)) (err error) {
+	_, BLmaj, BLmin, _, err := u.GetBLVersionString()
 	if err != nil {
 		return err
 	}
+	if BLmaj != 0x01 && BLmaj != 0x03 {
+		return errors.New(fmt.Sprintf("bootloader major version %02x hints that receiver is neither a TI CC2544 nor Nordic nRF24LU1+, aborting...", BLmaj))
+	}
 
-	fmt.Println("Firmware flashing SUCCEEDED")
-	return nil
+	fwStartAddr, fwEndAddr, fwFlashWriteBufSize, err := u.GetFirmwareMemoryInfo()
+	if err != nil {
+		return err
+	}
+	if fwFlashWriteBufSize == 0 || len(data) == 0 || len(data)%int(fwFlashWriteBufSize) != 0 {
+		return errors.New(fmt.Sprintf("data length %#x is no multiple of the flash page size %#x", len(data), fwFlashWriteBufSize))
+	}
+	if len(data) > int(fwEndAddr)-int(fwStartAddr)+1 {
+		return errors.New(fmt.Sprintf("data length %#x exceeds firmware region %#04x-%#04x", len(data), fwStartAddr, fwEndAddr))
+	}
+
+	u.logln("Erasing dongle flash: CAUTION the dongle will not be usable, if successive operations fail")
+	if BLmaj == 0x03 {
+		err = u.EraseFlashTI()
+	} else {
+		for eraseAddr := fwStartAddr; eraseAddr < fwEndAddr && err == nil; eraseAddr += fwFlashWriteBufSize {
+			err = u.EraseFlashNordic(eraseAddr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for offset := 0; offset < len(data); offset += int(fwFlashWriteBufSize) {
+		page := data[offset : offset+int(fwFlashWriteBufSize)]
+		addr := fwStartAddr + uint16(offset)
+		if BLmaj == 0x03 {
+			for ramAddr := uint16(0x0000); ramAddr < fwFlashWriteBufSize; ramAddr += 16 {
+				err = u.WriteFirmwareSliceToRAMBufferTI(ramAddr, page[ramAddr:ramAddr+16])
+				if err != nil {
+					return err
+				}
+			}
+			err = u.StoreRAMBufferToFlashAddrTI(addr)
+		} else {
+			// the first byte of the image is written last, as it initiates the CRC check
+			writeSize := uint16(0x1C)
+			if BLmin < 0x04 {
+				writeSize = uint16(0x10)
+			}
+			for pos := uint16(0); pos < fwFlashWriteBufSize && err == nil; pos += writeSize {
+				if offset == 0 && pos == 0 {
+					pos = 1
+				}
+				end := pos + writeSize
+				if end > fwFlashWriteBufSize {
+					end = fwFlashWriteBufSize
+				}
+				err = u.WriteFirmwareSliceToFlashNordic(addr+pos, page[pos:end])
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(offset+len(page), len(data))
+		}
+	}
+
+	// let the bootloader check the written image, the result is returned as error
+	u.logln("Initiate firmware CRC check - don't unplug!!")
+	if BLmaj == 0x03 {
+		return u.CheckFirmwareCrcAndSignatureTI()
+	}
+	return u.WriteFirmwareSliceToFlashNordic(fwStartAddr, data[0:1])
 }
 
 func NewUSBBootloaderDongle() (res *USBBootloaderDongle, err error) {
@@ -1644,39 +3051,72 @@ func NewUSBBootloaderDongle() (res *USBBootloaderDongle, err error) {
 
 	res.UsbCtx = gousb.NewContext()
 
+	if err = res.openDevice(); err != nil {
+		res.Close()
+		return nil, eNoDongle
+	}
+
+	if err = res.setup(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Reopen closes the receiver and opens the first receiver in bootloader mode found on USB again, f.e. after the
+// receiver re-enumerated. Settings (SetShowInOut, SetForceDowngrade) are kept.
+func (u *USBBootloaderDongle) Reopen() (err error) {
+	u.Close()
+
+	u.closeMutex.Lock()
+	u.closed = false
+	u.Dev, u.Config, u.IfaceHID, u.EpInHid = nil, nil, nil, nil
+	u.closeMutex.Unlock()
+
+	u.UsbCtx = gousb.NewContext()
+	if err = u.openDevice(); err != nil {
+		u.Close()
+		return err
+	}
+	return u.setup()
+}
+
+// openDevice opens the first known receiver in bootloader mode, eNoDongle is returned if there is none
+func (res *USBBootloaderDongle) openDevice() (err error) {
 	if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_BOOT_LOADER_LIGHTSPEED_G603); err == nil && res.Dev != nil {
-		fmt.Println("Found Logitech LIGHTSPEED receiver in bootloader mode")
+		res.logln("Found Logitech LIGHTSPEED receiver in bootloader mode")
 	} else if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_BOOT_LOADER_NORDIC); err == nil && res.Dev != nil {
-		fmt.Println("Found Unifying receiver with Nordic chip in bootloader mode")
+		res.logln("Found Unifying receiver with Nordic chip in bootloader mode")
 	} else if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_BOOT_LOADER_NORDIC2); err == nil && res.Dev != nil {
-		fmt.Println("Found Unifying receiver with Nordic chip in bootloader mode")
+		res.logln("Found Unifying receiver with Nordic chip in bootloader mode")
 	} else if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_BOOT_LOADER_TI); err == nil && res.Dev != nil {
-		fmt.Println("Found Unifying receiver with Texas Instruments chip in bootloader mode")
+		res.logln("Found Unifying receiver with Texas Instruments chip in bootloader mode")
 	} else if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_BOOT_LOADER_TI_NANO); err == nil && res.Dev != nil {
-		fmt.Println("Found Unifying Nano receiver with Texas Instruments chip in bootloader mode")
+		res.logln("Found Unifying Nano receiver with Texas Instruments chip in bootloader mode")
 	} else if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_BOOT_LOADER_TI_R500); err == nil && res.Dev != nil {
-		fmt.Println("Found presentation clicker receiver (R500) with Texas Instruments chip in bootloader mode")
+		res.logln("Found presentation clicker receiver (R500) with Texas Instruments chip in bootloader mode")
 	} else if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_BOOT_LOADER_TI_SPOTLIGHT); err == nil && res.Dev != nil {
-		fmt.Println("Found presentation clicker receiver (SPOTLIGHT) with Texas Instruments chip in bootloader mode")
+		res.logln("Found presentation clicker receiver (SPOTLIGHT) with Texas Instruments chip in bootloader mode")
 	} else if res.Dev, err = res.UsbCtx.OpenDeviceWithVIDPID(VID, PID_CU0016_R500); err == nil && res.Dev != nil {
-		fmt.Println("Found CU0016 Dongle for R500 presentation clicker")
+		res.logln("Found CU0016 Dongle for R500 presentation clicker")
 	} else {
-		res.Close()
-		log.Fatal("No known dongle found")
-
-		return nil, eNoDongle
+		return eNoDongle
 	}
+	return nil
+}
 
+// setup claims the HID interface of the opened receiver (res.Dev) and starts report processing. On error, the
+// receiver is closed.
+func (res *USBBootloaderDongle) setup() (err error) {
 	//Get device config 1
 	res.Config, err = res.Dev.Config(1)
 	if err != nil {
 		res.Close()
-		return nil, errors.New("Couldn't retrieve config 1 of LocalUSBDongle dongle")
+		return errors.New("Couldn't retrieve config 1 of LocalUSBDongle dongle")
 	}
 
 	//fmt.Println("Using dongle USB config:", res.Config.Desc.String())
 
-	fmt.Println("... will be detached from Kernel, to avoid interference from other software")
+	res.logln("... will be detached from Kernel, to avoid interference from other software")
 	res.Dev.SetAutoDetach(true)
 	res.Dev.Reset()
 
@@ -1692,15 +3132,15 @@ Outer:
 					res.IfaceHID, err = res.Config.Interface(ifaceSettings.Number, ifaceSettings.Alternate)
 					if err != nil {
 						res.Close()
-						return nil, errors.New(fmt.Sprintf("Couldn't access HID USB interface: %v", err))
+						return errors.New(fmt.Sprintf("Couldn't access HID USB interface: %v", err))
 					} else {
-						fmt.Println("... accessing receiver on HID interface:", res.IfaceHID.String())
+						res.logln("... accessing receiver on HID interface:", res.IfaceHID.String())
 					}
 
 					res.EpInHid, err = res.IfaceHID.InEndpoint(epDesc.Number)
 					if err != nil {
 						res.Close()
-						return nil, errors.New("Couldn't access HID USB interface IN endpoint")
+						return errors.New("Couldn't access HID USB interface IN endpoint")
 					} else {
 						//fmt.Println("HID interface IN endpoint:", res.EpInHid.String())
 						break Outer
@@ -1712,7 +3152,7 @@ Outer:
 
 	if res.EpInHid == nil {
 		res.Close()
-		return nil, errors.New("Couldn't find EP for HID++ input reports")
+		return errors.New("Couldn't find EP for HID++ input reports")
 	}
 
 	res.sndQueue = make(chan BootloaderReport)
@@ -1720,8 +3160,8 @@ Outer:
 
 	res.ctx, res.cancel = context.WithCancel(context.Background())
 
-	go res.rcvLoop()
-	go res.sndLoop()
+	go res.rcvLoop(res.ctx, res.EpInHid, res.rcvQueue)
+	go res.sndLoop(res.ctx, res.Dev, res.IfaceHID, res.sndQueue)
 
 	return
 }
@@ -0,0 +1,449 @@
+package unifying
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTransport answers each report written with the reports returned by respond, it stands in for a receiver
+type fakeTransport struct {
+	respond func(report []byte) [][]byte
+
+	mutex   sync.Mutex // guards written
+	written [][]byte
+	inQueue chan []byte
+	closed  chan struct{}
+	close   sync.Once
+}
+
+func newFakeTransport(respond func(report []byte) [][]byte) *fakeTransport {
+	return &fakeTransport{respond: respond, inQueue: make(chan []byte, 64), closed: make(chan struct{})}
+}
+
+func (t *fakeTransport) Write(report []byte) error {
+	t.mutex.Lock()
+	t.written = append(t.written, append([]byte{}, report...))
+	t.mutex.Unlock()
+	if t.respond != nil {
+		for _, r := range t.respond(report) {
+			t.inQueue <- r
+		}
+	}
+	return nil
+}
+
+func (t *fakeTransport) Read(buf []byte, timeout time.Duration) (n int, err error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case report := <-t.inQueue:
+		return copy(buf, report), nil
+	case <-expired:
+		return 0, ErrTransportTimeout
+	case <-t.closed:
+		return 0, ErrDongleClosed
+	}
+}
+
+func (t *fakeTransport) Close() error {
+	t.close.Do(func() { close(t.closed) })
+	return nil
+}
+
+func (t *fakeTransport) writtenReports() [][]byte {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([][]byte{}, t.written...)
+}
+
+// fakeRegisters maps register address and first request parameter (f.e. the sub-register) to the register value
+type fakeRegisters map[[2]byte][]byte
+
+// registerResponder answers HID++ 1.0 register reads of the receiver (index 0xff) from short and long register
+// values, reads of other registers are answered with an invalid address error. Register writes are acknowledged.
+func registerResponder(short fakeRegisters, long fakeRegisters) func(report []byte) [][]byte {
+	return func(report []byte) [][]byte {
+		if len(report) < 5 || report[1] != 0xff {
+			return nil
+		}
+		id, reg := HidPPMsgSubID(report[2]), report[3]
+		key := [2]byte{reg, report[4]}
+		switch id {
+		case HIDPP_MSG_ID_GET_REGISTER_REQ:
+			if value, ok := short[key]; ok {
+				rsp := make([]byte, USB_REPORT_TYPE_HIDPP_SHORT_LEN)
+				copy(rsp, []byte{byte(USB_REPORT_TYPE_HIDPP_SHORT), 0xff, byte(id), reg})
+				copy(rsp[4:], value)
+				return [][]byte{rsp}
+			}
+		case HIDPP_MSG_ID_GET_LONG_REGISTER_REQ:
+			if value, ok := long[key]; ok {
+				rsp := make([]byte, USB_REPORT_TYPE_HIDPP_LONG_LEN)
+				copy(rsp, []byte{byte(USB_REPORT_TYPE_HIDPP_LONG), 0xff, byte(id), reg})
+				copy(rsp[4:], value)
+				return [][]byte{rsp}
+			}
+		case HIDPP_MSG_ID_SET_REGISTER_REQ, HIDPP_MSG_ID_SET_LONG_REGISTER_REQ:
+			return [][]byte{{byte(USB_REPORT_TYPE_HIDPP_SHORT), 0xff, byte(id), reg, 0x00, 0x00, 0x00}}
+		default:
+			return nil
+		}
+		return [][]byte{{byte(USB_REPORT_TYPE_HIDPP_SHORT), 0xff, byte(HIDPP_MSG_ID_ERROR_MSG), byte(id), reg, hidpp10ErrorInvalidAddress, 0x00}}
+	}
+}
+
+func newFakeDongle(t *testing.T, respond func(report []byte) [][]byte) (*LocalUSBDongle, *fakeTransport) {
+	t.Helper()
+	transport := newFakeTransport(respond)
+	u, err := NewDongleWithTransport(transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.SetTimeout(100 * time.Millisecond)
+	t.Cleanup(u.Close)
+	return u, transport
+}
+
+func TestNewDongleWithTransportRegisterAccess(t *testing.T) {
+	u, transport := newFakeDongle(t, registerResponder(
+		fakeRegisters{{0xf1, 0x01}: {0x01, 0x24, 0x07}},
+		fakeRegisters{{0xb5, 0x20}: {0x20, 0x01, 0x02, 0x03}},
+	))
+
+	maj, min, err := u.GetReceiverFirmwareMajorMinorVersion()
+	if err != nil || maj != FIRMWARE_MAJOR_UNIFYING_TI || min != 0x07 {
+		t.Errorf("firmware version %02x.%02x (%v), want 24.07", byte(maj), min, err)
+	}
+
+	// the short read is rejected, GetRegister has to repeat it as long read
+	value, err := u.GetRegister(0xb5, []byte{0x20})
+	if err != nil || len(value) != USB_REPORT_TYPE_HIDPP_LONG_PAYLOAD_LEN-1 || value[0] != 0x20 || value[3] != 0x03 {
+		t.Errorf("long register value % 02x (%v)", value, err)
+	}
+	written := transport.writtenReports()
+	if len(written) != 3 || written[1][2] != byte(HIDPP_MSG_ID_GET_REGISTER_REQ) || written[2][2] != byte(HIDPP_MSG_ID_GET_LONG_REGISTER_REQ) {
+		t.Errorf("unexpected requests % 02x", written)
+	}
+
+	_, err = u.GetLongRegister(0x42, nil)
+	var hppErr *HidPPError
+	if !errors.As(err, &hppErr) || byte(hppErr.Code) != hidpp10ErrorInvalidAddress {
+		t.Errorf("reading a missing register returned %v, want invalid address error", err)
+	}
+}
+
+func TestNewDongleWithTransportTimeoutAndClose(t *testing.T) {
+	u, _ := newFakeDongle(t, nil)
+
+	if _, err := u.GetRegister(0xf1, []byte{0x01}); err == nil {
+		t.Error("request without response succeeded")
+	}
+	u.Close()
+	if _, err := u.GetRegister(0xf1, []byte{0x01}); err != ErrDongleClosed {
+		t.Errorf("request on closed dongle returned %v, want ErrDongleClosed", err)
+	}
+}
+
+func TestNewDongleWithTransportNil(t *testing.T) {
+	if _, err := NewDongleWithTransport(nil); err == nil {
+		t.Error("nil transport accepted")
+	}
+}
+
+// testReceiverRegisters are the registers of a TI Unifying receiver, with stored firmware version RQR24.06_B0029 and
+// running firmware version RQR24.07_B0030
+func testReceiverRegisters() (short fakeRegisters, long fakeRegisters) {
+	short = fakeRegisters{
+		{0xf1, 0x01}: {0x01, 0x24, 0x07},
+		{0xf1, 0x02}: {0x02, 0x00, 0x30},
+		{0xf1, 0x04}: {0x04, 0x03, 0x02},
+	}
+	long = fakeRegisters{
+		{0xb5, 0x02}: {0x02, 0x24, 0x06, 0x00, 0x29, 0x88, 0x02, 0x04},
+		{0xb5, 0x03}: {0x03, 0x11, 0x22, 0x33, 0x44, 0x00, 0x06},
+	}
+	return
+}
+
+func TestGetRunningFirmwareVersion(t *testing.T) {
+	u, _ := newFakeDongle(t, registerResponder(testReceiverRegisters()))
+
+	v, err := u.GetRunningFirmwareVersion()
+	if err != nil || v != (FirmwareVersionInfo{Major: FIRMWARE_MAJOR_UNIFYING_TI, Minor: 0x07, Build: 0x0030}) {
+		t.Errorf("running firmware %s (%v), want RQR24.07.B0030", v, err)
+	}
+
+	info, err := u.GetDongleInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.FwMajor != 0x24 || info.FwMinor != 0x06 || info.FwBuild != 0x0029 {
+		t.Errorf("stored firmware %02x.%02x.B%04x, want 24.06.B0029", info.FwMajor, info.FwMinor, info.FwBuild)
+	}
+	if !info.HasRunningFirmware || info.RunningFirmware != v {
+		t.Errorf("dongle info reports running firmware %s (%v), want %s", info.RunningFirmware, info.HasRunningFirmware, v)
+	}
+}
+
+func TestGetRunningFirmwareVersionUnsupported(t *testing.T) {
+	short, long := testReceiverRegisters()
+	delete(short, [2]byte{0xf1, 0x02})
+	u, _ := newFakeDongle(t, registerResponder(short, long))
+
+	if _, err := u.GetRunningFirmwareVersion(); err == nil {
+		t.Error("running firmware version without build returned")
+	}
+	info, err := u.GetDongleInfo()
+	if err != nil || info.HasRunningFirmware {
+		t.Errorf("dongle info reports running firmware %s (%v)", info.RunningFirmware, err)
+	}
+}
+
+// pairingResponder acts like a receiver with closed pairing lock, on which a K400 Plus connects as soon as the
+// pairing lock is opened. If pair is false, the lock is left open till it is closed again.
+func pairingResponder(pair bool) func(report []byte) [][]byte {
+	registers := registerResponder(fakeRegisters{{byte(DONGLE_HIDPP_REGISTER_CONNECTION_STATE), 0x00}: {0x00, 0x01, 0x00}}, nil)
+	return func(report []byte) [][]byte {
+		res := registers(report)
+		if report[2] == byte(HIDPP_MSG_ID_SET_REGISTER_REQ) && report[3] == byte(DONGLE_HIDPP_REGISTER_PAIRING) && report[4] == UNIFYING_PAIRING_P0_OPEN_LOCK && pair {
+			res = append(res,
+				[]byte{byte(USB_REPORT_TYPE_HIDPP_SHORT), 0x01, byte(HIDPP_MSG_ID_DEVICE_CONNECTION), 0x04, 0x21, 0x4d, 0x40},
+				[]byte{byte(USB_REPORT_TYPE_HIDPP_SHORT), 0xff, byte(HIDPP_MSG_ID_RECEIVER_LOCKING_INFORMATION), 0x00, 0x00, 0x00, 0x00},
+			)
+		}
+		return res
+	}
+}
+
+func TestStartPairingWithEvents(t *testing.T) {
+	u, _ := newFakeDongle(t, pairingResponder(true))
+
+	events := make(chan PairingEvent, 8)
+	if err := u.StartPairingWithEvents(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	close(events)
+	var stages []PairingStage
+	for e := range events {
+		stages = append(stages, e.Stage)
+		if e.Stage == PAIRING_STAGE_COMPLETE && (e.Device == nil || e.Device.DeviceIndex != 0x01 || e.Device.WPID != 0x404d) {
+			t.Errorf("pairing completed with device %v, want K400 Plus on index 1", e.Device)
+		}
+	}
+	if len(stages) != 3 || stages[0] != PAIRING_STAGE_LOCK_OPEN || stages[1] != PAIRING_STAGE_DEVICE_DETECTED || stages[2] != PAIRING_STAGE_COMPLETE {
+		t.Errorf("unexpected pairing stages %v", stages)
+	}
+}
+
+func TestStartPairingWithEventsCancel(t *testing.T) {
+	u, transport := newFakeDongle(t, pairingResponder(false))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan PairingEvent, 8)
+	go func() {
+		<-events // PAIRING_STAGE_LOCK_OPEN
+		cancel()
+	}()
+	if err := u.StartPairingWithEvents(ctx, events); err != context.Canceled {
+		t.Errorf("cancelled pairing returned %v, want %v", err, context.Canceled)
+	}
+	closed := false
+	for _, r := range transport.writtenReports() {
+		if r[2] == byte(HIDPP_MSG_ID_SET_REGISTER_REQ) && r[3] == byte(DONGLE_HIDPP_REGISTER_PAIRING) && r[4] == UNIFYING_PAIRING_P0_CLOSE_LOCK {
+			closed = true
+		}
+	}
+	if !closed {
+		t.Error("pairing lock not closed after cancel")
+	}
+}
+
+func TestProbeRegister(t *testing.T) {
+	registers := registerResponder(fakeRegisters{{0xf1, 0x00}: {0x00}}, nil)
+	u, transport := newFakeDongle(t, func(report []byte) [][]byte {
+		if report[3] == 0xd4 {
+			// register expects an address
+			return [][]byte{{byte(USB_REPORT_TYPE_HIDPP_SHORT), 0xff, byte(HIDPP_MSG_ID_ERROR_MSG), report[2], report[3], 0x0b, 0x00}}
+		}
+		return registers(report)
+	})
+
+	for reg, want := range map[byte]bool{0xf1: true, 0xd4: true, 0x42: false} {
+		if present, err := u.ProbeRegister(reg); err != nil || present != want {
+			t.Errorf("register %#02x present: %v (%v), want %v", reg, present, err, want)
+		}
+	}
+	for _, r := range transport.writtenReports() {
+		if r[2] == byte(HIDPP_MSG_ID_SET_REGISTER_REQ) || r[2] == byte(HIDPP_MSG_ID_SET_LONG_REGISTER_REQ) {
+			t.Errorf("probe wrote to the receiver: % 02x", r)
+		}
+	}
+}
+
+// queueNotifications makes the fake receiver send count device connection notifications, the first parameter holds
+// the sequence number
+func queueNotifications(transport *fakeTransport, count int) {
+	go func() {
+		for i := 0; i < count; i++ {
+			transport.inQueue <- []byte{byte(USB_REPORT_TYPE_HIDPP_SHORT), 0x01, byte(HIDPP_MSG_ID_DEVICE_CONNECTION), byte(i), 0x00, 0x00, 0x00}
+		}
+	}()
+}
+
+func TestNotificationsDropOldest(t *testing.T) {
+	u, transport := newFakeDongle(t, nil)
+	u.SetNotificationBuffer(8, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notifications := u.Notifications(ctx)
+
+	queueNotifications(transport, 100)
+	deadline := time.Now().Add(5 * time.Second)
+	for u.DroppedNotifications() < 92 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if dropped := u.DroppedNotifications(); dropped != 92 {
+		t.Fatalf("%d notifications dropped, want 92", dropped)
+	}
+	for i := 92; i < 100; i++ {
+		r := <-notifications
+		if msg, ok := r.(*HidPPMsg); !ok || msg.Parameters[0] != byte(i) {
+			t.Errorf("received %s, want notification %d", r, i)
+		}
+	}
+}
+
+func TestNotificationsBlocking(t *testing.T) {
+	u, transport := newFakeDongle(t, nil)
+	u.SetNotificationBuffer(8, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notifications := u.Notifications(ctx)
+
+	queueNotifications(transport, 100)
+	time.Sleep(50 * time.Millisecond) // let the reader catch up with the full buffer
+	for i := 0; i < 100; i++ {
+		r := <-notifications
+		if msg, ok := r.(*HidPPMsg); !ok || msg.Parameters[0] != byte(i) {
+			t.Fatalf("received %s, want notification %d", r, i)
+		}
+	}
+	if dropped := u.DroppedNotifications(); dropped != 0 {
+		t.Errorf("%d notifications dropped in blocking mode", dropped)
+	}
+}
+
+func TestGetDongleInfoEntityVersions(t *testing.T) {
+	u, transport := newFakeDongle(t, registerResponder(testReceiverRegisters()))
+
+	info, err := u.GetDongleInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []EntityVersion{
+		{Type: ENTITY_TYPE_MAIN_APPLICATION, Name: "RQR", Major: 0x24, Minor: 0x07, Build: 0x0030, HasBuild: true},
+		{Type: ENTITY_TYPE_BOOTLOADER, Name: "BOT", Major: 0x03, Minor: 0x02},
+	}
+	if len(info.EntityVersions) != len(want) || info.EntityVersions[0] != want[0] || info.EntityVersions[1] != want[1] {
+		t.Errorf("entities %v, want %v", info.EntityVersions, want)
+	}
+	if info.BootloaderMajor != 0x03 || info.BootloaderMinor != 0x02 {
+		t.Errorf("bootloader %02x.%02x, want 03.02", info.BootloaderMajor, info.BootloaderMinor)
+	}
+
+	blReads := 0
+	for _, r := range transport.writtenReports() {
+		if r[3] == byte(DONGLE_HIDPP_REGISTER_FIRMWARE_INFO) && r[4] == 0x04 {
+			blReads++
+		}
+	}
+	if blReads != 1 {
+		t.Errorf("bootloader version read %d times", blReads)
+	}
+}
+
+func TestGetDongleInfoSupportsFwUpdate(t *testing.T) {
+	for _, implemented := range []bool{false, true} {
+		short, long := testReceiverRegisters()
+		if implemented {
+			short[[2]byte{byte(DONGLE_HIDPP_REGISTER_FIRMWARE_UPDATE), 0x00}] = []byte{0x00}
+		}
+		u, _ := newFakeDongle(t, registerResponder(short, long))
+		info, err := u.GetDongleInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.SupportsFwUpdate != implemented || !info.SupportsPairing {
+			t.Errorf("firmware update register implemented %v: SupportsFwUpdate %v, SupportsPairing %v", implemented, info.SupportsFwUpdate, info.SupportsPairing)
+		}
+	}
+}
+
+func TestGetDongleInfoReplay(t *testing.T) {
+	f, err := os.Open("testdata/dongleinfo_unifying.session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	transport, err := ReplaySession(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := NewDongleWithTransport(transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.SetTimeout(100 * time.Millisecond)
+	defer u.Close()
+
+	info, err := u.GetDongleInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.FwMajor != 0x24 || info.FwMinor != 0x06 || info.FwBuild != 0x0029 || info.LikelyProto != 0x04 {
+		t.Errorf("dongle info firmware %02x.%02x.%04x proto %02x, want 24.06.0029 proto 04", info.FwMajor, info.FwMinor, info.FwBuild, info.LikelyProto)
+	}
+	if info.RunningFirmware != (FirmwareVersionInfo{Major: FIRMWARE_MAJOR_UNIFYING_TI, Minor: 0x07, Build: 0x0030}) || !info.HasRunningFirmware {
+		t.Errorf("running firmware %s, want RQR24.07.B0030", info.RunningFirmware)
+	}
+	if info.BootloaderMajor != 0x03 || info.BootloaderMinor != 0x02 {
+		t.Errorf("bootloader %02x.%02x, want 03.02", info.BootloaderMajor, info.BootloaderMinor)
+	}
+	if !bytes.Equal(info.Serial, []byte{0x11, 0x22, 0x33, 0x44}) || info.MaxDevices != 6 || !info.SupportsPairing || !info.SupportsFwUpdate {
+		t.Errorf("serial % 02x, max devices %d, pairing %v, firmware update %v", info.Serial, info.MaxDevices, info.SupportsPairing, info.SupportsFwUpdate)
+	}
+
+	// every recorded request has been sent
+	replay := transport.(*replayTransport)
+	replay.mutex.Lock()
+	defer replay.mutex.Unlock()
+	if len(replay.records) != 0 {
+		t.Errorf("%d recorded reports left after GetDongleInfo", len(replay.records))
+	}
+}
+
+func TestDeviceDataPagesTI(t *testing.T) {
+	tests := []struct {
+		blMajor, blMinor byte
+		want             [2]uint16
+	}{
+		{0x02, 0x09, [2]uint16{0xec00, 0xf000}},
+		{0x03, 0x01, [2]uint16{0xec00, 0xf000}},
+		{0x03, 0x02, [2]uint16{0xe400, 0xe800}},
+		{0x04, 0x00, [2]uint16{0xe400, 0xe800}},
+	}
+	for _, tt := range tests {
+		if got := DeviceDataPagesTI(tt.blMajor, tt.blMinor); got != tt.want {
+			t.Errorf("BOT%02x.%02x: device data pages %#04x, want %#04x", tt.blMajor, tt.blMinor, got, tt.want)
+		}
+	}
+}